@@ -12,6 +12,7 @@ func main() {
 		UserName: "sean",
 		Provider: "local",
 		Email:    "sean.tang@axiapac.com.au",
+		Tenant:   "oktedi",
 	}, "IxrAjDoa2FqElO7IhrSrUJELhUckePEPVpaePlS/Xaw=", 3600)
 	fmt.Println(token)
 }
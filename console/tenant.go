@@ -0,0 +1,114 @@
+package console
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"axiapac.com/axiapac/core"
+	"gorm.io/gorm"
+)
+
+// DefaultDomain is appended to bare tenant names ("oktedi" ->
+// "oktedi.axiapac.net.au") before looking up their subscription.
+const DefaultDomain = "axiapac.net.au"
+
+// maxTenantEntries bounds the cache; Host headers are client controlled.
+const maxTenantEntries = 1024
+
+type tenantEntry struct {
+	schema      string
+	found       bool
+	deactivated bool
+	expiredAt   time.Time
+	loadedAt    time.Time
+}
+
+// TenantResolver is a core.TenantResolver backed by the console subscriptions:
+// a host is a tenant only when a Subscription has it as its Domain, and stays
+// one while that subscription is neither deactivated nor expired. Lookups are
+// cached for ttl.
+type TenantResolver struct {
+	db  *gorm.DB
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]tenantEntry // by domain
+}
+
+func NewTenantResolver(db *gorm.DB, ttl time.Duration) *TenantResolver {
+	return &TenantResolver{db: db, ttl: ttl, entries: make(map[string]tenantEntry)}
+}
+
+// ResolveTenant implements core.TenantResolver. The schema is the first label
+// of the subscription's domain.
+func (r *TenantResolver) ResolveTenant(ctx context.Context, host string) (string, error) {
+	domain := strings.ToLower(strings.TrimSpace(host))
+	if !strings.Contains(domain, ".") {
+		domain += "." + DefaultDomain
+	}
+	now := time.Now()
+
+	r.mu.Lock()
+	entry, ok := r.entries[domain]
+	r.mu.Unlock()
+	if !ok || now.Sub(entry.loadedAt) >= r.ttl {
+		var err error
+		if entry, err = r.load(ctx, domain, now); err != nil {
+			return "", err
+		}
+	}
+
+	switch {
+	case !entry.found:
+		return "", core.ErrTenantNotFound
+	case entry.deactivated, !now.Before(entry.expiredAt):
+		return "", core.ErrTenantInactive
+	}
+	return entry.schema, nil
+}
+
+func (r *TenantResolver) load(ctx context.Context, domain string, now time.Time) (tenantEntry, error) {
+	var subs []Subscription
+	if err := r.db.WithContext(ctx).Where("domain = ?", domain).Find(&subs).Error; err != nil {
+		return tenantEntry{}, fmt.Errorf("failed to look up subscription for %s: %w", domain, err)
+	}
+
+	entry := tenantEntry{loadedAt: now}
+	if len(subs) > 0 {
+		sub := preferredSubscription(subs, now)
+		entry.found = true
+		entry.schema = core.TenantFromHost(sub.Domain)
+		entry.deactivated = sub.Deactivated != 0
+		entry.expiredAt = sub.ExpiredAt
+	}
+
+	r.mu.Lock()
+	if len(r.entries) >= maxTenantEntries {
+		r.entries = make(map[string]tenantEntry)
+	}
+	r.entries[domain] = entry
+	r.mu.Unlock()
+	return entry, nil
+}
+
+// preferredSubscription picks the subscription a domain with several resolves
+// to: an active one (neither deactivated nor expired) first, then the latest
+// to expire, so an old subscription can't lock out a renewed tenant.
+func preferredSubscription(subs []Subscription, now time.Time) Subscription {
+	active := func(s Subscription) bool { return s.Deactivated == 0 && now.Before(s.ExpiredAt) }
+	best := subs[0]
+	for _, s := range subs[1:] {
+		switch {
+		case active(s) != active(best):
+			if active(s) {
+				best = s
+			}
+		case s.ExpiredAt.After(best.ExpiredAt):
+			best = s
+		}
+	}
+	return best
+}
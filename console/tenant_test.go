@@ -0,0 +1,32 @@
+package console
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreferredSubscription(t *testing.T) {
+	now := time.Date(2026, 1, 12, 0, 0, 0, 0, time.UTC)
+	expired := Subscription{ID: 1, ExpiredAt: now.AddDate(-1, 0, 0)}
+	current := Subscription{ID: 2, ExpiredAt: now.AddDate(1, 0, 0)}
+	renewed := Subscription{ID: 3, ExpiredAt: now.AddDate(2, 0, 0)}
+	deactivated := Subscription{ID: 4, ExpiredAt: now.AddDate(5, 0, 0), Deactivated: 1}
+
+	tests := []struct {
+		name string
+		subs []Subscription
+		want int
+	}{
+		{"only one", []Subscription{expired}, 1},
+		{"active over expired", []Subscription{expired, current}, 2},
+		{"active over expired, either order", []Subscription{current, expired}, 2},
+		{"active over deactivated", []Subscription{deactivated, current}, 2},
+		{"latest active", []Subscription{current, renewed, expired}, 3},
+		{"none active: latest to expire", []Subscription{expired, deactivated}, 4},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, preferredSubscription(tt.subs, now).ID, tt.name)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"gorm.io/driver/mysql"
@@ -25,6 +26,14 @@ const (
 type DatabaseManager struct {
 	SqlDB    *sql.DB
 	LogLevel LogLevel
+	// Tenants validates every schema before GetDB switches to it. Nil trusts
+	// the host name (local dev only).
+	Tenants TenantResolver
+
+	// pools is set by NewWithTenantPools.
+	pools *tenantPools
+	// replica is set by AddReplica.
+	replica *sql.DB
 }
 
 // New creates the global pool (e.g. 30 conns).
@@ -46,10 +55,11 @@ func New(dsn string, maxConnection int) (*DatabaseManager, error) {
 	return &DatabaseManager{SqlDB: sqlDB}, nil
 }
 
-// GetDB gets a *gorm.DB bound to a single connection
-// and sets the schema with `USE schema`.
-func (dm *DatabaseManager) GetDB(ctx context.Context, schema string) (*gorm.DB, *sql.Conn, error) {
-	if schema == "localhost" {
+// TenantFromHost resolves a request hostname to its tenant schema. The tenant
+// is the first DNS label ("oktedi.axiapac.net.au" -> "oktedi"); "localhost"
+// (local dev) falls back to the schema embedded in the DSN env var.
+func TenantFromHost(hostname string) string {
+	if hostname == "localhost" {
 		dsn := os.Getenv("DSN")
 
 		// Split on "?" to remove query params
@@ -58,17 +68,64 @@ func (dm *DatabaseManager) GetDB(ctx context.Context, schema string) (*gorm.DB,
 
 		// Split on "/" to get DB name (last part)
 		segments := strings.Split(dsnWithoutQuery, "/")
-		schema = segments[len(segments)-1]
-	} else {
-		// splite by "." and take the first. e.g. "oktedi.axiapac.net.au" -> "oktedi"
-		parts := strings.Split(schema, ".")
-		schema = parts[0]
+		return segments[len(segments)-1]
 	}
 
-	// Get a dedicated connection from pool
-	conn, err := dm.SqlDB.Conn(ctx)
+	// splite by "." and take the first. e.g. "oktedi.axiapac.net.au" -> "oktedi"
+	parts := strings.Split(hostname, ".")
+	return parts[0]
+}
+
+// Conn is a connection handed out by GetDB. Close returns it to its pool and,
+// with tenant pools, ends its lease on the pool, so the pool can't be closed
+// while the connection is in use.
+type Conn struct {
+	*sql.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *Conn) Close() error {
+	err := c.Conn.Close()
+	if c.release != nil {
+		c.once.Do(c.release)
+	}
+	return err
+}
+
+// GetDB gets a *gorm.DB bound to a single connection
+// and sets the schema with `USE schema`. host is resolved through
+// ResolveTenant first; unknown or inactive tenants never reach `USE`.
+func (dm *DatabaseManager) GetDB(ctx context.Context, host string) (*gorm.DB, *Conn, error) {
+	return dm.getDB(ctx, host, nil)
+}
+
+// getDB opens host's schema on a dedicated connection from replica, or from
+// the primary (tenant pools or the shared pool) when replica is nil.
+func (dm *DatabaseManager) getDB(ctx context.Context, host string, replica *sql.DB) (*gorm.DB, *Conn, error) {
+	schema, err := dm.ResolveTenant(ctx, host)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get conn: %w", err)
+		return nil, nil, fmt.Errorf("%s: %w", host, err)
+	}
+
+	pooled := replica == nil && dm.pools != nil
+	var conn *Conn
+	if pooled {
+		conn, err = dm.pooledConn(ctx, schema)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		pool := dm.SqlDB
+		if replica != nil {
+			pool = replica
+		}
+		// Get a dedicated connection from pool
+		c, err := pool.Conn(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get conn: %w", err)
+		}
+		conn = &Conn{Conn: c}
 	}
 	defer func() {
 		if conn != nil {
@@ -76,33 +133,21 @@ func (dm *DatabaseManager) GetDB(ctx context.Context, schema string) (*gorm.DB,
 		}
 	}()
 
-	// Switch schema
-	if _, err := conn.ExecContext(ctx, "USE `"+schema+"`"); err != nil {
-		conn.Close()
-		return nil, nil, fmt.Errorf("failed to use schema %s: %w", schema, err)
+	// Switch schema; tenant pools are already connected to it.
+	if !pooled {
+		if _, err := conn.ExecContext(ctx, "USE `"+schema+"`"); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("failed to use schema %s: %w", schema, err)
+		}
 	}
 
 	// Wrap this single connection into GORM
 	dialector := mysql.New(mysql.Config{
-		Conn: conn, // lock GORM to this connection
+		Conn:                      conn.Conn, // lock GORM to this connection
+		SkipInitializeWithVersion: pooled,
 	})
-	// Map local LogLevel to GORM LogLevel
-	gormLogLevel := logger.Silent
-	switch dm.LogLevel {
-	case LogLevelError:
-		gormLogLevel = logger.Error
-	case LogLevelWarn:
-		gormLogLevel = logger.Warn
-	case LogLevelInfo:
-		gormLogLevel = logger.Info
-	case LogLevelSilent:
-		gormLogLevel = logger.Silent
-	default:
-		gormLogLevel = logger.Info
-	}
-
 	db, err := gorm.Open(dialector, &gorm.Config{
-		Logger: logger.Default.LogMode(gormLogLevel),
+		Logger: logger.Default.LogMode(dm.gormLogLevel()),
 	})
 	if err != nil {
 		conn.Close()
@@ -114,12 +159,45 @@ func (dm *DatabaseManager) GetDB(ctx context.Context, schema string) (*gorm.DB,
 	return db, conn, nil
 }
 
-// Close closes the global pool
+// gormLogLevel maps the local LogLevel to GORM's.
+func (dm *DatabaseManager) gormLogLevel() logger.LogLevel {
+	switch dm.LogLevel {
+	case LogLevelError:
+		return logger.Error
+	case LogLevelWarn:
+		return logger.Warn
+	case LogLevelInfo:
+		return logger.Info
+	case LogLevelSilent:
+		return logger.Silent
+	default:
+		return logger.Info
+	}
+}
+
+// Close closes the global pool and any tenant pools.
 func (dm *DatabaseManager) Close() error {
+	if dm.pools != nil {
+		dm.pools.close()
+	}
+	if dm.replica != nil {
+		dm.replica.Close()
+	}
 	return dm.SqlDB.Close()
 }
 
+// Exec runs fn against the tenant's schema. With tenant pools fn gets the
+// tenant's shared pool; otherwise a dedicated connection that is closed when
+// fn returns.
 func (dm *DatabaseManager) Exec(ctx context.Context, schema string, fn func(db *gorm.DB) error) error {
+	if dm.pools != nil {
+		tenant, err := dm.ResolveTenant(ctx, schema)
+		if err != nil {
+			return fmt.Errorf("%s: %w", schema, err)
+		}
+		return dm.pooledExec(ctx, tenant, fn)
+	}
+
 	db, conn, err := dm.GetDB(ctx, schema)
 	if err != nil {
 		return err
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TenantFunc does one tenant's share of a fan-out job. ctx carries the
+// per-tenant timeout; db is already on the tenant's schema. The returned
+// payload ends up in TenantResult.Payload.
+type TenantFunc func(ctx context.Context, tenant string, db *gorm.DB) (any, error)
+
+// TenantResult is the outcome of a TenantFunc for one tenant.
+type TenantResult struct {
+	Tenant   string        `json:"tenant"`
+	Duration time.Duration `json:"duration"`
+	Err      error         `json:"-"`
+	Error    string        `json:"error,omitempty"`
+	Payload  any           `json:"payload,omitempty"`
+}
+
+// ForEachTenant runs fn against every tenant, at most concurrency at a time,
+// and returns one result per tenant in the order given. Each tenant gets
+// timeout (zero for no limit); a failing or slow tenant doesn't stop the
+// others. Cancelling ctx stops new tenants from starting; those are reported
+// with ctx's error.
+func (dm *DatabaseManager) ForEachTenant(ctx context.Context, tenants []string, concurrency int, timeout time.Duration, fn TenantFunc) []TenantResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]TenantResult, len(tenants))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, tenant := range tenants {
+		results[i].Tenant = tenant
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			results[i].Error = ctx.Err().Error()
+			continue
+		}
+
+		wg.Add(1)
+		go func(result *TenantResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			dm.runTenant(ctx, result, timeout, fn)
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+func (dm *DatabaseManager) runTenant(ctx context.Context, result *TenantResult, timeout time.Duration, fn TenantFunc) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := dm.Exec(ctx, result.Tenant, func(db *gorm.DB) error {
+		payload, err := fn(ctx, result.Tenant, db.WithContext(ctx))
+		result.Payload = payload
+		return err
+	})
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Err = err
+		result.Error = err.Error()
+	}
+}
@@ -0,0 +1,40 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestForEachTenantSlowTenant(t *testing.T) {
+	dm := newTestPools()
+	dm.pools.maxPools = 4
+	defer dm.pools.close()
+
+	var mu sync.Mutex
+	var finished []string
+	results := dm.ForEachTenant(context.Background(), []string{"slow", "alpha", "beta", "gamma"}, 2, 200*time.Millisecond,
+		func(ctx context.Context, tenant string, db *gorm.DB) (any, error) {
+			if tenant == "slow" {
+				<-ctx.Done()
+			}
+			mu.Lock()
+			finished = append(finished, tenant)
+			mu.Unlock()
+			return tenant, ctx.Err()
+		})
+
+	require.Len(t, results, 4)
+	assert.ErrorIs(t, results[0].Err, context.DeadlineExceeded)
+	for _, result := range results[1:] {
+		assert.NoError(t, result.Err, result.Tenant)
+		assert.Equal(t, result.Tenant, result.Payload)
+	}
+	// The others share the second slot while slow holds the first.
+	assert.Equal(t, []string{"alpha", "beta", "gamma", "slow"}, finished)
+}
@@ -0,0 +1,342 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// Migration is one numbered schema change, read from a pair of files
+// `NNN_name.up.sql` / `NNN_name.down.sql`.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaMigration records an applied migration in the tenant's
+// `schema_migrations` table.
+type SchemaMigration struct {
+	Version   int       `gorm:"column:version;primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"column:name;type:varchar(255);not null"`
+	AppliedAt time.Time `gorm:"column:applied_at;type:datetime;not null"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationStatus is one migration as seen from a tenant.
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// LoadMigrations reads the migrations in the root of fsys, ordered by version.
+// Every version needs an up file; a missing down file only fails at rollback.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		m := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(m[1])
+		data, err := fs.ReadFile(fsys, path.Clean(entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		} else if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if strings.TrimSpace(migration.Up) == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// ErrMigrationLocked means another run holds the schema's migration lock.
+var ErrMigrationLocked = errors.New("another migration is running on this schema")
+
+// MigrationRunner applies Migrations to one tenant schema at a time. MySQL
+// DDL is not transactional, so each statement is committed as it runs and a
+// failed migration is not recorded. Migrations are written to be rerun once
+// the failure is fixed: tables are created IF NOT EXISTS, seeds ignore
+// existing rows, and an up statement adding a column or index that already
+// exists is skipped. Up, Down and Baseline hold a per-schema lock, so two runs
+// can't apply the same migrations at once.
+type MigrationRunner struct {
+	Migrations []Migration
+	// DryRun prints the SQL that would run instead of running it.
+	DryRun bool
+	// Logf reports progress; nil is silent.
+	Logf func(format string, args ...any)
+}
+
+func (r *MigrationRunner) logf(format string, args ...any) {
+	if r.Logf != nil {
+		r.Logf(format, args...)
+	}
+}
+
+// Status lists every migration with when it was applied (nil when pending).
+func (r *MigrationRunner) Status(db *gorm.DB) ([]MigrationStatus, error) {
+	applied, err := r.applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(r.Migrations))
+	for _, m := range r.Migrations {
+		s := MigrationStatus{Version: m.Version, Name: m.Name}
+		if record, ok := applied[m.Version]; ok {
+			s.AppliedAt = &record.AppliedAt
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// Up applies the pending migrations up to and including version `to` (0 for
+// all), in order, and returns the versions applied.
+func (r *MigrationRunner) Up(db *gorm.DB, to int) ([]int, error) {
+	var done []int
+	err := r.locked(db, func(db *gorm.DB) error {
+		var err error
+		done, err = r.forward(db, to, true)
+		return err
+	})
+	return done, err
+}
+
+// Baseline records the migrations up to `to` as applied without running them,
+// for schemas that were changed by hand before the runner existed.
+func (r *MigrationRunner) Baseline(db *gorm.DB, to int) ([]int, error) {
+	if to <= 0 {
+		return nil, fmt.Errorf("baseline needs a version")
+	}
+	var done []int
+	err := r.locked(db, func(db *gorm.DB) error {
+		var err error
+		done, err = r.forward(db, to, false)
+		return err
+	})
+	return done, err
+}
+
+func (r *MigrationRunner) forward(db *gorm.DB, to int, run bool) ([]int, error) {
+	applied, err := r.applied(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.ensureTable(db); err != nil {
+		return nil, err
+	}
+
+	var done []int
+	for _, m := range r.Migrations {
+		if to > 0 && m.Version > to {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if run {
+			if err := r.exec(db, m.Version, m.Name, "up", m.Up); err != nil {
+				return done, err
+			}
+		} else {
+			r.logf("baseline %03d_%s", m.Version, m.Name)
+		}
+		if !r.DryRun {
+			record := SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}
+			if err := db.Create(&record).Error; err != nil {
+				return done, fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+			}
+		}
+		done = append(done, m.Version)
+	}
+	return done, nil
+}
+
+// Down rolls back the last `steps` applied migrations, newest first, and
+// returns the versions rolled back.
+func (r *MigrationRunner) Down(db *gorm.DB, steps int) ([]int, error) {
+	var done []int
+	err := r.locked(db, func(db *gorm.DB) error {
+		var err error
+		done, err = r.backward(db, steps)
+		return err
+	})
+	return done, err
+}
+
+func (r *MigrationRunner) backward(db *gorm.DB, steps int) ([]int, error) {
+	applied, err := r.applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	for i := len(r.Migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := r.Migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			return done, fmt.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+		}
+		if err := r.exec(db, m.Version, m.Name, "down", m.Down); err != nil {
+			return done, err
+		}
+		if !r.DryRun {
+			if err := db.Where("version = ?", m.Version).Delete(&SchemaMigration{}).Error; err != nil {
+				return done, fmt.Errorf("failed to unrecord migration %d: %w", m.Version, err)
+			}
+		}
+		done = append(done, m.Version)
+	}
+	return done, nil
+}
+
+func (r *MigrationRunner) exec(db *gorm.DB, version int, name, direction, script string) error {
+	r.logf("%s %03d_%s", direction, version, name)
+	for _, stmt := range SplitStatements(script) {
+		if r.DryRun {
+			r.logf("  %s;", stmt)
+			continue
+		}
+		if err := db.Exec(stmt).Error; err != nil {
+			if direction == "up" && alreadyApplied(err) {
+				r.logf("  skipped, already applied: %v", err)
+				continue
+			}
+			return fmt.Errorf("migration %03d_%s %s failed: %w", version, name, direction, err)
+		}
+	}
+	return nil
+}
+
+// alreadyApplied reports whether err is MySQL refusing to add a column (1060)
+// or index (1061) that exists: the statement ran before and its migration is
+// being rerun.
+func alreadyApplied(err error) bool {
+	var mysqlErr *mysqldriver.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	return mysqlErr.Number == 1060 || mysqlErr.Number == 1061
+}
+
+// locked runs fn on a single connection holding the schema's migration lock
+// (GET_LOCK is per connection). It fails with ErrMigrationLocked rather than
+// wait for another run. Dry runs change nothing and take no lock.
+func (r *MigrationRunner) locked(db *gorm.DB, fn func(db *gorm.DB) error) error {
+	if r.DryRun {
+		return fn(db)
+	}
+	return db.Connection(func(conn *gorm.DB) error {
+		var got sql.NullInt64
+		if err := conn.Raw("SELECT GET_LOCK(" + migrationLock + ", 0)").Row().Scan(&got); err != nil {
+			return fmt.Errorf("failed to take the migration lock: %w", err)
+		}
+		if got.Int64 != 1 {
+			return ErrMigrationLocked
+		}
+		defer conn.Exec("SELECT RELEASE_LOCK(" + migrationLock + ")")
+		return fn(conn)
+	})
+}
+
+// migrationLock names the schema's lock; hashed, as lock names are limited to
+// 64 characters.
+const migrationLock = "CONCAT('migrate:', MD5(DATABASE()))"
+
+func (r *MigrationRunner) applied(db *gorm.DB) (map[int]SchemaMigration, error) {
+	applied := make(map[int]SchemaMigration)
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return applied, nil
+	}
+
+	var records []SchemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+func (r *MigrationRunner) ensureTable(db *gorm.DB) error {
+	if r.DryRun {
+		return nil
+	}
+	return db.Exec("CREATE TABLE IF NOT EXISTS `schema_migrations` (" +
+		"`version` INT NOT NULL, " +
+		"`name` VARCHAR(255) NOT NULL, " +
+		"`applied_at` DATETIME NOT NULL, " +
+		"PRIMARY KEY (`version`))").Error
+}
+
+// SplitStatements splits a migration script into statements on the `;` that
+// ends a line, dropping `--` comment lines. Scripts must not contain stored
+// routines or semicolons inside string literals at end of line.
+func SplitStatements(script string) []string {
+	var stmts []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if stmt := strings.TrimSuffix(strings.TrimSpace(current.String()), ";"); stmt != "" {
+				stmts = append(stmts, stmt)
+			}
+			current.Reset()
+		}
+	}
+	if stmt := strings.TrimSpace(current.String()); stmt != "" {
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
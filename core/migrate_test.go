@@ -0,0 +1,30 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlreadyApplied(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"duplicate column", &mysqldriver.MySQLError{Number: 1060, Message: "Duplicate column name 'gap'"}, true},
+		{"duplicate index", &mysqldriver.MySQLError{Number: 1061, Message: "Duplicate key name 'idx'"}, true},
+		{"wrapped", fmt.Errorf("exec: %w", &mysqldriver.MySQLError{Number: 1060}), true},
+		{"syntax error", &mysqldriver.MySQLError{Number: 1064}, false},
+		{"duplicate entry", &mysqldriver.MySQLError{Number: 1062}, false},
+		{"other error", errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, alreadyApplied(tt.err))
+		})
+	}
+}
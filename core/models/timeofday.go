@@ -0,0 +1,75 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TimeOfDay is a MySQL TIME column used as a wall-clock time ("07:30:00"),
+// stored as the offset from midnight. The model generator maps `time` columns
+// to it instead of string.
+type TimeOfDay time.Duration
+
+// ParseTimeOfDay accepts "15:04:05" or "15:04".
+func ParseTimeOfDay(s string) (TimeOfDay, error) {
+	var h, m, sec int
+	if n, _ := fmt.Sscanf(s, "%d:%d:%d", &h, &m, &sec); n < 2 {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	if h < 0 || h > 838 || m < 0 || m > 59 || sec < 0 || sec > 59 {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return TimeOfDay(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second), nil
+}
+
+// String formats as "15:04:05", the MySQL TIME literal.
+func (t TimeOfDay) String() string {
+	d := time.Duration(t)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
+
+// On returns the time of day on date's calendar day, in date's location.
+func (t TimeOfDay) On(date time.Time) time.Time {
+	y, m, d := date.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, date.Location()).Add(time.Duration(t))
+}
+
+func (t *TimeOfDay) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
+	case time.Time:
+		*t = TimeOfDay(time.Duration(v.Hour())*time.Hour + time.Duration(v.Minute())*time.Minute + time.Duration(v.Second())*time.Second)
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into TimeOfDay", src)
+}
+
+func (t *TimeOfDay) parse(s string) error {
+	parsed, err := ParseTimeOfDay(s)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+func (t TimeOfDay) Value() (driver.Value, error) {
+	return t.String(), nil
+}
+
+func (t TimeOfDay) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *TimeOfDay) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return t.parse(s)
+}
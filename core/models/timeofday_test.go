@@ -0,0 +1,41 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeOfDay(t *testing.T) {
+	var tod TimeOfDay
+	require.NoError(t, tod.Scan([]byte("07:30:00")))
+	assert.Equal(t, TimeOfDay(7*time.Hour+30*time.Minute), tod)
+	assert.Equal(t, "07:30:00", tod.String())
+
+	v, err := tod.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "07:30:00", v)
+
+	short, err := ParseTimeOfDay("17:45")
+	require.NoError(t, err)
+	assert.Equal(t, "17:45:00", short.String())
+
+	_, err = ParseTimeOfDay("7.30")
+	assert.Error(t, err)
+	_, err = ParseTimeOfDay("12:75")
+	assert.Error(t, err)
+
+	date := time.Date(2026, 1, 10, 23, 59, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 1, 10, 7, 30, 0, 0, time.UTC), tod.On(date))
+
+	data, err := json.Marshal(struct{ Start TimeOfDay }{tod})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"Start":"07:30:00"}`, string(data))
+
+	var decoded struct{ Start TimeOfDay }
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, tod, decoded.Start)
+}
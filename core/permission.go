@@ -0,0 +1,84 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"axiapac.com/axiapac/core/models"
+	"gorm.io/gorm"
+)
+
+// AccessLevel is RolePermissions.AccessLevel. Levels are ordered: a higher
+// level implies every lower one.
+type AccessLevel int32
+
+const (
+	AccessNone  AccessLevel = 0
+	AccessRead  AccessLevel = 1
+	AccessWrite AccessLevel = 2
+	AccessFull  AccessLevel = 3
+)
+
+func (l AccessLevel) String() string {
+	switch l {
+	case AccessNone:
+		return "none"
+	case AccessRead:
+		return "read"
+	case AccessWrite:
+		return "write"
+	case AccessFull:
+		return "full"
+	}
+	return fmt.Sprintf("level %d", int32(l))
+}
+
+var ErrUserNotFound = errors.New("user not found")
+
+// UserPermissions is a user's effective access: the highest AccessLevel per
+// module across all of the user's roles. SysAdmin users are allowed everything.
+type UserPermissions struct {
+	UserID   int32
+	SysAdmin bool
+	Modules  map[string]AccessLevel
+}
+
+// Allows reports whether the user has at least `level` on `module`.
+func (p *UserPermissions) Allows(module string, level AccessLevel) bool {
+	if p.SysAdmin {
+		return true
+	}
+	return p.Modules[module] >= level
+}
+
+// LoadUserPermissions resolves user -> UserRoles -> RolePermissions.
+func LoadUserPermissions(db *gorm.DB, userID int32) (*UserPermissions, error) {
+	var user models.User
+	if err := db.Select("Id", "SysAdmin").Where("Id = ?", userID).Take(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	var perms []models.RolePermission
+	if err := db.Model(&models.RolePermission{}).
+		Joins("JOIN UserRoles ur ON ur.RoleId = RolePermissions.RoleId").
+		Where("ur.UserId = ?", userID).
+		Find(&perms).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch role permissions: %w", err)
+	}
+
+	modules := make(map[string]AccessLevel)
+	for _, p := range perms {
+		if level := AccessLevel(p.AccessLevel); level > modules[p.Module] {
+			modules[p.Module] = level
+		}
+	}
+
+	return &UserPermissions{
+		UserID:   user.ID,
+		SysAdmin: user.SysAdmin,
+		Modules:  modules,
+	}, nil
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TenantDB is the tenant database access handlers need. *DatabaseManager
+// implements it; tests can swap in a fake.
+type TenantDB interface {
+	// Exec runs fn on the primary.
+	Exec(ctx context.Context, host string, fn func(db *gorm.DB) error) error
+	// ExecRead runs fn on the read replica when there is one.
+	ExecRead(ctx context.Context, host string, fn func(db *gorm.DB) error) error
+}
+
+type primaryKey struct{}
+
+// WithPrimary makes reads under ctx go to the primary, so a request sees its
+// own (or a just-finished request's) writes despite replica lag.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func readsFromPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// AddReplica routes ReadDB and ExecRead to a read replica. dsn should NOT
+// include a schema, like the primary's.
+func (dm *DatabaseManager) AddReplica(dsn string, maxConnection int) error {
+	sqlDB, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return fmt.Errorf("failed to open replica pool: %w", err)
+	}
+
+	sqlDB.SetMaxOpenConns(maxConnection)
+	sqlDB.SetMaxIdleConns(maxConnection)
+	sqlDB.SetConnMaxLifetime(5 * time.Minute)
+
+	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
+		return fmt.Errorf("failed to ping replica pool: %w", err)
+	}
+
+	dm.replica = sqlDB
+	return nil
+}
+
+// ReadDB is GetDB for reads: it uses the replica when one is configured and
+// ctx isn't pinned to the primary with WithPrimary.
+func (dm *DatabaseManager) ReadDB(ctx context.Context, host string) (*gorm.DB, *Conn, error) {
+	if dm.replica == nil || readsFromPrimary(ctx) {
+		return dm.GetDB(ctx, host)
+	}
+	return dm.getDB(ctx, host, dm.replica)
+}
+
+// WriteDB is GetDB; it names the intent at call sites that also use ReadDB.
+func (dm *DatabaseManager) WriteDB(ctx context.Context, host string) (*gorm.DB, *Conn, error) {
+	return dm.GetDB(ctx, host)
+}
+
+// ExecRead is Exec on ReadDB.
+func (dm *DatabaseManager) ExecRead(ctx context.Context, host string, fn func(db *gorm.DB) error) error {
+	if dm.replica == nil || readsFromPrimary(ctx) {
+		return dm.Exec(ctx, host, fn)
+	}
+
+	db, conn, err := dm.ReadDB(ctx, host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return fn(db)
+}
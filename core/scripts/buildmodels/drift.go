@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// model is one generated *.gen.go file, keyed by its table.
+type model struct {
+	File    string
+	Table   string
+	Columns map[string]column
+}
+
+type column struct {
+	Field   string
+	GoType  string
+	NotNull bool
+}
+
+// loadModels reads the generated model files in dir, keyed by table name.
+func loadModels(dir string) (map[string]model, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.gen.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	models := make(map[string]model)
+	fset := token.NewFileSet()
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(fset, path, src, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		m := model{File: filepath.Base(path), Columns: make(map[string]column)}
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				switch s := spec.(type) {
+				case *ast.ValueSpec:
+					if len(s.Names) == 1 && strings.HasPrefix(s.Names[0].Name, "TableName") && len(s.Values) == 1 {
+						if lit, ok := s.Values[0].(*ast.BasicLit); ok {
+							m.Table, _ = strconv.Unquote(lit.Value)
+						}
+					}
+				case *ast.TypeSpec:
+					st, ok := s.Type.(*ast.StructType)
+					if !ok {
+						continue
+					}
+					for _, field := range st.Fields.List {
+						if field.Tag == nil || len(field.Names) == 0 {
+							continue
+						}
+						tag, _ := strconv.Unquote(field.Tag.Value)
+						name, notNull := parseGormTag(reflect.StructTag(tag).Get("gorm"))
+						if name == "" {
+							continue
+						}
+						m.Columns[name] = column{
+							Field:   field.Names[0].Name,
+							GoType:  types.ExprString(field.Type),
+							NotNull: notNull,
+						}
+					}
+				}
+			}
+		}
+		if m.Table != "" {
+			models[m.Table] = m
+		}
+	}
+	return models, nil
+}
+
+func parseGormTag(tag string) (name string, notNull bool) {
+	for _, part := range strings.Split(tag, ";") {
+		switch {
+		case strings.HasPrefix(part, "column:"):
+			name = strings.TrimPrefix(part, "column:")
+		case part == "not null", part == "primaryKey":
+			notNull = true
+		}
+	}
+	return name, notNull
+}
+
+// diffModels describes how the generated models differ from the committed
+// ones, one line per added, removed or changed table or column.
+func diffModels(before, after map[string]model) []string {
+	var lines []string
+	for _, table := range sortedKeys(before, after) {
+		old, hadOld := before[table]
+		cur, hasCur := after[table]
+		switch {
+		case !hadOld:
+			lines = append(lines, fmt.Sprintf("+ table %s (%d columns)", table, len(cur.Columns)))
+			continue
+		case !hasCur:
+			lines = append(lines, fmt.Sprintf("- table %s", table))
+			continue
+		}
+
+		for _, name := range sortedKeys(old.Columns, cur.Columns) {
+			o, hadCol := old.Columns[name]
+			n, hasCol := cur.Columns[name]
+			switch {
+			case !hadCol:
+				lines = append(lines, fmt.Sprintf("+ %s.%s %s%s", table, name, n.GoType, nullability(n)))
+			case !hasCol:
+				lines = append(lines, fmt.Sprintf("- %s.%s", table, name))
+			case o.GoType != n.GoType || o.NotNull != n.NotNull:
+				lines = append(lines, fmt.Sprintf("~ %s.%s %s%s -> %s%s", table, name, o.GoType, nullability(o), n.GoType, nullability(n)))
+			}
+		}
+	}
+	return lines
+}
+
+func nullability(c column) string {
+	if c.NotNull {
+		return " not null"
+	}
+	return ""
+}
+
+func sortedKeys[V any](a, b map[string]V) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		seen[k] = true
+	}
+	for k := range b {
+		seen[k] = true
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,33 +1,96 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
 	"gorm.io/driver/mysql"
 	"gorm.io/gen"
 	"gorm.io/gorm"
 )
 
 func main() {
+	dsn := flag.String("dsn", "root:development@tcp(localhost:3306)/Axiapac?parseTime=true", "database to generate from")
+	out := flag.String("out", "../../models", "committed models directory")
+	check := flag.Bool("check", false, "report drift against the committed models without writing; exit 1 on drift")
+	flag.Parse()
+
+	gormdb, err := gorm.Open(mysql.Open(*dsn))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Generate into a scratch directory first so the output can be compared
+	// with what is committed before anything is overwritten.
+	tmp, err := os.MkdirTemp("", "buildmodels")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	generated := filepath.Join(tmp, "models")
+
 	g := gen.NewGenerator(gen.Config{
-		OutPath:      "../../models",
+		OutPath:      generated,
 		ModelPkgPath: "models",                                                           // avoid helper functions
 		Mode:         gen.WithoutContext | gen.WithDefaultQuery | gen.WithQueryInterface, // generate mode
+		// Nullable columns become pointers so NULL is distinguishable from
+		// the zero value.
+		FieldNullable:    true,
+		FieldWithTypeTag: true,
 	})
 
 	g.WithDataTypeMap(map[string]func(gorm.ColumnType) (dataType string){
 		"time": func(gorm.ColumnType) string {
-			return "string"
+			return "TimeOfDay"
 		},
 		"decimal": func(gorm.ColumnType) string {
 			return "float64"
 		},
 	})
 
-	gormdb, _ := gorm.Open(mysql.Open("root:development@tcp(localhost:3306)/Axiapac?parseTime=true"))
 	g.UseDB(gormdb)
-
 	g.GenerateAllTable()
-	g.ApplyBasic()
 
 	// Generate the code
 	g.Execute()
+
+	before, err := loadModels(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	after, err := loadModels(generated)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	drift := diffModels(before, after)
+	for _, line := range drift {
+		fmt.Println(line)
+	}
+	fmt.Printf("%d changes against %s\n", len(drift), *out)
+
+	if *check {
+		if len(drift) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	for _, m := range after {
+		data, err := os.ReadFile(filepath.Join(generated, m.File))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(*out, m.File), data, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for table, m := range before {
+		if _, ok := after[table]; !ok {
+			fmt.Printf("%s is no longer in the database; delete %s by hand if that is intended\n", table, m.File)
+		}
+	}
 }
@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"sync"
+	"time"
 
 	"axiapac.com/axiapac/core"
 	"gorm.io/gorm"
@@ -98,30 +98,25 @@ func main() {
 	ctx := context.Background()
 
 	numCalls := 10 // number of times to call CheckCode per case
-	var wg sync.WaitGroup
-	// resultsCh := make(chan CheckResult, len(cases)*numCalls)
+	sites := make([]string, 0, len(cases)*numCalls)
+	codes := make(map[string]string, len(cases))
 	for _, tc := range cases {
+		codes[tc.Site] = tc.Code
 		for i := 0; i < numCalls; i++ {
-			wg.Add(1)
-			tc := tc   // capture loop variable
-			index := i // capture loop variable
-			go func() {
-				defer wg.Done()
-				code, err := CheckCode2(ctx, dm, tc.Site, tc.Code)
-				// resultsCh <- CheckResult{
-				// 	Site:  tc.Site,
-				// 	Index: index,
-				// 	Err:   err,
-				// }
-				if err != nil {
-					fmt.Printf("[ERROR]  site[%d] %s: %v\n", index, tc.Site, err)
-				} else {
-					fmt.Printf("site[%d] %s, %s\n", index, tc.Site, code)
-				}
-			}()
+			sites = append(sites, tc.Site)
+		}
+	}
+
+	results := dm.ForEachTenant(ctx, sites, 20, 30*time.Second, func(ctx context.Context, site string, db *gorm.DB) (any, error) {
+		return CheckCode3(db, site, codes[site])
+	})
+	for index, result := range results {
+		if result.Err != nil {
+			fmt.Printf("[ERROR]  site[%d] %s: %v (%s)\n", index, result.Tenant, result.Err, result.Duration)
+		} else {
+			fmt.Printf("site[%d] %s, %s (%s)\n", index, result.Tenant, result.Payload, result.Duration)
 		}
 	}
-	wg.Wait()
 }
 
 type CheckResult struct {
@@ -171,3 +166,17 @@ func CheckCode2(ctx context.Context, dm *core.DatabaseManager, site string, code
 
 	return c, err
 }
+
+func CheckCode3(db *gorm.DB, site string, code string) (string, error) {
+	var result struct {
+		Code string
+	}
+	if err := db.Raw("SELECT Code FROM entity LIMIT 1").Scan(&result).Error; err != nil {
+		return "", err
+	}
+	// Compare expected
+	if result.Code != code {
+		return "", fmt.Errorf("unexpected code for site %s, expected %s, got %s", site, code, result.Code)
+	}
+	return result.Code, nil
+}
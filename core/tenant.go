@@ -0,0 +1,46 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"regexp"
+)
+
+var (
+	// ErrTenantNotFound means the host does not name a provisioned tenant.
+	ErrTenantNotFound = errors.New("tenant not found")
+	// ErrTenantInactive means the tenant exists but its subscription is
+	// deactivated or expired.
+	ErrTenantInactive = errors.New("tenant subscription is inactive")
+)
+
+// TenantResolver maps a request hostname (or a bare tenant name) to the schema
+// to `USE`, rejecting hosts that are not active tenants.
+type TenantResolver interface {
+	ResolveTenant(ctx context.Context, host string) (string, error)
+}
+
+var schemaName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// ResolveTenant returns the schema for host. With a Tenants resolver set the
+// host must belong to an active subscription; without one (local dev) the
+// schema is taken from the host as is. System schemas and names that are not
+// plain identifiers are always rejected.
+func (dm *DatabaseManager) ResolveTenant(ctx context.Context, host string) (string, error) {
+	schema := TenantFromHost(host)
+	if dm.Tenants != nil {
+		var err error
+		if schema, err = dm.Tenants.ResolveTenant(ctx, host); err != nil {
+			return "", err
+		}
+	}
+
+	if !schemaName.MatchString(schema) {
+		return "", ErrTenantNotFound
+	}
+	switch schema {
+	case "information_schema", "mysql", "performance_schema", "sys":
+		return "", ErrTenantNotFound
+	}
+	return schema, nil
+}
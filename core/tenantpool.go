@@ -0,0 +1,249 @@
+package core
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ErrTenantPoolsBusy is returned when a new tenant needs a pool, the global
+// limit is reached, and no open pool fell idle before the context was done.
+var ErrTenantPoolsBusy = errors.New("all tenant pools are busy")
+
+// PoolOptions configures per-tenant pools (see NewWithTenantPools).
+type PoolOptions struct {
+	// MaxConnsPerTenant caps the open connections of one tenant's pool.
+	MaxConnsPerTenant int
+	// MaxConns caps the connections across all tenant pools. At most
+	// MaxConns/MaxConnsPerTenant pools are open at once; the least recently
+	// used idle pool is closed to make room for a new tenant.
+	MaxConns int
+}
+
+// TenantPoolStats reports one tenant pool.
+type TenantPoolStats struct {
+	Tenant   string    `json:"tenant"`
+	Leases   int       `json:"leases"` // Exec calls running and GetDB conns open
+	LastUsed time.Time `json:"lastUsed"`
+
+	OpenConnections int           `json:"openConnections"`
+	InUse           int           `json:"inUse"`
+	Idle            int           `json:"idle"`
+	WaitCount       int64         `json:"waitCount"`
+	WaitDuration    time.Duration `json:"waitDuration"`
+}
+
+type tenantPool struct {
+	schema   string
+	sqlDB    *sql.DB
+	db       *gorm.DB
+	leases   int
+	lastUsed time.Time
+	elem     *list.Element
+}
+
+type tenantPools struct {
+	cfg      *mysqldriver.Config
+	driver   string // "mysql"; tests register a fake
+	perPool  int
+	maxPools int
+	logLevel logger.LogLevel
+
+	mu    sync.Mutex
+	pools map[string]*tenantPool
+	lru   *list.List    // of *tenantPool, most recently used first
+	idle  chan struct{} // closed, and replaced, when a pool's last lease ends
+}
+
+// NewWithTenantPools creates a DatabaseManager that keeps a lazily opened pool
+// per tenant schema, connected straight to that schema, instead of running
+// `USE schema` on a shared pool for every GetDB. dsn should NOT include a
+// schema. SqlDB is still opened, with two connections, for server-wide
+// queries such as GetAllDatabases.
+func NewWithTenantPools(dsn string, opts PoolOptions) (*DatabaseManager, error) {
+	if opts.MaxConnsPerTenant <= 0 || opts.MaxConns < opts.MaxConnsPerTenant {
+		return nil, fmt.Errorf("invalid pool options: %d per tenant, %d total", opts.MaxConnsPerTenant, opts.MaxConns)
+	}
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dsn: %w", err)
+	}
+
+	dm, err := New(dsn, 2)
+	if err != nil {
+		return nil, err
+	}
+	dm.pools = &tenantPools{
+		cfg:      cfg,
+		driver:   "mysql",
+		perPool:  opts.MaxConnsPerTenant,
+		maxPools: opts.MaxConns / opts.MaxConnsPerTenant,
+		pools:    make(map[string]*tenantPool),
+		lru:      list.New(),
+		idle:     make(chan struct{}),
+	}
+	return dm, nil
+}
+
+// acquire returns the schema's pool, opening it (and evicting the least
+// recently used idle pool) when needed. While every pool is in use it waits
+// for one to fall idle, until ctx is done. Callers must release it.
+func (tp *tenantPools) acquire(ctx context.Context, schema string, logLevel logger.LogLevel) (*tenantPool, error) {
+	for {
+		tp.mu.Lock()
+		if p, ok := tp.pools[schema]; ok {
+			p.leases++
+			p.lastUsed = time.Now()
+			tp.lru.MoveToFront(p.elem)
+			tp.mu.Unlock()
+			return p, nil
+		}
+		if len(tp.pools) < tp.maxPools || tp.evictIdle() {
+			p, err := tp.open(schema, logLevel)
+			tp.mu.Unlock()
+			return p, err
+		}
+		idle := tp.idle
+		tp.mu.Unlock()
+
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", ErrTenantPoolsBusy, ctx.Err())
+		}
+	}
+}
+
+// open adds a leased pool for schema; tp.mu must be held.
+func (tp *tenantPools) open(schema string, logLevel logger.LogLevel) (*tenantPool, error) {
+	cfg := tp.cfg.Clone()
+	cfg.DBName = schema
+	sqlDB, err := sql.Open(tp.driver, cfg.FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pool for %s: %w", schema, err)
+	}
+	sqlDB.SetMaxOpenConns(tp.perPool)
+	sqlDB.SetMaxIdleConns(tp.perPool)
+	sqlDB.SetConnMaxLifetime(5 * time.Minute)
+
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		Logger: logger.Default.LogMode(logLevel),
+	})
+	if err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to open gorm for %s: %w", schema, err)
+	}
+
+	p := &tenantPool{schema: schema, sqlDB: sqlDB, db: db, leases: 1, lastUsed: time.Now()}
+	p.elem = tp.lru.PushFront(p)
+	tp.pools[schema] = p
+	return p, nil
+}
+
+func (tp *tenantPools) release(p *tenantPool) {
+	tp.mu.Lock()
+	p.leases--
+	if p.leases == 0 {
+		close(tp.idle)
+		tp.idle = make(chan struct{})
+	}
+	tp.mu.Unlock()
+}
+
+// evictIdle closes the least recently used pool with no running Exec and no
+// open GetDB conn.
+func (tp *tenantPools) evictIdle() bool {
+	for e := tp.lru.Back(); e != nil; e = e.Prev() {
+		p := e.Value.(*tenantPool)
+		if p.leases > 0 {
+			continue
+		}
+		tp.lru.Remove(e)
+		delete(tp.pools, p.schema)
+		p.sqlDB.Close()
+		return true
+	}
+	return false
+}
+
+func (tp *tenantPools) stats() []TenantPoolStats {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	stats := make([]TenantPoolStats, 0, tp.lru.Len())
+	for e := tp.lru.Front(); e != nil; e = e.Next() {
+		p := e.Value.(*tenantPool)
+		s := p.sqlDB.Stats()
+		stats = append(stats, TenantPoolStats{
+			Tenant:          p.schema,
+			Leases:          p.leases,
+			LastUsed:        p.lastUsed,
+			OpenConnections: s.OpenConnections,
+			InUse:           s.InUse,
+			Idle:            s.Idle,
+			WaitCount:       s.WaitCount,
+			WaitDuration:    s.WaitDuration,
+		})
+	}
+	return stats
+}
+
+func (tp *tenantPools) close() {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	for _, p := range tp.pools {
+		p.sqlDB.Close()
+	}
+	tp.pools = make(map[string]*tenantPool)
+	tp.lru.Init()
+}
+
+// TenantPoolStats reports every open tenant pool, most recently used first.
+// It returns nil when the manager was not created with NewWithTenantPools.
+func (dm *DatabaseManager) TenantPoolStats() []TenantPoolStats {
+	if dm.pools == nil {
+		return nil
+	}
+	return dm.pools.stats()
+}
+
+// pooledExec runs fn on the tenant's shared pool.
+func (dm *DatabaseManager) pooledExec(ctx context.Context, schema string, fn func(db *gorm.DB) error) error {
+	p, err := dm.pools.acquire(ctx, schema, dm.gormLogLevel())
+	if err != nil {
+		return err
+	}
+	defer dm.pools.release(p)
+
+	return fn(p.db.WithContext(ctx))
+}
+
+// pooledConn takes a dedicated connection from the tenant's pool; it is
+// already on the tenant's schema, so no `USE` is needed. The pool stays leased
+// until the conn is closed.
+func (dm *DatabaseManager) pooledConn(ctx context.Context, schema string) (*Conn, error) {
+	p, err := dm.pools.acquire(ctx, schema, dm.gormLogLevel())
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := p.sqlDB.Conn(ctx)
+	if err != nil {
+		dm.pools.release(p)
+		return nil, fmt.Errorf("failed to get conn: %w", err)
+	}
+	return &Conn{Conn: conn, release: func() { dm.pools.release(p) }}, nil
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/logger"
+)
+
+// fakeDriver hands out connections that can't run queries, which is all the
+// pool bookkeeping needs.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func init() {
+	sql.Register("tenantpooltest", fakeDriver{})
+}
+
+// newTestPools allows one tenant pool at a time.
+func newTestPools() *DatabaseManager {
+	return &DatabaseManager{
+		LogLevel: LogLevelSilent,
+		pools: &tenantPools{
+			cfg:      mysqldriver.NewConfig(),
+			driver:   "tenantpooltest",
+			perPool:  2,
+			maxPools: 1,
+			pools:    make(map[string]*tenantPool),
+			lru:      list.New(),
+			idle:     make(chan struct{}),
+		},
+	}
+}
+
+func TestTenantPoolsKeepPoolWithOpenConn(t *testing.T) {
+	dm := newTestPools()
+	defer dm.pools.close()
+
+	conn, err := dm.pooledConn(context.Background(), "alpha")
+	require.NoError(t, err)
+
+	// alpha's conn is still open, so beta can't take its place.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = dm.pools.acquire(ctx, "beta", logger.Silent)
+	assert.ErrorIs(t, err, ErrTenantPoolsBusy)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Len(t, dm.TenantPoolStats(), 1)
+	assert.Equal(t, 1, dm.TenantPoolStats()[0].Leases)
+
+	require.NoError(t, conn.Close())
+	assert.Error(t, conn.Close(), "a second close is an error")
+	assert.Equal(t, 0, dm.TenantPoolStats()[0].Leases, "the lease ends once")
+
+	p, err := dm.pools.acquire(context.Background(), "beta", logger.Silent)
+	require.NoError(t, err)
+	dm.pools.release(p)
+	stats := dm.TenantPoolStats()
+	require.Len(t, stats, 1)
+	assert.Equal(t, "beta", stats[0].Tenant)
+}
+
+func TestTenantPoolsWaitForIdlePool(t *testing.T) {
+	dm := newTestPools()
+	defer dm.pools.close()
+
+	alpha, err := dm.pools.acquire(context.Background(), "alpha", logger.Silent)
+	require.NoError(t, err)
+
+	// beta waits for alpha's lease to end rather than failing at once.
+	acquired := make(chan error, 1)
+	go func() {
+		p, err := dm.pools.acquire(context.Background(), "beta", logger.Silent)
+		if err == nil {
+			dm.pools.release(p)
+		}
+		acquired <- err
+	}()
+	select {
+	case err := <-acquired:
+		t.Fatalf("beta acquired while alpha was busy: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	dm.pools.release(alpha)
+	select {
+	case err := <-acquired:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("beta still waiting after alpha went idle")
+	}
+	stats := dm.TenantPoolStats()
+	require.Len(t, stats, 1)
+	assert.Equal(t, "beta", stats[0].Tenant)
+}
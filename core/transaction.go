@@ -0,0 +1,80 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+const (
+	// TransactionRetryBudget bounds the total time RetryTransaction spends on
+	// one transaction, attempts and backoff included.
+	TransactionRetryBudget = 10 * time.Second
+
+	retryBaseDelay = 25 * time.Millisecond
+	retryMaxDelay  = time.Second
+)
+
+// IsRetryable reports whether err is a MySQL deadlock (1213) or lock wait
+// timeout (1205). Both roll back the transaction, which is then safe to rerun.
+func IsRetryable(err error) bool {
+	var mysqlErr *mysqldriver.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	return mysqlErr.Number == 1213 || mysqlErr.Number == 1205
+}
+
+// RetryTransaction runs fn in a transaction on db and reruns the whole
+// transaction when it fails with a deadlock or lock wait timeout, waiting a
+// jittered, growing delay between attempts, until TransactionRetryBudget or
+// db's context runs out. fn must be safe to run more than once: reset anything
+// it accumulates outside the transaction at its start.
+//
+// db must not already be inside a transaction; MySQL rolls back the outer
+// transaction on deadlock, so retrying a savepoint would be wrong.
+func RetryTransaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return retry(ctx, TransactionRetryBudget, func() error { return db.Transaction(fn) })
+}
+
+// retry runs run until it returns nil or an error IsRetryable rejects, or
+// budget or ctx runs out.
+func retry(ctx context.Context, budget time.Duration, run func() error) error {
+	deadline := time.Now().Add(budget)
+	for attempt := 1; ; attempt++ {
+		err := run()
+		if err == nil || !IsRetryable(err) {
+			return err
+		}
+
+		// Full jitter: somewhere in [0, min(max, base*2^attempt)).
+		backoff := min(retryMaxDelay, retryBaseDelay<<attempt)
+		wait := rand.N(backoff)
+		if time.Now().Add(wait).After(deadline) {
+			return fmt.Errorf("transaction gave up after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return fmt.Errorf("transaction cancelled after %d attempts: %w", attempt, err)
+		}
+	}
+}
+
+// Transaction runs fn in a transaction on host's schema with RetryTransaction.
+// Use it for bulk writes that race with other writers (kiosk pushes).
+func (dm *DatabaseManager) Transaction(ctx context.Context, host string, fn func(tx *gorm.DB) error) error {
+	return dm.Exec(ctx, host, func(db *gorm.DB) error {
+		return RetryTransaction(db.WithContext(ctx), fn)
+	})
+}
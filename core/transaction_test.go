@@ -0,0 +1,87 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	errDeadlock    = &mysqldriver.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+	errLockTimeout = &mysqldriver.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"deadlock", errDeadlock, true},
+		{"lock wait timeout", errLockTimeout, true},
+		{"wrapped deadlock", fmt.Errorf("save timesheets: %w", errDeadlock), true},
+		{"duplicate key", &mysqldriver.MySQLError{Number: 1062}, false},
+		{"other error", errors.New("connection refused"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsRetryable(tt.err))
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	// failing returns errs in turn, then nil, counting the attempts.
+	failing := func(attempts *int, errs ...error) func() error {
+		return func() error {
+			*attempts++
+			if *attempts <= len(errs) {
+				return errs[*attempts-1]
+			}
+			return nil
+		}
+	}
+
+	t.Run("retries deadlocks and lock timeouts", func(t *testing.T) {
+		var attempts int
+		err := retry(context.Background(), time.Minute, failing(&attempts, errDeadlock, errLockTimeout))
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("other errors are returned at once", func(t *testing.T) {
+		var attempts int
+		other := errors.New("constraint failed")
+		err := retry(context.Background(), time.Minute, failing(&attempts, other))
+		assert.Same(t, other, err)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("gives up when the budget runs out", func(t *testing.T) {
+		var attempts int
+		err := retry(context.Background(), 0, failing(&attempts, errDeadlock, errDeadlock))
+		assert.ErrorIs(t, err, errDeadlock)
+		assert.ErrorContains(t, err, "gave up after 1 attempts")
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var attempts int
+		err := retry(ctx, time.Minute, func() error {
+			attempts++
+			return errDeadlock
+		})
+		assert.ErrorIs(t, err, errDeadlock)
+		assert.ErrorContains(t, err, "cancelled after")
+		// A zero jittered wait can win the race with Done once or twice.
+		assert.LessOrEqual(t, attempts, 3)
+	})
+}
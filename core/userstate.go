@@ -0,0 +1,128 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"axiapac.com/axiapac/core/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUserDeactivated      = errors.New("user is deactivated")
+	ErrUserLockedOut        = errors.New("user is locked out")
+	ErrSecurityStampChanged = errors.New("token has been revoked")
+)
+
+// UserState is the slice of Users that decides whether a user's tokens are
+// still good.
+type UserState struct {
+	SecurityStamp string
+	Deactivated   bool
+	// AccessLockoutAt is when the current lockout ends; the user is locked out
+	// until then.
+	AccessLockoutAt time.Time
+}
+
+// Validate checks a token's security stamp against the user's current state.
+// Rotating Users.SecurityStamp (password change, deactivation, "sign out
+// everywhere") therefore revokes every token issued before the rotation.
+func (s *UserState) Validate(tokenStamp string, now time.Time) error {
+	if s.Deactivated {
+		return ErrUserDeactivated
+	}
+	if now.Before(s.AccessLockoutAt) {
+		return ErrUserLockedOut
+	}
+	if tokenStamp != s.SecurityStamp {
+		return ErrSecurityStampChanged
+	}
+	return nil
+}
+
+type userStateEntry struct {
+	state    *UserState
+	loadedAt time.Time
+}
+
+// UserStateCache keeps UserState per tenant and user for a short TTL, so the
+// auth middleware doesn't hit the Users table on every request. A revocation
+// takes effect on every server within one TTL. Expired entries are swept at
+// most once per TTL, so the cache only holds users seen in the last two TTLs.
+type UserStateCache struct {
+	dm  *DatabaseManager
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]userStateEntry // "tenant|userID"
+	lastSweep time.Time
+}
+
+func NewUserStateCache(dm *DatabaseManager, ttl time.Duration) *UserStateCache {
+	return &UserStateCache{dm: dm, ttl: ttl, entries: make(map[string]userStateEntry)}
+}
+
+// Get returns the user's state in tenant, from cache when fresh.
+func (c *UserStateCache) Get(ctx context.Context, tenant string, userID int32) (*UserState, error) {
+	key := userStateKey(tenant, userID)
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Sub(entry.loadedAt) < c.ttl {
+		return entry.state, nil
+	}
+
+	var state *UserState
+	if err := c.dm.Exec(ctx, tenant, func(db *gorm.DB) error {
+		var err error
+		state, err = LoadUserState(db, userID)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	c.store(key, state, now)
+	return state, nil
+}
+
+// store caches state under key, first dropping expired entries when the last
+// sweep is a TTL old.
+func (c *UserStateCache) store(key string, state *UserState, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) >= c.ttl {
+		for k, entry := range c.entries {
+			if now.Sub(entry.loadedAt) >= c.ttl {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+	c.entries[key] = userStateEntry{state: state, loadedAt: now}
+}
+
+func userStateKey(tenant string, userID int32) string {
+	return fmt.Sprintf("%s|%d", tenant, userID)
+}
+
+func LoadUserState(db *gorm.DB, userID int32) (*UserState, error) {
+	var user models.User
+	if err := db.Select("Id", "SecurityStamp", "Deactivated", "AccessLockoutAt").
+		Where("Id = ?", userID).Take(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &UserState{
+		SecurityStamp:   user.SecurityStamp,
+		Deactivated:     user.Deactivated,
+		AccessLockoutAt: user.AccessLockoutAt,
+	}, nil
+}
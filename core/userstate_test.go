@@ -0,0 +1,23 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserStateCacheSweepsExpired(t *testing.T) {
+	c := NewUserStateCache(nil, 30*time.Second)
+	start := time.Date(2026, 1, 12, 8, 0, 0, 0, time.UTC)
+
+	c.store(userStateKey("oktedi", 1), &UserState{}, start)
+	c.store(userStateKey("oktedi", 2), &UserState{}, start.Add(20*time.Second))
+	assert.Len(t, c.entries, 2, "no sweep within a TTL of the last")
+
+	// User 1 has expired by now; user 2 is still fresh.
+	c.store(userStateKey("demo", 1), &UserState{}, start.Add(40*time.Second))
+	assert.NotContains(t, c.entries, userStateKey("oktedi", 1))
+	assert.Contains(t, c.entries, userStateKey("oktedi", 2))
+	assert.Contains(t, c.entries, userStateKey("demo", 1))
+}
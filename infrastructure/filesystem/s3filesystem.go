@@ -39,6 +39,12 @@ func ReadFile(bucket string, key string, ctx context.Context, outStream io.Write
 }
 
 func ListFiles(bucket string, ctx context.Context) ([]string, error) {
+	return ListFilesWithPrefix(bucket, "", ctx)
+}
+
+// ListFilesWithPrefix lists the keys in bucket that start with prefix. S3
+// filters them, so only the matching keys are paged through.
+func ListFilesWithPrefix(bucket string, prefix string, ctx context.Context) ([]string, error) {
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
@@ -47,9 +53,13 @@ func ListFiles(bucket string, ctx context.Context) ([]string, error) {
 	client := s3.NewFromConfig(cfg)
 	var keys []string
 
-	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+	input := &s3.ListObjectsV2Input{
 		Bucket: aws.String(bucket),
-	})
+	}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+	paginator := s3.NewListObjectsV2Paginator(client, input)
 
 	for paginator.HasMorePages() {
 		page, err := paginator.NextPage(ctx)
@@ -0,0 +1,175 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Store keeps objects under slash-separated keys, in an S3 bucket or a local
+// directory.
+type Store interface {
+	Put(ctx context.Context, key string, contentType string, body io.Reader) error
+	// Open returns ErrNotFound when there is no object at key.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// URL returns a link a client can fetch the object from directly, valid
+	// for ttl, or "" when the store can't issue one and the object must be
+	// streamed through Open.
+	URL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// NewStore opens the store at location: "s3://bucket/prefix" for S3, or a
+// directory path (optionally "file://dir") for the local disk.
+func NewStore(ctx context.Context, location string) (Store, error) {
+	if rest, ok := strings.CutPrefix(location, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("invalid store %q: missing bucket", location)
+		}
+		return NewS3Store(ctx, bucket, prefix)
+	}
+	dir := strings.TrimPrefix(location, "file://")
+	if dir == "" {
+		return nil, fmt.Errorf("invalid store %q: missing directory", location)
+	}
+	return NewDiskStore(dir), nil
+}
+
+type S3Store struct {
+	bucket  string
+	prefix  string
+	client  *s3.Client
+	presign *s3.PresignClient
+}
+
+func NewS3Store(ctx context.Context, bucket, prefix string) (*S3Store, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	client := s3.NewFromConfig(cfg)
+	return &S3Store{
+		bucket:  bucket,
+		prefix:  strings.Trim(prefix, "/"),
+		client:  client,
+		presign: s3.NewPresignClient(client),
+	}, nil
+}
+
+func (s *S3Store) key(key string) string {
+	return path.Join(s.prefix, key)
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, contentType string, body io.Reader) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.key(key)),
+		ContentType: aws.String(contentType),
+		Body:        body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object %s in bucket %s: %w", s.key(key), s.bucket, err)
+	}
+	return nil
+}
+
+func (s *S3Store) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(key)),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get object %s from bucket %s: %w", s.key(key), s.bucket, err)
+	}
+	return resp.Body, nil
+}
+
+// URL presigns a GET for the object.
+func (s *S3Store) URL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	req, err := s.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(key)),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign object %s in bucket %s: %w", s.key(key), s.bucket, err)
+	}
+	return req.URL, nil
+}
+
+// DiskStore keeps objects as files under a directory. It can't sign URLs, so
+// objects are streamed.
+type DiskStore struct {
+	dir string
+}
+
+func NewDiskStore(dir string) *DiskStore {
+	return &DiskStore{dir: dir}
+}
+
+// path maps key to a file under the store's directory, rejecting keys that
+// would escape it.
+func (s *DiskStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || clean != "/"+key {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(clean)), nil
+}
+
+func (s *DiskStore) Put(ctx context.Context, key string, contentType string, body io.Reader) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename, so a reader never sees half a file.
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func (s *DiskStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *DiskStore) URL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,39 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewStore(ctx, "file://"+t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put(ctx, "tenant/records/r1.jpg", "image/jpeg", strings.NewReader("first")))
+	require.NoError(t, store.Put(ctx, "tenant/records/r1.jpg", "image/jpeg", strings.NewReader("second")))
+
+	f, err := store.Open(ctx, "tenant/records/r1.jpg")
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	f.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+
+	_, err = store.Open(ctx, "tenant/records/r2.jpg")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	url, err := store.URL(ctx, "tenant/records/r1.jpg", time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, url)
+
+	for _, key := range []string{"", "../escape", "tenant/../../escape", "/absolute", "tenant//r1"} {
+		assert.Error(t, store.Put(ctx, key, "image/jpeg", strings.NewReader("x")), key)
+	}
+}
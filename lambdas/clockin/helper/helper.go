@@ -1,11 +1,15 @@
 package helper
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
 	"time"
 
+	"axiapac.com/axiapac/oktedi/model"
 	"axiapac.com/axiapac/utils"
 )
 
@@ -105,3 +109,59 @@ func GroupRecords(records []Record) []ClockRecord {
 
 	return clockRecords
 }
+
+// UnknownUser is a CSV user id that matches no employee holding a card on the
+// tap's date, so its taps cannot be booked.
+type UnknownUser struct {
+	UserID string `json:"userId"`
+	Rows   int    `json:"rows"`
+}
+
+// RecordID is the oktedi_records id for a tap: a digest of the user and the
+// tap time, so re-importing an export, or an overlapping one, gives the same
+// ids.
+func RecordID(r Record) string {
+	sum := sha256.Sum256([]byte(r.UserID + "|" + r.Timestamp.UTC().Format(time.RFC3339)))
+	return "csv-" + hex.EncodeToString(sum[:16])
+}
+
+// TagLookup returns the card a CSV user held on date (YYYY-MM-DD).
+type TagLookup func(userID, date string) (string, bool)
+
+// ToClockinRecords maps grouped taps to pending oktedi_records for Prepare.
+// tagOn gives the card each user held on the group's date; groups it has none
+// for are reported as unknown instead. Taps are left without a kind: their
+// position within a calendar day says nothing about a night shift's, and
+// Prepare pairs kindless taps in turn. The Location becomes the device id, so
+// the device registry can give the clock an area and default project.
+func ToClockinRecords(groups []ClockRecord, tagOn TagLookup) ([]model.ClockinRecord, []UnknownUser) {
+	var records []model.ClockinRecord
+	unknownRows := make(map[string]int)
+	for _, g := range groups {
+		tag, ok := tagOn(g.UserID, g.Date)
+		if !ok {
+			unknownRows[g.UserID] += len(g.Records)
+			continue
+		}
+
+		taps := append([]Record(nil), g.Records...)
+		sort.Slice(taps, func(i, j int) bool { return taps[i].Timestamp.Before(taps[j].Timestamp) })
+		for _, r := range taps {
+			records = append(records, model.ClockinRecord{
+				ID:            RecordID(r),
+				Tag:           tag,
+				Date:          r.Date,
+				Timestamp:     r.Timestamp.UTC().Format(time.RFC3339),
+				DeviceID:      r.Location,
+				ProcessStatus: "pending",
+			})
+		}
+	}
+
+	unknown := make([]UnknownUser, 0, len(unknownRows))
+	for userID, rows := range unknownRows {
+		unknown = append(unknown, UnknownUser{UserID: userID, Rows: rows})
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].UserID < unknown[j].UserID })
+	return records, unknown
+}
@@ -3,6 +3,9 @@ package helper
 import (
 	"strings"
 	"testing"
+
+	oktedi "axiapac.com/axiapac/oktedi/core"
+	"axiapac.com/axiapac/oktedi/model"
 )
 
 func TestParseClockInCSV(t *testing.T) {
@@ -27,3 +30,108 @@ func TestParseClockInCSV(t *testing.T) {
 		t.Errorf("unexpected second record: %+v", records[1])
 	}
 }
+
+// tagsOf looks up users' cards in a map, whatever the date.
+func tagsOf(tags map[string]string) TagLookup {
+	return func(userID, date string) (string, bool) {
+		tag, ok := tags[userID]
+		return tag, ok
+	}
+}
+
+func TestToClockinRecords(t *testing.T) {
+	csvData := `ID,UserID,Timestamp,Location
+1,7,2023-08-20T16:30:00+10:00,Gate
+2,7,2023-08-20T06:00:00+10:00,Gate
+3,9,2023-08-20T06:05:00+10:00,Gate
+`
+	records, err := ParseClockInCSV(strings.NewReader(csvData), 10*60*60)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	recs, unknown := ToClockinRecords(GroupRecords(records), tagsOf(map[string]string{"7": "TAG7"}))
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(recs))
+	}
+	if recs[0].Kind != "" || recs[0].Timestamp != "2023-08-19T20:00:00Z" || recs[0].Tag != "TAG7" ||
+		recs[0].Date != "2023-08-20" || recs[0].DeviceID != "Gate" || recs[0].ProcessStatus != "pending" {
+		t.Errorf("unexpected clock-in record: %+v", recs[0])
+	}
+	if recs[1].Kind != "" || recs[1].Timestamp != "2023-08-20T06:30:00Z" {
+		t.Errorf("unexpected clock-out record: %+v", recs[1])
+	}
+	if len(unknown) != 1 || unknown[0].UserID != "9" || unknown[0].Rows != 1 {
+		t.Errorf("unexpected unknown users: %+v", unknown)
+	}
+
+	// Re-importing the same export yields the same ids.
+	again, _ := ToClockinRecords(GroupRecords(records), tagsOf(map[string]string{"7": "TAG7"}))
+	if again[0].ID != recs[0].ID || again[1].ID != recs[1].ID || recs[0].ID == recs[1].ID {
+		t.Errorf("record ids are not stable: %s %s / %s %s", recs[0].ID, recs[1].ID, again[0].ID, again[1].ID)
+	}
+}
+
+func TestToClockinRecordsCardHandover(t *testing.T) {
+	// User 7 swapped cards on Aug 21; the export is imported afterwards.
+	csvData := `ID,UserID,Timestamp,Location
+1,7,2023-08-20T06:00:00+10:00,Gate
+2,7,2023-08-21T06:00:00+10:00,Gate
+`
+	records, err := ParseClockInCSV(strings.NewReader(csvData), 10*60*60)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tagOn := func(userID, date string) (string, bool) {
+		if date < "2023-08-21" {
+			return "OLD", true
+		}
+		return "NEW", true
+	}
+	recs, _ := ToClockinRecords(GroupRecords(records), tagOn)
+	tags := make(map[string]string)
+	for _, r := range recs {
+		tags[r.Date] = r.Tag
+	}
+	if tags["2023-08-20"] != "OLD" || tags["2023-08-21"] != "NEW" {
+		t.Errorf("expected each day's taps on the card held that day, got %v", tags)
+	}
+}
+
+func TestToClockinRecordsNightShift(t *testing.T) {
+	// Two 18:00–06:00 shifts: each calendar day has a finish, then a start.
+	csvData := `ID,UserID,Timestamp,Location
+1,7,2023-08-20T18:00:00+10:00,Gate
+2,7,2023-08-21T06:00:00+10:00,Gate
+3,7,2023-08-21T18:00:00+10:00,Gate
+4,7,2023-08-22T06:00:00+10:00,Gate
+`
+	records, err := ParseClockInCSV(strings.NewReader(csvData), 10*60*60)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	recs, _ := ToClockinRecords(GroupRecords(records), tagsOf(map[string]string{"7": "TAG7"}))
+	if len(recs) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(recs))
+	}
+	var shift []*model.ClockinRecord
+	for i, r := range recs {
+		if r.Kind != "" {
+			t.Errorf("record %s on %s: expected no kind, got %q", r.Timestamp, r.Date, r.Kind)
+		}
+		// Prepare for Aug 20 takes its start and the next morning's finish.
+		if r.Timestamp == "2023-08-20T08:00:00Z" || r.Timestamp == "2023-08-20T20:00:00Z" {
+			shift = append(shift, &recs[i])
+		}
+	}
+
+	segments, unmatched := oktedi.SegmentRecords(shift)
+	if len(unmatched) != 0 || len(segments) != 1 {
+		t.Fatalf("expected one segment, got %d segments and %d unmatched taps", len(segments), len(unmatched))
+	}
+	if hours, err := oktedi.WorkedHours(segments); err != nil || hours != 12 {
+		t.Errorf("expected 12 hours, got %v (%v)", hours, err)
+	}
+}
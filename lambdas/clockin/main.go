@@ -1,68 +1,254 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
-	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
+	"axiapac.com/axiapac/console"
 	"axiapac.com/axiapac/core"
+	"axiapac.com/axiapac/core/models"
+	"axiapac.com/axiapac/infrastructure/filesystem"
 	"axiapac.com/axiapac/lambdas/clockin/helper"
+	"axiapac.com/axiapac/lambdas/common"
+	oktedi "axiapac.com/axiapac/oktedi/core"
+	"github.com/aws/aws-lambda-go/lambda"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func getFile(path string) (*os.File, error) {
-	file, err := os.Open(path)
+// brisbaneOffset is the clock exports' UTC offset in seconds (UTC+10).
+const brisbaneOffset = 10 * 3600
+
+type ImportEvent struct {
+	Env      string `json:"env"`      // entry in the SSM "databases" parameter
+	Database string `json:"database"` // tenant schema to import into
+	Bucket   string `json:"bucket"`
+	// Key is a single export to import; when empty every .csv under Prefix is.
+	Key    string `json:"key"`
+	Prefix string `json:"prefix"`
+	// Dir reads the exports from a local directory instead of S3.
+	Dir    string `json:"dir"`
+	DryRun bool   `json:"dryRun"`
+}
+
+type FileResult struct {
+	File         string               `json:"file"`
+	Rows         int                  `json:"rows"`
+	Inserted     int64                `json:"inserted"` // new records; re-imported taps are skipped
+	UnknownUsers []helper.UnknownUser `json:"unknownUsers"`
+}
+
+// ImportClockIns imports clock exports into the tenant's oktedi_records as
+// pending taps, for the Prepare pipeline to turn into timesheets.
+func ImportClockIns(ctx context.Context, dsn string, event ImportEvent) ([]FileResult, error) {
+	files, err := listExports(ctx, event)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file %s: %w", path, err)
+		return nil, err
 	}
-	// caller is responsible for closing if needed
-	return file, nil
-}
+	fmt.Printf("[INFO] Found %d export(s)\n", len(files))
+
+	dm, err := core.New(dsn, 10)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database manager: %w", err)
+	}
+	dm.LogLevel = core.LogLevelError
+	defer dm.Close()
 
-var DSN = "root:development@tcp(localhost:3306)/development?parseTime=true"
+	// Only import into schemas with an active subscription. Local runs, with
+	// no console database, set AXIAPAC_TENANTS=host to trust the schema name.
+	if os.Getenv("AXIAPAC_TENANTS") != "host" {
+		consoleDB, err := console.Connect(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to console: %w", err)
+		}
+		dm.Tenants = console.NewTenantResolver(consoleDB, 5*time.Minute)
+	}
 
-func main() {
-	// Create a buffer to hold the S3 file data
-	// var stream bytes.Buffer
-	// err := filesystem.ReadFile("my-bucket", "path/to/my/file.csv", context.Background(), &stream)
-	fmt.Printf("Fetching file\n")
-	stream, err := getFile("lambdas/clockin/test.csv")
+	results := make([]FileResult, 0, len(files))
+	for _, file := range files {
+		data, err := readExport(ctx, event, file)
+		if err != nil {
+			return results, err
+		}
+		var result FileResult
+		if err := dm.Exec(ctx, event.Database, func(db *gorm.DB) error {
+			result, err = importExport(db, file, data, event.DryRun)
+			return err
+		}); err != nil {
+			return results, fmt.Errorf("failed to import %s: %w", file, err)
+		}
+		for _, u := range result.UnknownUsers {
+			fmt.Printf("[WARN] %s: unknown user %s (%d rows skipped)\n", file, u.UserID, u.Rows)
+		}
+		fmt.Printf("[INFO] %s: %d rows, %d new records\n", file, result.Rows, result.Inserted)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func importExport(db *gorm.DB, file string, data []byte, dryRun bool) (FileResult, error) {
+	result := FileResult{File: file}
+	records, err := helper.ParseClockInCSV(bytes.NewReader(data), brisbaneOffset)
 	if err != nil {
-		log.Fatalf("failed to read file from S3: %v", err)
+		return result, fmt.Errorf("failed to parse CSV: %w", err)
 	}
-	defer stream.Close()
+	result.Rows = len(records)
 
-	fmt.Printf("Parsing CSV\n")
-	records, err := helper.ParseClockInCSV(stream, 10*3600) // UTC+10
+	tags, err := employeeTags(db, records)
 	if err != nil {
-		log.Fatalf("failed to parse CSV: %v", err)
+		return result, err
+	}
+	clockins, unknown := helper.ToClockinRecords(helper.GroupRecords(records), tags)
+	result.UnknownUsers = unknown
+	if dryRun || len(clockins) == 0 {
+		return result, nil
 	}
-	fmt.Printf("Parsed %d records\n", len(records))
-	grouped := helper.GroupRecords(records)
-	fmt.Printf("Grouped %d records\n", len(grouped))
 
-	db := core.ConnectDB(DSN)
+	// Taps already imported are left alone, including ones since deleted or
+	// processed.
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&clockins, 500)
+	result.Inserted = res.RowsAffected
+	return result, res.Error
+}
+
+// employeeTags looks up the card each export user, an employee id, held on a
+// date. Card history decides, so an export imported after a card changed
+// hands still goes to the employee who tapped; untracked cards fall back to
+// the employee's IdentificationTag.
+func employeeTags(db *gorm.DB, records []helper.Record) (helper.TagLookup, error) {
+	var ids []int
+	for _, r := range records {
+		if id, err := strconv.Atoi(r.UserID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	var emps []models.Employee
+	if len(ids) > 0 {
+		if err := db.Select("EmployeeId", "IdentificationTag").Where("EmployeeId IN ?", ids).Find(&emps).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch employees: %w", err)
+		}
+	}
+	holders, err := oktedi.LoadEmployeeCards(db, emps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch card history: %w", err)
+	}
 
-	for _, group := range grouped {
-		fmt.Printf("  ID: %s, Date: %s, From: %s, To: %s\n",
-			group.UserID, group.Date, group.From, group.To)
+	employees := make(map[string]models.Employee, len(emps))
+	for _, e := range emps {
+		employees[strconv.Itoa(int(e.EmployeeID))] = e
+	}
+	return func(userID, date string) (string, bool) {
+		emp, ok := employees[userID]
+		if !ok {
+			return "", false
+		}
+		tags := holders.TagsHeldBy(emp, date)
+		if len(tags) == 0 {
+			return "", false
+		}
+		return tags[0], true
+	}, nil
+}
 
-		// find employee
-		employeeId, err := strconv.Atoi(group.UserID)
+func listExports(ctx context.Context, event ImportEvent) ([]string, error) {
+	var files []string
+	switch {
+	case event.Dir != "":
+		entries, err := os.ReadDir(event.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", event.Dir, err)
+		}
+		for _, e := range entries {
+			if !e.IsDir() && strings.HasSuffix(strings.ToLower(e.Name()), ".csv") {
+				files = append(files, e.Name())
+			}
+		}
+	case event.Key != "":
+		files = []string{event.Key}
+	default:
+		keys, err := filesystem.ListFilesWithPrefix(event.Bucket, event.Prefix, ctx)
 		if err != nil {
-			fmt.Printf("Error converting UserID to int: %v\n", err)
-			continue
+			return nil, err
+		}
+		for _, key := range keys {
+			if strings.HasSuffix(strings.ToLower(key), ".csv") {
+				files = append(files, key)
+			}
 		}
-		employee, err := core.FindEmployeeByID(db, employeeId)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func readExport(ctx context.Context, event ImportEvent, file string) ([]byte, error) {
+	if event.Dir != "" {
+		data, err := os.ReadFile(filepath.Join(event.Dir, file))
 		if err != nil {
-			fmt.Printf("Error finding employee by ID: %v\n", err)
-			continue
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
 		}
-		fmt.Printf("Found employee: %s\n", employee.Code)
+		return data, nil
+	}
+	var stream bytes.Buffer
+	if err := filesystem.ReadFile(event.Bucket, file, ctx, &stream); err != nil {
+		return nil, err
+	}
+	return stream.Bytes(), nil
+}
+
+func HandleRequest(ctx context.Context, event ImportEvent) ([]FileResult, error) {
+	eventJson, _ := json.Marshal(event)
+	fmt.Printf("[INFO] Event: %s\n", string(eventJson))
+
+	if event.Database == "" {
+		return nil, fmt.Errorf("database is required")
+	}
+	if event.Dir == "" && event.Bucket == "" {
+		return nil, fmt.Errorf("bucket or dir is required")
+	}
+
+	dbs, err := common.LoadDatabases(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load databases from SSM: %w", err)
+	}
+	env := strings.ToLower(event.Env)
+	entry, ok := dbs[env]
+	if !ok {
+		return nil, fmt.Errorf("environment '%s' not found in parameter store", env)
+	}
 
-		// TODO: create timesheet
+	return ImportClockIns(ctx, entry.GetDSN(""), event)
+}
 
-		// TODO: save/update timesheet
+func main() {
+	if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+		lambda.Start(HandleRequest)
+	} else {
+		// Local run: import the sample export into the schema named in DSN
+		// (a dry run unless DRY_RUN=false). Without a console database, set
+		// AXIAPAC_TENANTS=host as `make clockin run` does.
+		dsn := os.Getenv("DSN")
+		if dsn == "" {
+			fmt.Printf("[ERROR] DSN is required\n")
+			os.Exit(1)
+		}
+		results, err := ImportClockIns(context.Background(), dsn, ImportEvent{
+			Database: "localhost",
+			Dir:      "lambdas/clockin",
+			DryRun:   os.Getenv("DRY_RUN") != "false",
+		})
+		if err != nil {
+			fmt.Printf("[ERROR] %v\n", err)
+			os.Exit(1)
+		}
+		resJson, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Printf("[SUCCESS] Results:\n%s\n", string(resJson))
 	}
-	fmt.Printf("Completed\n")
 }
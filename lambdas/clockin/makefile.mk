@@ -0,0 +1,37 @@
+FUNCTION = clockin
+DIR      = ./lambdas/$(FUNCTION)
+DIST     = $(DIR)/dist
+OUTPUT   = $(DIST)/bootstrap
+ZIP      = $(OUTPUT).zip
+
+.DEFAULT_GOAL := no-task
+
+.PHONY: no-task clean build zip upload deploy run
+
+no-task:
+	@echo "❌ You must specify a task (e.g. make build, make zip, make deploy, make run)"
+	@exit 1
+
+run:
+	AXIAPAC_TENANTS=host go run $(DIR)
+
+build:
+	@echo "Building Lambda $(FUNCTION)..."
+	@mkdir -p $(DIST)
+	GOOS=linux GOARCH=arm64 go build -o $(OUTPUT) $(DIR)
+
+zip: build
+	@echo "Packaging Lambda $(FUNCTION)..."
+	zip -j $(ZIP) $(OUTPUT)
+
+upload: zip
+	@echo "Deploying Lambda to AWS: $(FUNCTION)"
+	aws lambda update-function-code \
+		--function-name $(FUNCTION) \
+		--zip-file fileb://$(ZIP)
+
+deploy: clean build zip upload
+
+clean:
+	@echo "Cleaning build artifacts..."
+	rm -rf $(DIST)
\ No newline at end of file
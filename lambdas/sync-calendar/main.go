@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"encoding/json"
+	"errors"
 
+	"axiapac.com/axiapac/console"
 	"axiapac.com/axiapac/core"
 	"axiapac.com/axiapac/lambdas/common"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -29,12 +32,19 @@ func SyncCalendar(ctx context.Context, dsn string, databases *[]string, dryRun b
 	fmt.Printf("[INFO] Successfully processed %d regions from S3\n", len(holidays))
 
 	dm, err := core.New(dsn, 10)
-	dm.LogLevel = core.LogLevelError
 	if err != nil {
 		return nil, fmt.Errorf("failed to create database manager: %w", err)
 	}
+	dm.LogLevel = core.LogLevelError
 	defer dm.Close()
 
+	// Only sync schemas with an active subscription; the rest are skipped below.
+	consoleDB, err := console.Connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to console: %w", err)
+	}
+	dm.Tenants = console.NewTenantResolver(consoleDB, 5*time.Minute)
+
 	var targetDatabases []string
 	if databases == nil {
 		fmt.Printf("[INFO] No databases provided, fetching all databases...\n")
@@ -47,27 +57,33 @@ func SyncCalendar(ctx context.Context, dsn string, databases *[]string, dryRun b
 	}
 
 	results := make(map[string]SyncStats)
-	for _, dbName := range targetDatabases {
-		fmt.Printf("[INFO] Syncing for database: %s\n", dbName)
-		// dm.Exec internally calls USE `schema` to switch the database context safely for GORM
-		err := dm.Exec(ctx, dbName, func(db *gorm.DB) error {
-			stats, err := SyncHolidays(db, holidays, dryRun)
-			if err != nil {
-				return err
-			}
-			results[dbName] = stats
-			return nil
-		})
-		if err != nil {
-			fmt.Printf("[ERROR] failed to sync for database %s: %v\n", dbName, err)
+	for _, result := range dm.ForEachTenant(ctx, targetDatabases, 4, 2*time.Minute, func(ctx context.Context, dbName string, db *gorm.DB) (any, error) {
+		return SyncHolidays(db, holidays, dryRun)
+	}) {
+		if databases == nil && unsubscribed(result.Err) {
+			// All databases on the server were listed, not only subscribed
+			// tenants.
+			fmt.Printf("[INFO] Skipped database %s: %v\n", result.Tenant, result.Err)
+			continue
+		}
+		if result.Err != nil {
+			fmt.Printf("[ERROR] failed to sync for database %s: %v\n", result.Tenant, result.Err)
 			continue
 		}
+		fmt.Printf("[INFO] Synced database %s in %s\n", result.Tenant, result.Duration)
+		results[result.Tenant] = result.Payload.(SyncStats)
 	}
 
 	fmt.Printf("[INFO] Finished syncing holidays to database(s)\n")
 	return results, nil
 }
 
+// unsubscribed reports whether err is the console refusing a schema that isn't
+// an active tenant.
+func unsubscribed(err error) bool {
+	return errors.Is(err, core.ErrTenantNotFound) || errors.Is(err, core.ErrTenantInactive)
+}
+
 func HandleRequest(ctx context.Context, event interface{}) (interface{}, error) {
 	eventJson, _ := json.Marshal(event)
 	fmt.Printf("[INFO] Event: %s\n", string(eventJson))
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"axiapac.com/axiapac/console"
+	"axiapac.com/axiapac/core"
+	"axiapac.com/axiapac/oktedi/migrations"
+	"gorm.io/gorm"
+)
+
+const usage = `usage: migrate [flags] up|down|status|baseline
+
+  up        apply pending migrations (up to -to)
+  down      roll back the last -steps migrations
+  status    list applied and pending migrations
+  baseline  record migrations up to -to as applied without running them
+
+DSN (no schema) selects the server. AXIAPAC_TENANTS=host skips the console
+subscription check, as for the web server.
+
+flags:
+`
+
+// skipped is the payload for -all tenants that don't use oktedi.
+const skipped = "skipped"
+
+func main() {
+	tenants := flag.String("tenants", "", "comma-separated tenant schemas")
+	all := flag.Bool("all", false, "every schema that has the oktedi tables")
+	dryRun := flag.Bool("dry-run", false, "print the SQL instead of running it")
+	to := flag.Int("to", 0, "last version for up/baseline (0 = latest)")
+	steps := flag.Int("steps", 1, "migrations to roll back with down")
+	concurrency := flag.Int("concurrency", 4, "tenants migrated at once")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	command := flag.Arg(0)
+	switch command {
+	case "up", "down", "status", "baseline":
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if (*tenants == "") == !*all {
+		log.Fatal("pass either -tenants or -all")
+	}
+
+	allMigrations, err := core.LoadMigrations(migrations.Files)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	dm, err := core.New(os.Getenv("DSN"), *concurrency+1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer dm.Close()
+	dm.LogLevel = core.LogLevelError
+
+	if os.Getenv("AXIAPAC_TENANTS") != "host" {
+		consoleDB, err := console.Connect(ctx)
+		if err != nil {
+			log.Fatal("Failed to connect to console:", err)
+		}
+		dm.Tenants = console.NewTenantResolver(consoleDB, 5*time.Minute)
+	}
+
+	var targets []string
+	if *all {
+		if targets, err = dm.GetAllDatabases(ctx); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		for _, t := range strings.Split(*tenants, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				targets = append(targets, t)
+			}
+		}
+	}
+
+	results := dm.ForEachTenant(ctx, targets, *concurrency, 10*time.Minute, func(ctx context.Context, tenant string, db *gorm.DB) (any, error) {
+		if *all && !db.Migrator().HasTable("oktedi_timesheets") {
+			return skipped, nil
+		}
+
+		runner := &core.MigrationRunner{
+			Migrations: allMigrations,
+			DryRun:     *dryRun,
+			Logf: func(format string, args ...any) {
+				fmt.Printf("[%s] "+format+"\n", append([]any{tenant}, args...)...)
+			},
+		}
+		switch command {
+		case "up":
+			return runner.Up(db, *to)
+		case "down":
+			return runner.Down(db, *steps)
+		case "baseline":
+			return runner.Baseline(db, *to)
+		default:
+			return runner.Status(db)
+		}
+	})
+
+	var ok, failed, skips int
+	fmt.Printf("\n%-30s %-10s %s\n", "TENANT", "RESULT", "DETAIL")
+	for _, result := range results {
+		switch {
+		case *all && unsubscribed(result.Err):
+			// -all lists every schema on the server, not only subscribed
+			// tenants.
+			skips++
+			fmt.Printf("%-30s %-10s %v\n", result.Tenant, "SKIPPED", result.Err)
+		case result.Err != nil:
+			failed++
+			fmt.Printf("%-30s %-10s %v\n", result.Tenant, "FAILED", result.Err)
+		case result.Payload == skipped:
+			skips++
+		default:
+			ok++
+			fmt.Printf("%-30s %-10s %s (%s)\n", result.Tenant, "OK", describe(result.Payload), result.Duration.Round(time.Millisecond))
+		}
+	}
+	fmt.Printf("\n%d tenants: %d ok, %d failed, %d skipped", len(results), ok, failed, skips)
+	if *dryRun {
+		fmt.Print(" (dry run)")
+	}
+	fmt.Println()
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// unsubscribed reports whether err is the console refusing a schema that isn't
+// an active tenant.
+func unsubscribed(err error) bool {
+	return errors.Is(err, core.ErrTenantNotFound) || errors.Is(err, core.ErrTenantInactive)
+}
+
+func describe(payload any) string {
+	switch p := payload.(type) {
+	case []int:
+		if len(p) == 0 {
+			return "nothing to do"
+		}
+		versions := make([]string, len(p))
+		for i, v := range p {
+			versions[i] = fmt.Sprintf("%03d", v)
+		}
+		return strings.Join(versions, ", ")
+	case []core.MigrationStatus:
+		var applied, pending []string
+		for _, s := range p {
+			if s.AppliedAt != nil {
+				applied = append(applied, fmt.Sprintf("%03d", s.Version))
+			} else {
+				pending = append(pending, fmt.Sprintf("%03d_%s", s.Version, s.Name))
+			}
+		}
+		return fmt.Sprintf("applied [%s] pending [%s]", strings.Join(applied, " "), strings.Join(pending, " "))
+	}
+	return fmt.Sprint(payload)
+}
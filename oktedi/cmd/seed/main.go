@@ -1,36 +1,41 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 
-	"axiapac.com/axiapac/oktedi/model"
+	"axiapac.com/axiapac/core"
+	"axiapac.com/axiapac/oktedi/migrations"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+// seed brings a single dev database (DSN with a schema) up to date. Deployed
+// tenants are migrated with oktedi/cmd/migrate.
 func main() {
 
 	dsn := os.Getenv("DSN") //"root:development@tcp(localhost:3306)/oktedi?parseTime=true"
-	// dsn := "axiapac:Tingalpa2019@tcp(experimental.cixs43nsk6u5.ap-southeast-2.rds.amazonaws.com:3306)/oktedi?parseTime=true"
-	db, _ := gorm.Open(mysql.Open(dsn), &gorm.Config{
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
-
-	models := []interface{}{
-		&model.ClockinRecord{},
-		&model.SupervisorRecord{},
-		&model.OktediTimesheet{},
+	if err != nil {
+		log.Fatalf("failed to connect: %v", err)
 	}
 
-	for _, m := range models {
-		if !db.Migrator().HasTable(m) {
-			err := db.Migrator().CreateTable(m)
-			if err != nil {
-				log.Fatalf("failed to create table for %T: %v", m, err)
-			}
-		}
+	all, err := core.LoadMigrations(migrations.Files)
+	if err != nil {
+		log.Fatal(err)
 	}
 
+	runner := &core.MigrationRunner{
+		Migrations: all,
+		Logf: func(format string, args ...any) {
+			fmt.Printf(format+"\n", args...)
+		},
+	}
+	if _, err := runner.Up(db, 0); err != nil {
+		log.Fatalf("failed to migrate: %v", err)
+	}
 }
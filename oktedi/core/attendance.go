@@ -33,7 +33,8 @@ type AttendanceRow struct {
 	// has no defined work hours). Not deducted from Total Hours.
 	BreakMinutes *int32 `json:"breakMinutes"`
 	// Project resolved from the employee's assigned job (roster/home), so absent
-	// employees still carry a project for the header filter.
+	// employees still carry a project for the header filter. Taps at a kiosk
+	// with a default project in the device registry book to that project.
 	ProjectID   int32  `json:"projectId"`
 	ProjectCode string `json:"projectCode"`
 	ProjectName string `json:"projectName"`
@@ -42,14 +43,21 @@ type AttendanceRow struct {
 	// yet (typically today, before the prepare flow runs). Raw lowercase; the
 	// client formats it for display.
 	ReviewStatus string `json:"reviewStatus"`
+	// OffSite is set when a tap on the date was outside the geofence of the
+	// employee's work site. Before the prepare flow runs it also shows as the
+	// "off-site" ReviewStatus.
+	OffSite bool `json:"offSite"`
 	// Absent-only streaks (nil when the employee is not absent on the date).
 	ConsecutiveDaysAbsent *int `json:"consecutiveDaysAbsent"`
 	TotalAbsentDays       *int `json:"totalAbsentDays"`
 	// Panel: `rosterPanel` from the employee's Attributes JSON ("" when absent).
 	Panel string `json:"panel"`
 	// DeviceID is the device of the clock-in record ("" when the employee has no
-	// records on the date). The evacuation register maps it to a physical area.
-	DeviceID string `json:"deviceId"`
+	// records on the date). DeviceArea is that device's area in the device
+	// registry ("" when unregistered); the evacuation register lists only
+	// employees who clocked in at a device with an area.
+	DeviceID   string `json:"deviceId"`
+	DeviceArea string `json:"deviceArea"`
 	// Evacuation-register fields. Employer resolves the Attributes `employer.id`
 	// reference to the supplier name; Department joins the Attributes
 	// `businessUnit` and `department` values (e.g. "Projects BU FIFO Village");
@@ -120,6 +128,18 @@ type attendanceRefData struct {
 	regionWorkHours map[int32]map[int32]models.RegionWorkHour
 	supplierNames   map[int32]string // employer resolution (Attributes employer.id)
 	occupationDescs map[int32]string // classification (Employees.OccupationId)
+	devices         DeviceRegistry   // area and default project per clock-in device
+	geofences       Geofences        // per work site, for OffSite
+	cards           CardHolders      // who held each card when
+	empByID         map[int32]models.Employee
+	empByTag        map[string]models.Employee
+}
+
+// holder resolves a tap to the employee who held its card on its date, as
+// Prepare does.
+func (rd *attendanceRefData) holder(r *model.ClockinRecord) (int32, bool) {
+	emp, ok := rd.cards.EmployeeOn(r.Tag, r.Date, rd.empByID, rd.empByTag)
+	return emp.EmployeeID, ok
 }
 
 func loadAttendanceRefData(db *gorm.DB) (*attendanceRefData, error) {
@@ -190,6 +210,27 @@ func loadAttendanceRefData(db *gorm.DB) (*attendanceRefData, error) {
 		occupationDescs[o.OccupationID] = o.Description
 	}
 
+	devices, err := LoadDeviceRegistry(db)
+	if err != nil {
+		return nil, err
+	}
+	geofences, err := LoadGeofences(db)
+	if err != nil {
+		return nil, err
+	}
+	cards, err := LoadCardHolders(db)
+	if err != nil {
+		return nil, err
+	}
+	empByID := make(map[int32]models.Employee, len(employees))
+	empByTag := make(map[string]models.Employee, len(employees))
+	for _, e := range employees {
+		empByID[e.EmployeeID] = e
+		if e.IdentificationTag != "" {
+			empByTag[e.IdentificationTag] = e
+		}
+	}
+
 	return &attendanceRefData{
 		employees:       employees,
 		timeTypeMap:     ttMap,
@@ -198,6 +239,11 @@ func loadAttendanceRefData(db *gorm.DB) (*attendanceRefData, error) {
 		regionWorkHours: regionWHMap,
 		supplierNames:   supplierNames,
 		occupationDescs: occupationDescs,
+		devices:         devices,
+		geofences:       geofences,
+		cards:           cards,
+		empByID:         empByID,
+		empByTag:        empByTag,
 	}, nil
 }
 
@@ -239,15 +285,13 @@ func LoadAttendance(db *gorm.DB, date time.Time, now time.Time) (*AttendanceResu
 		return nil, err
 	}
 
-	// Clock records for the viewed date, grouped per employee (by tag).
+	// Clock records for the viewed date, grouped per employee by who held
+	// each card that day.
 	var dayRecords []*model.ClockinRecord
 	if err := db.Where("date = ?", dateStr).Find(&dayRecords).Error; err != nil {
 		return nil, err
 	}
-	groupByTag := make(map[string]*RecordGroup)
-	for _, g := range GroupRecords(dayRecords) {
-		groupByTag[g.Tag] = g
-	}
+	groups := GroupRecordsByEmployee(dayRecords, refData.holder)
 
 	// Prepared timesheets for the date, for the Review Status column. Keyed by
 	// employee; absent when the prepare flow hasn't run yet (leaves status "").
@@ -261,17 +305,13 @@ func LoadAttendance(db *gorm.DB, date time.Time, now time.Time) (*AttendanceResu
 	}
 
 	rows := make([]AttendanceRow, 0, len(refData.employees))
-	seenTags := make(map[string]bool)
 
 	// Pass 1: roster employees scheduled on the date (worked or absent), and
 	// roster/non-roster employees who clocked in.
 	var absentEmps []models.Employee
 	for _, emp := range refData.employees {
-		group := groupByTag[emp.IdentificationTag]
-		hasRecords := group != nil && emp.IdentificationTag != ""
-		if hasRecords {
-			seenTags[emp.IdentificationTag] = true
-		}
+		group := groups[EmployeeDay{EmployeeID: emp.EmployeeID, Date: dateStr}]
+		hasRecords := group != nil
 
 		timeType := refData.timeTypeFor(emp)
 		active := ActiveEmployee(emp, date)
@@ -294,9 +334,19 @@ func LoadAttendance(db *gorm.DB, date time.Time, now time.Time) (*AttendanceResu
 			row.RecordCount = len(group.Records)
 			row.ClockOn = formatBrisbaneClock(group.GetClockIn())
 			row.DeviceID = group.GetDeviceID()
+			row.DeviceArea = refData.devices.Area(row.DeviceID)
+			// A kiosk with a default project books its taps there, as Prepare
+			// does.
+			if projectID := refData.devices.DefaultProject(row.DeviceID); projectID != 0 {
+				row.setProject(projectID, refData)
+			}
 			if row.RecordCount >= 2 {
 				row.ClockOff = formatBrisbaneClock(group.GetClockOut())
 			}
+			row.OffSite = refData.geofences.OffSite(emp, group.Records)
+			if row.OffSite && row.ReviewStatus == "" {
+				row.ReviewStatus = "off-site"
+			}
 		}
 
 		if rosteredOn && !hasRecords {
@@ -306,7 +356,7 @@ func LoadAttendance(db *gorm.DB, date time.Time, now time.Time) (*AttendanceResu
 	}
 
 	// Pass 2: absent-streak fields. Fetch records once over the lookback window
-	// for the absent employees' tags, then count per employee.
+	// for the absent employees' cards, then count per employee.
 	if len(absentEmps) > 0 {
 		if err := enrichAbsentStreaks(db, refData, absentEmps, rows, date, today); err != nil {
 			return nil, err
@@ -323,26 +373,45 @@ func buildRow(emp models.Employee, refData *attendanceRefData) AttendanceRow {
 		Code:           emp.Code,
 		FirstName:      emp.FirstName,
 		Surname:        emp.Surname,
-		ProjectID:      emp.JobID,
 		Panel:          AttrString(attrs, "rosterPanel"),
 		Employer:       refData.supplierNames[AttrRefID(attrs, "employer")],
 		Department:     strings.TrimSpace(AttrString(attrs, "businessUnit") + " " + AttrString(attrs, "department")),
 		Area:           AttrString(attrs, "area"),
 		Classification: refData.occupationDescs[emp.OccupationID],
 	}
-	if job, ok := refData.jobByID[emp.JobID]; ok {
+	row.setProject(emp.JobID, refData)
+	return row
+}
+
+func (row *AttendanceRow) setProject(projectID int32, refData *attendanceRefData) {
+	row.ProjectID = projectID
+	row.ProjectCode, row.ProjectName = "", ""
+	if job, ok := refData.jobByID[projectID]; ok {
 		row.ProjectCode = job.JobNo
 		row.ProjectName = job.Description
 	}
-	return row
 }
 
 // enrichAbsentStreaks fills ConsecutiveDaysAbsent / TotalAbsentDays for the
 // absent rows, reading the lookback window's records in one query.
 func enrichAbsentStreaks(db *gorm.DB, refData *attendanceRefData, absentEmps []models.Employee, rows []AttendanceRow, date, today time.Time) error {
-	tags := make([]string, 0, len(absentEmps))
+	// Every card the absent employees have held; a record counts for whoever
+	// held its card on its date.
+	absent := make(map[int32]bool, len(absentEmps))
 	for _, e := range absentEmps {
-		if e.IdentificationTag != "" {
+		absent[e.EmployeeID] = true
+	}
+	var tags []string
+	for tag, history := range refData.cards {
+		for _, a := range history {
+			if absent[a.EmployeeID] {
+				tags = append(tags, tag)
+				break
+			}
+		}
+	}
+	for _, e := range absentEmps {
+		if _, tracked := refData.cards[e.IdentificationTag]; e.IdentificationTag != "" && !tracked {
 			tags = append(tags, e.IdentificationTag)
 		}
 	}
@@ -352,7 +421,7 @@ func enrichAbsentStreaks(db *gorm.DB, refData *attendanceRefData, absentEmps []m
 	// total snapshot (back from today).
 	windowStart := minTime(date, today).AddDate(0, 0, -AbsentLookbackDays)
 	windowEnd := maxTime(date, today)
-	present := make(map[string]bool) // "tag|YYYY-MM-DD"
+	present := make(map[EmployeeDay]bool)
 	if len(tags) > 0 {
 		var windowRecords []*model.ClockinRecord
 		if err := db.Where("tag IN ? AND date >= ? AND date <= ?", tags,
@@ -361,7 +430,9 @@ func enrichAbsentStreaks(db *gorm.DB, refData *attendanceRefData, absentEmps []m
 			return err
 		}
 		for _, r := range windowRecords {
-			present[r.Tag+"|"+r.Date] = true
+			if empID, ok := refData.holder(r); ok {
+				present[EmployeeDay{EmployeeID: empID, Date: r.Date}] = true
+			}
 		}
 	}
 
@@ -377,10 +448,7 @@ func enrichAbsentStreaks(db *gorm.DB, refData *attendanceRefData, absentEmps []m
 		}
 		tt := refData.timeTypeFor(emp)
 		hasRecord := func(d time.Time) bool {
-			if emp.IdentificationTag == "" {
-				return false
-			}
-			return present[emp.IdentificationTag+"|"+d.Format("2006-01-02")]
+			return present[EmployeeDay{EmployeeID: emp.EmployeeID, Date: d.Format("2006-01-02")}]
 		}
 		consecutive := CountConsecutiveAbsent(emp, tt, date, hasRecord, AbsentLookbackDays)
 		total := CountTotalAbsent(emp, tt, today, hasRecord, AbsentLookbackDays)
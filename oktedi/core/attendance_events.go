@@ -0,0 +1,164 @@
+package core
+
+import (
+	"axiapac.com/axiapac/core/models"
+	"axiapac.com/axiapac/oktedi/model"
+	"gorm.io/gorm"
+)
+
+// AttendanceEvent is a live update to one employee's attendance row for a
+// date, sent to dashboards as kiosk pushes arrive. It carries the row's clock
+// fields as LoadAttendance would now compute them, so the client replaces
+// them in its row (adding one for an employee it doesn't list) and recounts
+// its cards; RecordCount 0 means the employee's taps were all deleted.
+type AttendanceEvent struct {
+	Date        string  `json:"date"` // YYYY-MM-DD
+	EmployeeID  int32   `json:"employeeId"`
+	Code        string  `json:"code"`
+	FirstName   string  `json:"firstName"`
+	Surname     string  `json:"surname"`
+	ProjectID   int32   `json:"projectId"`
+	ProjectCode string  `json:"projectCode"`
+	ProjectName string  `json:"projectName"`
+	RecordCount int     `json:"recordCount"`
+	ClockOn     *string `json:"clockOn"`
+	ClockOff    *string `json:"clockOff"`
+	DeviceID    string  `json:"deviceId"`
+	DeviceArea  string  `json:"deviceArea"`
+	OffSite     bool    `json:"offSite"`
+}
+
+// AttendanceEvents resolves the clock-in records with the given ids, including
+// tombstoned ones, to one event per employee and date they touch. A tap
+// belongs to whoever held its card on its date, as in Prepare; taps of no one
+// are skipped. Only the employees, cards and jobs involved are read, plus the
+// small device and geofence tables, so it is cheap enough to run on every
+// push; run it in the push's transaction so the events see its writes.
+func AttendanceEvents(db *gorm.DB, ids []string) ([]AttendanceEvent, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	type tagDate struct{ Tag, Date string }
+	var touched []tagDate
+	if err := db.Unscoped().Model(&model.ClockinRecord{}).
+		Distinct("tag", "date").Where("id IN ?", ids).Scan(&touched).Error; err != nil {
+		return nil, err
+	}
+	if len(touched) == 0 {
+		return nil, nil
+	}
+
+	tags := make([]string, 0, len(touched))
+	for _, td := range touched {
+		tags = append(tags, td.Tag)
+	}
+	// The cards' holders past and present, with their card histories.
+	var holderIDs []int32
+	if err := db.Model(&model.CardAssignment{}).Distinct().
+		Where("tag IN ?", tags).Pluck("employee_id", &holderIDs).Error; err != nil {
+		return nil, err
+	}
+	var employees []models.Employee
+	if err := db.Where("EmployeeId IN ? OR IdentificationTag IN ?", holderIDs, tags).Find(&employees).Error; err != nil {
+		return nil, err
+	}
+	cards, err := LoadEmployeeCards(db, employees)
+	if err != nil {
+		return nil, err
+	}
+	empByID := make(map[int32]models.Employee, len(employees))
+	empByTag := make(map[string]models.Employee, len(employees))
+	for _, e := range employees {
+		empByID[e.EmployeeID] = e
+		if e.IdentificationTag != "" {
+			empByTag[e.IdentificationTag] = e
+		}
+	}
+	holder := func(tag, date string) (int32, bool) {
+		emp, ok := cards.EmployeeOn(tag, date, empByID, empByTag)
+		return emp.EmployeeID, ok
+	}
+
+	// Each employee's row covers every card they held that day.
+	var days []EmployeeDay
+	seen := make(map[EmployeeDay]bool)
+	var pairs [][]interface{}
+	for _, td := range touched {
+		empID, ok := holder(td.Tag, td.Date)
+		day := EmployeeDay{EmployeeID: empID, Date: td.Date}
+		if !ok || seen[day] {
+			continue
+		}
+		seen[day] = true
+		days = append(days, day)
+		for _, tag := range cards.TagsHeldBy(empByID[empID], td.Date) {
+			pairs = append(pairs, []interface{}{tag, td.Date})
+		}
+	}
+	if len(days) == 0 {
+		return nil, nil
+	}
+
+	var records []*model.ClockinRecord
+	if err := db.Where("(tag, date) IN ?", pairs).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	groups := GroupRecordsByEmployee(records, func(r *model.ClockinRecord) (int32, bool) {
+		return holder(r.Tag, r.Date)
+	})
+
+	devices, err := LoadDeviceRegistry(db)
+	if err != nil {
+		return nil, err
+	}
+	geofences, err := LoadGeofences(db)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]AttendanceEvent, 0, len(days))
+	jobIDs := make([]int32, 0, len(days))
+	for _, day := range days {
+		emp := empByID[day.EmployeeID]
+		event := AttendanceEvent{
+			Date:       day.Date,
+			EmployeeID: emp.EmployeeID,
+			Code:       emp.Code,
+			FirstName:  emp.FirstName,
+			Surname:    emp.Surname,
+			ProjectID:  emp.JobID,
+		}
+		if g := groups[day]; g != nil {
+			event.RecordCount = len(g.Records)
+			event.ClockOn = formatBrisbaneClock(g.GetClockIn())
+			if event.RecordCount >= 2 {
+				event.ClockOff = formatBrisbaneClock(g.GetClockOut())
+			}
+			event.DeviceID = g.GetDeviceID()
+			event.DeviceArea = devices.Area(event.DeviceID)
+			event.OffSite = geofences.OffSite(emp, g.Records)
+			if projectID := devices.DefaultProject(event.DeviceID); projectID != 0 {
+				event.ProjectID = projectID
+			}
+		}
+		events = append(events, event)
+		jobIDs = append(jobIDs, event.ProjectID)
+	}
+
+	var jobs []models.Job
+	if err := db.Where("JobId IN ?", jobIDs).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	jobByID := make(map[int32]models.Job, len(jobs))
+	for _, j := range jobs {
+		jobByID[j.JobID] = j
+	}
+	for i := range events {
+		if job, ok := jobByID[events[i].ProjectID]; ok {
+			events[i].ProjectCode = job.JobNo
+			events[i].ProjectName = job.Description
+		}
+	}
+	return events, nil
+}
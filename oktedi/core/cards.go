@@ -0,0 +1,366 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"axiapac.com/axiapac/core/models"
+	"axiapac.com/axiapac/oktedi/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCardNotFound    = errors.New("card not found")
+	ErrCardUnavailable = errors.New("card is lost or revoked")
+	ErrCardStatus      = errors.New("card status must be lost, revoked or unassigned")
+	ErrCardDate        = errors.New("effective date is before the employee's current card was assigned")
+	ErrEmployeeMissing = errors.New("employee not found")
+)
+
+// cardHistoryStart is the effective date given to cards held before the
+// registry tracked them (migration 010 seeds the same).
+const cardHistoryStart = "2000-01-01"
+
+// CardInUseError rejects assigning a card another employee holds.
+type CardInUseError struct {
+	Tag        string
+	EmployeeID int32
+}
+
+func (e *CardInUseError) Error() string {
+	return fmt.Sprintf("card %s is assigned to employee %d", e.Tag, e.EmployeeID)
+}
+
+// CardHistory is a card's assignments, oldest first.
+type CardHistory []model.CardAssignment
+
+// HolderOn returns the employee who held the card on date (YYYY-MM-DD).
+func (h CardHistory) HolderOn(date string) (int32, bool) {
+	// Latest first, so a same-day handover goes to the new holder.
+	for i := len(h) - 1; i >= 0; i-- {
+		if h[i].Holds(date) {
+			return h[i].EmployeeID, true
+		}
+	}
+	return 0, false
+}
+
+// CardHolders maps each card the registry tracks to its history. Tags it has
+// no history for are resolved by Employees.IdentificationTag instead.
+type CardHolders map[string]CardHistory
+
+func LoadCardHolders(db *gorm.DB) (CardHolders, error) {
+	var rows []model.CardAssignment
+	if err := db.Order("effective_from, id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	holders := make(CardHolders)
+	for _, a := range rows {
+		holders[a.Tag] = append(holders[a.Tag], a)
+	}
+	return holders, nil
+}
+
+// EmployeeOn resolves tag to the employee who held the card on date: from its
+// history when the registry tracks the card, otherwise byTag, the employees
+// keyed by IdentificationTag.
+func (h CardHolders) EmployeeOn(tag, date string, byID map[int32]models.Employee, byTag map[string]models.Employee) (models.Employee, bool) {
+	if history, ok := h[tag]; ok {
+		id, held := history.HolderOn(date)
+		if !held {
+			return models.Employee{}, false
+		}
+		emp, ok := byID[id]
+		return emp, ok
+	}
+	emp, ok := byTag[tag]
+	return emp, ok
+}
+
+// TagsHeldBy returns the cards emp held on date: the registry's, plus emp's
+// current tag if the registry doesn't track it.
+func (h CardHolders) TagsHeldBy(emp models.Employee, date string) []string {
+	var tags []string
+	for tag, history := range h {
+		for _, a := range history {
+			if a.EmployeeID == emp.EmployeeID && a.Holds(date) {
+				tags = append(tags, tag)
+				break
+			}
+		}
+	}
+	if _, tracked := h[emp.IdentificationTag]; emp.IdentificationTag != "" && !tracked {
+		tags = append(tags, emp.IdentificationTag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// ShiftTags returns the cards emp held on date or the day after: those the
+// taps of a shift starting on date can be on, night shifts included.
+func (h CardHolders) ShiftTags(emp models.Employee, date string) []string {
+	tags := append(h.TagsHeldBy(emp, date), h.TagsHeldBy(emp, nextDate(date))...)
+	sort.Strings(tags)
+	return slices.Compact(tags)
+}
+
+// ShiftTagsOn is ShiftTags for a single employee, read from the database.
+func ShiftTagsOn(db *gorm.DB, emp models.Employee, date string) ([]string, error) {
+	holders, err := LoadEmployeeCards(db, []models.Employee{emp})
+	if err != nil {
+		return nil, err
+	}
+	return holders.ShiftTags(emp, date), nil
+}
+
+// LoadEmployeeCards loads the histories of every card emps have held and of
+// their current tags: enough for TagsHeldBy and HolderOn on those employees
+// without reading the whole registry.
+func LoadEmployeeCards(db *gorm.DB, emps []models.Employee) (CardHolders, error) {
+	holders := make(CardHolders)
+	if len(emps) == 0 {
+		return holders, nil
+	}
+	ids := make([]int32, 0, len(emps))
+	tags := make([]string, 0, len(emps))
+	for _, e := range emps {
+		ids = append(ids, e.EmployeeID)
+		if e.IdentificationTag != "" {
+			tags = append(tags, e.IdentificationTag)
+		}
+	}
+	query := db.Where("employee_id IN ?", ids)
+	if len(tags) > 0 {
+		query = db.Where("employee_id IN ? OR tag IN ?", ids, tags)
+	}
+	var rows []model.CardAssignment
+	if err := query.Order("effective_from, id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range rows {
+		holders[a.Tag] = append(holders[a.Tag], a)
+	}
+	return holders, nil
+}
+
+// CardAssignments returns an employee's card history, latest first.
+func CardAssignments(db *gorm.DB, employeeID int32) ([]model.CardAssignment, error) {
+	var rows []model.CardAssignment
+	err := db.Where("employee_id = ?", employeeID).Order("effective_from DESC, id DESC").Find(&rows).Error
+	return rows, err
+}
+
+// GetCard returns a card and its history, latest first.
+func GetCard(db *gorm.DB, tag string) (*model.Card, []model.CardAssignment, error) {
+	var card model.Card
+	if err := db.Where("tag = ?", tag).Take(&card).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrCardNotFound
+		}
+		return nil, nil, err
+	}
+	var rows []model.CardAssignment
+	if err := db.Where("tag = ?", tag).Order("effective_from DESC, id DESC").Find(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	return &card, rows, nil
+}
+
+// AssignCard gives employeeID the card tag from date `from` (YYYY-MM-DD),
+// ending the card they held before, and sets it as their IdentificationTag.
+// An empty tag takes their card back. The card must not be lost or revoked,
+// nor held by anyone else after `from`; a card handed back on `from` can be
+// assigned from `from`. Run it in a transaction (core.RetryTransaction).
+func AssignCard(db *gorm.DB, employeeID int32, tag, from string, userID int32) error {
+	var emp models.Employee
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("EmployeeId = ?", employeeID).Take(&emp).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrEmployeeMissing
+		}
+		return err
+	}
+
+	var current *model.CardAssignment
+	var open model.CardAssignment
+	err := db.Where("employee_id = ? AND effective_to IS NULL", employeeID).
+		Order("effective_from DESC, id DESC").Take(&open).Error
+	switch {
+	case err == nil:
+		current = &open
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+	if current == nil && emp.IdentificationTag != "" {
+		// A tag set outside the registry: record it as held all along, so
+		// taps before this change still resolve to emp.
+		if current, err = adoptCard(db, emp, userID); err != nil {
+			return err
+		}
+	}
+	if current == nil && tag == "" && emp.IdentificationTag == "" {
+		return nil
+	}
+	if current != nil && current.Tag == tag {
+		return nil
+	}
+	// The current card is ended the day before from, which must leave it at
+	// least a day.
+	if current != nil && from <= current.EffectiveFrom {
+		return ErrCardDate
+	}
+
+	var card model.Card
+	if tag != "" {
+		// Register a new card before locking it: locking a missing row takes
+		// a gap lock, on which two assignments of new cards deadlock.
+		if err := db.Clauses(clause.Insert{Modifier: "IGNORE"}).
+			Create(&model.Card{Tag: tag, Status: model.CardUnassigned}).Error; err != nil {
+			return err
+		}
+		if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("tag = ?", tag).Take(&card).Error; err != nil {
+			return err
+		}
+		if card.Status == model.CardLost || card.Status == model.CardRevoked {
+			return ErrCardUnavailable
+		}
+		var others []model.CardAssignment
+		if err := db.Where("tag = ? AND employee_id <> ?", tag, employeeID).Find(&others).Error; err != nil {
+			return err
+		}
+		for _, a := range others {
+			if a.HeldAfter(from) {
+				return &CardInUseError{Tag: tag, EmployeeID: a.EmployeeID}
+			}
+		}
+		// Tags set before the registry existed, or outside it.
+		var other models.Employee
+		err := db.Select("EmployeeId").Where("IdentificationTag = ? AND EmployeeId <> ?", tag, employeeID).Take(&other).Error
+		if err == nil {
+			return &CardInUseError{Tag: tag, EmployeeID: other.EmployeeID}
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	if current != nil {
+		if err := endAssignment(db, current, dayBefore(from), model.CardUnassigned); err != nil {
+			return err
+		}
+	}
+	if tag != "" {
+		card.Status = model.CardActive
+		if err := db.Save(&card).Error; err != nil {
+			return err
+		}
+		if err := db.Create(&model.CardAssignment{
+			Tag:           tag,
+			EmployeeID:    employeeID,
+			EffectiveFrom: from,
+			AssignedBy:    userID,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return db.Model(&models.Employee{}).Where("EmployeeId = ?", employeeID).
+		Update("IdentificationTag", tag).Error
+}
+
+// SetCardStatus marks a card lost, revoked or unassigned (handed back). The
+// holder keeps it through date `on` (YYYY-MM-DD) and loses it as their
+// IdentificationTag. A revoked card can't change again. Run it in a
+// transaction.
+func SetCardStatus(db *gorm.DB, tag, status, notes, on string) (*model.Card, error) {
+	switch status {
+	case model.CardLost, model.CardRevoked, model.CardUnassigned:
+	default:
+		return nil, ErrCardStatus
+	}
+
+	var card model.Card
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("tag = ?", tag).Take(&card).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCardNotFound
+		}
+		return nil, err
+	}
+	if card.Status == model.CardRevoked {
+		return nil, ErrCardUnavailable
+	}
+
+	var open model.CardAssignment
+	err := db.Where("tag = ? AND effective_to IS NULL", tag).Take(&open).Error
+	switch {
+	case err == nil:
+		if err := endAssignment(db, &open, on, status); err != nil {
+			return nil, err
+		}
+		if err := db.Model(&models.Employee{}).
+			Where("EmployeeId = ? AND IdentificationTag = ?", open.EmployeeID, tag).
+			Update("IdentificationTag", "").Error; err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	card.Status = status
+	card.Notes = notes
+	if err := db.Save(&card).Error; err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// adoptCard records emp's untracked IdentificationTag as held since
+// cardHistoryStart. It returns nil if someone else holds the tag in the
+// registry, since emp's tag is then stale.
+func adoptCard(db *gorm.DB, emp models.Employee, userID int32) (*model.CardAssignment, error) {
+	var count int64
+	if err := db.Model(&model.CardAssignment{}).
+		Where("tag = ? AND effective_to IS NULL", emp.IdentificationTag).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, nil
+	}
+	card := model.Card{Tag: emp.IdentificationTag, Status: model.CardActive}
+	if err := db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"status", "updated_at"}),
+	}).Create(&card).Error; err != nil {
+		return nil, err
+	}
+	a := model.CardAssignment{
+		Tag:           emp.IdentificationTag,
+		EmployeeID:    emp.EmployeeID,
+		EffectiveFrom: cardHistoryStart,
+		AssignedBy:    userID,
+	}
+	if err := db.Create(&a).Error; err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// endAssignment closes a at date `to` and puts its card in status.
+func endAssignment(db *gorm.DB, a *model.CardAssignment, to string, status string) error {
+	if err := db.Model(a).Update("effective_to", to).Error; err != nil {
+		return err
+	}
+	return db.Model(&model.Card{}).Where("tag = ?", a.Tag).Update("status", status).Error
+}
+
+// dayBefore returns the date before a YYYY-MM-DD date.
+func dayBefore(date string) string {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return d.AddDate(0, 0, -1).Format("2006-01-02")
+}
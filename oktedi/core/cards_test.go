@@ -0,0 +1,126 @@
+package core
+
+import (
+	"testing"
+
+	"axiapac.com/axiapac/core/models"
+	"axiapac.com/axiapac/oktedi/model"
+	"axiapac.com/axiapac/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Card A was employee 1's until they lost it on Jan 10; it went to employee 2
+// on Jan 12. Card B replaced it for employee 1 on Jan 11, and employee 1 handed
+// it straight to employee 3 on Jan 20.
+var testCards = CardHolders{
+	"A": {
+		{Tag: "A", EmployeeID: 1, EffectiveFrom: "2000-01-01", EffectiveTo: utils.Ptr("2026-01-10")},
+		{Tag: "A", EmployeeID: 2, EffectiveFrom: "2026-01-12"},
+	},
+	"B": {
+		{Tag: "B", EmployeeID: 1, EffectiveFrom: "2026-01-11", EffectiveTo: utils.Ptr("2026-01-20")},
+		{Tag: "B", EmployeeID: 3, EffectiveFrom: "2026-01-20"},
+	},
+}
+
+func TestCardHistoryHolderOn(t *testing.T) {
+	tests := []struct {
+		tag, date string
+		holder    int32
+		held      bool
+	}{
+		{"A", "2025-06-01", 1, true},
+		{"A", "2026-01-10", 1, true},
+		{"A", "2026-01-11", 0, false},
+		{"A", "2026-01-12", 2, true},
+		{"B", "2026-01-10", 0, false},
+		{"B", "2026-01-19", 1, true},
+		{"B", "2026-01-20", 3, true}, // same-day handover: the new holder
+	}
+	for _, tt := range tests {
+		holder, held := testCards[tt.tag].HolderOn(tt.date)
+		assert.Equal(t, tt.held, held, "%s on %s", tt.tag, tt.date)
+		assert.Equal(t, tt.holder, holder, "%s on %s", tt.tag, tt.date)
+	}
+}
+
+func TestCardHoldersTagsHeldBy(t *testing.T) {
+	emp1 := models.Employee{EmployeeID: 1, IdentificationTag: "B"}
+	assert.Equal(t, []string{"A"}, testCards.TagsHeldBy(emp1, "2026-01-05"))
+	assert.Equal(t, []string{"B"}, testCards.TagsHeldBy(emp1, "2026-01-15"))
+	assert.Empty(t, testCards.TagsHeldBy(emp1, "2026-01-25"))
+
+	// A tag the registry doesn't track counts as held by its current holder.
+	emp4 := models.Employee{EmployeeID: 4, IdentificationTag: "LEGACY"}
+	assert.Equal(t, []string{"LEGACY"}, testCards.TagsHeldBy(emp4, "2026-01-15"))
+}
+
+func TestCardHoldersShiftTags(t *testing.T) {
+	emp1 := models.Employee{EmployeeID: 1, IdentificationTag: "B"}
+	// A night shift from the 10th ends on the 11th, on card B.
+	assert.Equal(t, []string{"A", "B"}, testCards.ShiftTags(emp1, "2026-01-10"))
+	assert.Equal(t, []string{"B"}, testCards.ShiftTags(emp1, "2026-01-15"))
+}
+
+func TestCardHoldersEmployeeOn(t *testing.T) {
+	byID := map[int32]models.Employee{1: {EmployeeID: 1}, 2: {EmployeeID: 2}, 4: {EmployeeID: 4}}
+	byTag := map[string]models.Employee{"A": byID[2], "LEGACY": byID[4]}
+
+	emp, ok := testCards.EmployeeOn("A", "2026-01-05", byID, byTag)
+	assert.True(t, ok)
+	assert.Equal(t, int32(1), emp.EmployeeID, "the holder then, not today's")
+	_, ok = testCards.EmployeeOn("A", "2026-01-11", byID, byTag)
+	assert.False(t, ok, "nobody held it")
+	emp, ok = testCards.EmployeeOn("LEGACY", "2026-01-05", byID, byTag)
+	assert.True(t, ok)
+	assert.Equal(t, int32(4), emp.EmployeeID)
+}
+
+func TestGroupRecordsByEmployee(t *testing.T) {
+	// Employee 1 lost card A on Jan 10 and has B from Jan 11. Nobody held A
+	// on the 11th, so its tap that day is left out.
+	records := []*model.ClockinRecord{
+		{Tag: "A", Date: "2026-01-10", Timestamp: "2026-01-10T05:00:00Z"},
+		{Tag: "A", Date: "2026-01-10", Timestamp: "2026-01-09T21:00:00Z"},
+		{Tag: "B", Date: "2026-01-11", Timestamp: "2026-01-11T05:00:00Z"},
+		{Tag: "A", Date: "2026-01-11", Timestamp: "2026-01-10T21:00:00Z"},
+	}
+	groups := GroupRecordsByEmployee(records, func(r *model.ClockinRecord) (int32, bool) {
+		return testCards[r.Tag].HolderOn(r.Date)
+	})
+
+	assert.Len(t, groups, 2)
+	day := groups[EmployeeDay{EmployeeID: 1, Date: "2026-01-10"}]
+	if assert.NotNil(t, day) {
+		assert.Equal(t, "2026-01-09T21:00:00Z", day.GetClockIn(), "sorted by time")
+		assert.Equal(t, "A", day.Tag)
+	}
+	day = groups[EmployeeDay{EmployeeID: 1, Date: "2026-01-11"}]
+	if assert.NotNil(t, day) {
+		assert.Len(t, day.Records, 1)
+	}
+}
+
+func TestCardAssignmentHolds(t *testing.T) {
+	a := model.CardAssignment{EffectiveFrom: "2026-01-12", EffectiveTo: utils.Ptr("2026-01-14")}
+	assert.False(t, a.Holds("2026-01-11"))
+	assert.True(t, a.Holds("2026-01-12"))
+	assert.True(t, a.Holds("2026-01-14"))
+	assert.False(t, a.Holds("2026-01-15"))
+}
+
+func TestCardSameDayHandover(t *testing.T) {
+	// Employee 1 hands card C back today; SetCardStatus keeps it theirs
+	// through today.
+	returned := model.CardAssignment{Tag: "C", EmployeeID: 1, EffectiveFrom: "2026-01-05", EffectiveTo: utils.Ptr("2026-01-20")}
+	assert.False(t, returned.HeldAfter("2026-01-20"), "free to assign from today")
+	assert.True(t, returned.HeldAfter("2026-01-19"), "still held yesterday")
+	assert.True(t, model.CardAssignment{EffectiveFrom: "2026-01-05"}.HeldAfter("2030-01-01"))
+
+	// Assigned to employee 2 from today, today's taps go to them.
+	history := CardHistory{returned, {Tag: "C", EmployeeID: 2, EffectiveFrom: "2026-01-20"}}
+	holder, _ := history.HolderOn("2026-01-20")
+	assert.Equal(t, int32(2), holder)
+	holder, _ = history.HolderOn("2026-01-19")
+	assert.Equal(t, int32(1), holder)
+}
@@ -0,0 +1,239 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"axiapac.com/axiapac/core"
+	"axiapac.com/axiapac/core/models"
+	"axiapac.com/axiapac/oktedi/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// DeviceAccessTokenTTL is the lifetime of a kiosk access token. Kept short
+	// so a revoked device loses access within minutes, at its next refresh.
+	DeviceAccessTokenTTL = 15 * time.Minute
+	// DeviceRefreshTokenTTL is how long a kiosk may stay offline and still
+	// refresh. Each refresh rotates the token and restarts the window.
+	DeviceRefreshTokenTTL = 30 * 24 * time.Hour
+	// DeviceEnrollmentCodeTTL bounds how long an unredeemed enrollment code
+	// stays valid.
+	DeviceEnrollmentCodeTTL = 24 * time.Hour
+)
+
+var (
+	ErrDeviceNotFound        = errors.New("device not found")
+	ErrDeviceRevoked         = errors.New("device has been revoked")
+	ErrInvalidEnrollmentCode = errors.New("invalid or expired enrollment code")
+	ErrInvalidRefreshToken   = errors.New("invalid or expired refresh token")
+	ErrKioskUserAdmin        = errors.New("a kiosk cannot act as a system administrator")
+)
+
+// CreateDeviceEnrollment issues a one-time enrollment code for deviceID, acting
+// as userID once enrolled. The user must exist and must not be a system
+// administrator (ErrKioskUserAdmin), since every token the kiosk gets carries
+// their rights. Re-issuing a code for a known device (including a revoked one)
+// replaces its credentials: the old refresh token stops working and the device
+// must enroll again. The plain code is returned once and only its hash is
+// stored.
+func CreateDeviceEnrollment(db *gorm.DB, deviceID string, userID int32, now time.Time) (string, error) {
+	var user models.User
+	if err := db.Select("Id", "SysAdmin").Where("Id = ?", userID).Take(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", core.ErrUserNotFound
+		}
+		return "", err
+	}
+	if user.SysAdmin {
+		return "", ErrKioskUserAdmin
+	}
+
+	code, err := randomSecret(6)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := now.Add(DeviceEnrollmentCodeTTL)
+	device := model.Device{ID: deviceID}
+	if err := db.Where(model.Device{ID: deviceID}).FirstOrInit(&device).Error; err != nil {
+		return "", err
+	}
+	device.UserID = userID
+	device.EnrollmentCodeHash = hashSecret(code)
+	device.EnrollmentExpiresAt = &expiresAt
+	device.EnrolledAt = nil
+	device.RefreshTokenHash = ""
+	device.RefreshExpiresAt = nil
+	device.RevokedAt = nil
+
+	if err := db.Save(&device).Error; err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// DeviceGrant is what a kiosk gets from enrolling or refreshing.
+type DeviceGrant struct {
+	Device       *model.Device
+	RefreshToken string
+	// SecurityStamp is the kiosk user's, for the access token.
+	SecurityStamp string
+}
+
+// EnrollDevice redeems an enrollment code for the device's first refresh
+// token. The code is consumed, so a second attempt fails. The kiosk's user
+// is checked first: a code for a deactivated or locked-out user is refused
+// but stays valid. Run it in a transaction.
+func EnrollDevice(db *gorm.DB, deviceID string, code string, now time.Time) (*DeviceGrant, error) {
+	device, err := findDevice(db.Clauses(clause.Locking{Strength: "UPDATE"}), deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device.RevokedAt != nil {
+		return nil, ErrDeviceRevoked
+	}
+	if device.EnrollmentCodeHash == "" || device.EnrollmentExpiresAt == nil || now.After(*device.EnrollmentExpiresAt) ||
+		!secretMatches(code, device.EnrollmentCodeHash) {
+		return nil, ErrInvalidEnrollmentCode
+	}
+	stamp, err := kioskUserStamp(db, device, now)
+	if err != nil {
+		return nil, err
+	}
+
+	device.EnrollmentCodeHash = ""
+	device.EnrollmentExpiresAt = nil
+	device.EnrolledAt = &now
+	refreshToken, err := rotateRefreshToken(device, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Save(device).Error; err != nil {
+		return nil, err
+	}
+	return &DeviceGrant{Device: device, RefreshToken: refreshToken, SecurityStamp: stamp}, nil
+}
+
+// RefreshDevice exchanges the device's current refresh token for a new one.
+// Only the latest token is accepted, so a copied token stops working as soon as
+// the real kiosk refreshes. As with EnrollDevice, the user is checked before
+// the token rotates. Run it in a transaction.
+func RefreshDevice(db *gorm.DB, deviceID string, refreshToken string, now time.Time) (*DeviceGrant, error) {
+	device, err := findDevice(db, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device.RevokedAt != nil {
+		return nil, ErrDeviceRevoked
+	}
+	if device.RefreshTokenHash == "" || device.RefreshExpiresAt == nil || now.After(*device.RefreshExpiresAt) ||
+		!secretMatches(refreshToken, device.RefreshTokenHash) {
+		return nil, ErrInvalidRefreshToken
+	}
+	stamp, err := kioskUserStamp(db, device, now)
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := rotateRefreshToken(device, now)
+	if err != nil {
+		return nil, err
+	}
+	// Compare-and-swap on the old hash so two concurrent refreshes with the
+	// same token can't both succeed.
+	res := db.Model(&model.Device{}).
+		Where("id = ? AND refresh_token_hash = ?", deviceID, hashSecret(refreshToken)).
+		Updates(map[string]interface{}{
+			"refresh_token_hash": device.RefreshTokenHash,
+			"refresh_expires_at": device.RefreshExpiresAt,
+		})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+	return &DeviceGrant{Device: device, RefreshToken: next, SecurityStamp: stamp}, nil
+}
+
+// kioskUserStamp returns the security stamp of the user the kiosk acts as, or
+// why they can't sign in (core.ErrUserDeactivated, core.ErrUserLockedOut,
+// core.ErrUserNotFound). The kiosk's tokens carry the stamp, so deactivating
+// the user or rotating their stamp cuts the kiosk off too.
+func kioskUserStamp(db *gorm.DB, device *model.Device, now time.Time) (string, error) {
+	state, err := core.LoadUserState(db, device.UserID)
+	if err != nil {
+		return "", err
+	}
+	if err := state.Validate(state.SecurityStamp, now); err != nil {
+		return "", err
+	}
+	return state.SecurityStamp, nil
+}
+
+// RevokeDevice blocks a device: its refresh token and any pending enrollment
+// code stop working. Access tokens already issued lapse within
+// DeviceAccessTokenTTL.
+func RevokeDevice(db *gorm.DB, deviceID string, now time.Time) error {
+	res := db.Model(&model.Device{}).Where("id = ?", deviceID).Updates(map[string]interface{}{
+		"revoked_at":            now,
+		"refresh_token_hash":    "",
+		"refresh_expires_at":    nil,
+		"enrollment_code_hash":  "",
+		"enrollment_expires_at": nil,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+func findDevice(db *gorm.DB, deviceID string) (*model.Device, error) {
+	var device model.Device
+	if err := db.Where("id = ?", deviceID).Take(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDeviceNotFound
+		}
+		return nil, err
+	}
+	return &device, nil
+}
+
+func rotateRefreshToken(device *model.Device, now time.Time) (string, error) {
+	token, err := randomSecret(32)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := now.Add(DeviceRefreshTokenTTL)
+	device.RefreshTokenHash = hashSecret(token)
+	device.RefreshExpiresAt = &expiresAt
+	return token, nil
+}
+
+// randomSecret returns n random bytes, URL-safe base64 encoded.
+func randomSecret(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func secretMatches(secret string, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(hash)) == 1
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"errors"
+	"time"
+
+	"axiapac.com/axiapac/core/models"
+	"axiapac.com/axiapac/oktedi/model"
+	"gorm.io/gorm"
+)
+
+var ErrUnknownProject = errors.New("unknown project")
+
+// DeviceRegistry is the registered kiosks keyed by device id, for resolving the
+// device_id stamped on clock-in records. Revoked kiosks stay in it so their
+// earlier taps still resolve. A nil registry resolves nothing.
+type DeviceRegistry map[string]model.Device
+
+func LoadDeviceRegistry(db *gorm.DB) (DeviceRegistry, error) {
+	devices, err := ListDevices(db)
+	if err != nil {
+		return nil, err
+	}
+	registry := make(DeviceRegistry, len(devices))
+	for _, d := range devices {
+		registry[d.ID] = d
+	}
+	return registry, nil
+}
+
+// Area returns the area the device sits in, "" when it is unregistered or has
+// no area.
+func (r DeviceRegistry) Area(deviceID string) string {
+	return r[deviceID].Area
+}
+
+// DefaultProject returns the project the device's taps are booked to, 0 when
+// it has none.
+func (r DeviceRegistry) DefaultProject(deviceID string) int32 {
+	if d, ok := r[deviceID]; ok && d.DefaultProjectID != nil {
+		return *d.DefaultProjectID
+	}
+	return 0
+}
+
+// DeviceDetails are the registry fields an admin edits.
+type DeviceDetails struct {
+	Name             string
+	Area             string
+	DefaultProjectID *int32
+}
+
+func ListDevices(db *gorm.DB) ([]model.Device, error) {
+	var devices []model.Device
+	err := db.Order("id").Find(&devices).Error
+	return devices, err
+}
+
+func GetDevice(db *gorm.DB, deviceID string) (*model.Device, error) {
+	return findDevice(db, deviceID)
+}
+
+// SaveDeviceDetails sets the registry details of deviceID, registering it if
+// it is unknown so a kiosk can be set up before it enrolls.
+func SaveDeviceDetails(db *gorm.DB, deviceID string, details DeviceDetails) (*model.Device, error) {
+	if details.DefaultProjectID != nil {
+		var count int64
+		if err := db.Model(&models.Job{}).Where("JobId = ?", *details.DefaultProjectID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, ErrUnknownProject
+		}
+	}
+
+	device := model.Device{ID: deviceID}
+	if err := db.Where(model.Device{ID: deviceID}).FirstOrInit(&device).Error; err != nil {
+		return nil, err
+	}
+	device.Name = details.Name
+	device.Area = details.Area
+	device.DefaultProjectID = details.DefaultProjectID
+	if err := db.Save(&device).Error; err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// TouchDevice records a push from deviceID: its last-seen time and, when the
+// kiosk reports one, its app version. Unregistered ids are ignored.
+func TouchDevice(db *gorm.DB, deviceID string, appVersion string, now time.Time) error {
+	values := map[string]interface{}{"last_seen_at": now}
+	if appVersion != "" {
+		values["app_version"] = appVersion
+	}
+	return db.Model(&model.Device{}).Where("id = ?", deviceID).Updates(values).Error
+}
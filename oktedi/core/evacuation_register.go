@@ -23,17 +23,6 @@ const (
 	oktediLogoHeight = 50.0
 )
 
-// DeviceArea maps a clock-in device_id to the physical area it sits in. Only
-// employees whose clock-in device is in this map appear on the evacuation
-// register, and each is tagged with its device's area; anyone who clocked in at
-// an unmapped device (or not at all) is excluded. Hardcoded for now — this is
-// the reference to revisit when areas become data-driven (e.g. sourced from the
-// device registry or the employee Attributes `area`).
-var DeviceArea = map[string]string{
-	"351494370028086": "FIFO Village",
-	"351494370029795": "FIFO Village",
-}
-
 // EvacuationRegisterPDF renders the Major Projects Attendance/ Evacuation
 // Register for `date` as a PDF byte slice, replicating OTML's paper register
 // layout: landscape A4, one section per roster panel (each starting a new page),
@@ -42,21 +31,22 @@ var DeviceArea = map[string]string{
 //
 // `rows` are the attendance rows for the date (from LoadAttendance, already
 // scoped to the desired project). This applies the register's own rules — keep
-// only employees who CLOCKED IN (RecordCount > 0) at a mapped device, tag each
-// with that device's area, and drop everyone else — so the result is a muster
+// only employees who CLOCKED IN (RecordCount > 0) at a device with an area in
+// the device registry (DeviceArea), tag each with that area, and drop everyone
+// else — so the result is a muster
 // snapshot of who is actually on site. `generatedAt` (Brisbane) stamps the
 // footer.
 //
 // Returns a pure []byte so callers can stream it and, later, persist it for
 // audit without touching the renderer.
 func EvacuationRegisterPDF(rows []AttendanceRow, date time.Time, generatedAt time.Time) ([]byte, error) {
-	// Keep only employees who clocked in at a device mapped to an area.
+	// Keep only employees who clocked in at a device with an area.
 	registerRows := make([]AttendanceRow, 0, len(rows))
 	for _, r := range rows {
 		if r.RecordCount <= 0 {
 			continue
 		}
-		if _, ok := DeviceArea[r.DeviceID]; !ok {
+		if r.DeviceArea == "" {
 			continue
 		}
 		registerRows = append(registerRows, r)
@@ -285,7 +275,7 @@ func EvacuationRegisterPDF(rows []AttendanceRow, date time.Time, generatedAt tim
 			if y+groupHeaderH+colHeaderH+rowH+rowGap > contentBottom {
 				newPage()
 			}
-			y += drawGroupHeader(y, employerLines, departmentLines, DeviceArea[first.DeviceID], shaded)
+			y += drawGroupHeader(y, employerLines, departmentLines, first.DeviceArea, shaded)
 			y += drawColumnHeader(y)
 			y += rowGap
 
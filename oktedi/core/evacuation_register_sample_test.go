@@ -8,21 +8,21 @@ import (
 
 // TestEvacuationRegisterPDFSample renders a representative register to the
 // scratchpad for visual inspection and asserts basic validity + that the
-// clocked-in/mapped-device filter is applied.
+// clocked-in/device-area filter is applied.
 func TestEvacuationRegisterPDFSample(t *testing.T) {
 	clk := func(s string) *string { return &s }
 	rows := []AttendanceRow{
-		// Panel A / Employer Acme — two mapped-device, clocked-in employees.
-		{Code: "1002", FirstName: "Jane", Surname: "Smith", Classification: "Boilermaker", Panel: "Panel 1", Employer: "Acme Contracting Pty Ltd", Department: "Projects BU Maintenance", ProjectID: 10, RecordCount: 1, ClockOn: clk("06:12"), DeviceID: "351494370028086"},
-		{Code: "1010", FirstName: "Bob", Surname: "Jones", Classification: "Rigger", Panel: "Panel 1", Employer: "Acme Contracting Pty Ltd", Department: "Projects BU Maintenance", ProjectID: 10, RecordCount: 2, ClockOn: clk("06:30"), DeviceID: "351494370029795"},
+		// Panel A / Employer Acme — two clocked-in employees.
+		{Code: "1002", FirstName: "Jane", Surname: "Smith", Classification: "Boilermaker", Panel: "Panel 1", Employer: "Acme Contracting Pty Ltd", Department: "Projects BU Maintenance", ProjectID: 10, RecordCount: 1, ClockOn: clk("06:12"), DeviceID: "351494370028086", DeviceArea: "FIFO Village"},
+		{Code: "1010", FirstName: "Bob", Surname: "Jones", Classification: "Rigger", Panel: "Panel 1", Employer: "Acme Contracting Pty Ltd", Department: "Projects BU Maintenance", ProjectID: 10, RecordCount: 2, ClockOn: clk("06:30"), DeviceID: "351494370029795", DeviceArea: "FIFO Village"},
 		// Same panel, different employer (tests zebra shading + sorting).
-		{Code: "2001", FirstName: "Alice", Surname: "Nguyen", Classification: "Electrician with a very long classification name", Panel: "Panel 1", Employer: "Beta Services", Department: "Projects BU Electrical Distribution and Controls", ProjectID: 10, RecordCount: 1, ClockOn: clk("05:58"), DeviceID: "351494370028086"},
+		{Code: "2001", FirstName: "Alice", Surname: "Nguyen", Classification: "Electrician with a very long classification name", Panel: "Panel 1", Employer: "Beta Services", Department: "Projects BU Electrical Distribution and Controls", ProjectID: 10, RecordCount: 1, ClockOn: clk("05:58"), DeviceID: "351494370028086", DeviceArea: "FIFO Village"},
 		// Second panel.
-		{Code: "3005", FirstName: "Charlie", Surname: "Okoro", Classification: "Supervisor", Panel: "Panel 2", Employer: "Acme Contracting Pty Ltd", Department: "Projects BU Civil", ProjectID: 20, RecordCount: 1, ClockOn: clk("06:00"), DeviceID: "351494370029795"},
-		// EXCLUDED: clocked in but unmapped device.
+		{Code: "3005", FirstName: "Charlie", Surname: "Okoro", Classification: "Supervisor", Panel: "Panel 2", Employer: "Acme Contracting Pty Ltd", Department: "Projects BU Civil", ProjectID: 20, RecordCount: 1, ClockOn: clk("06:00"), DeviceID: "351494370029795", DeviceArea: "FIFO Village"},
+		// EXCLUDED: clocked in at a device with no area.
 		{Code: "9001", FirstName: "Dan", Surname: "Excluded", Classification: "Fitter", Panel: "Panel 1", Employer: "Acme Contracting Pty Ltd", Department: "Projects BU Maintenance", ProjectID: 10, RecordCount: 1, ClockOn: clk("07:00"), DeviceID: "999999999999999"},
-		// EXCLUDED: mapped device but no clock-in (rostered absent).
-		{Code: "9002", FirstName: "Eve", Surname: "Absent", Classification: "Fitter", Panel: "Panel 1", Employer: "Acme Contracting Pty Ltd", Department: "Projects BU Maintenance", ProjectID: 10, RecordCount: 0, DeviceID: "351494370028086"},
+		// EXCLUDED: device with an area but no clock-in (rostered absent).
+		{Code: "9002", FirstName: "Eve", Surname: "Absent", Classification: "Fitter", Panel: "Panel 1", Employer: "Acme Contracting Pty Ltd", Department: "Projects BU Maintenance", ProjectID: 10, RecordCount: 0, DeviceID: "351494370028086", DeviceArea: "FIFO Village"},
 	}
 
 	date := time.Date(2026, 7, 3, 0, 0, 0, 0, time.UTC)
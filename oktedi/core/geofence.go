@@ -0,0 +1,151 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"axiapac.com/axiapac/core/models"
+	"axiapac.com/axiapac/oktedi/model"
+	"gorm.io/gorm"
+)
+
+// Metres per degree, for the local flat projection used near a site. Good to
+// well under a metre over a few kilometres, which is all a geofence spans.
+const (
+	metresPerDegreeLat = 110574.0
+	metresPerDegreeLng = 111320.0 // at the equator; scaled by cos(latitude)
+)
+
+var (
+	ErrInvalidGeofence  = errors.New("invalid geofence")
+	ErrWorkSiteNotFound = errors.New("work site not found")
+)
+
+// ValidateGeofence checks that polygon is usable as a geofence: at least three
+// vertices, all valid coordinates.
+func ValidateGeofence(polygon model.GeoPolygon) error {
+	if len(polygon) < 3 {
+		return fmt.Errorf("%w: at least 3 vertices are required", ErrInvalidGeofence)
+	}
+	for i, p := range polygon {
+		if p.Lat < -90 || p.Lat > 90 || p.Lng < -180 || p.Lng > 180 {
+			return fmt.Errorf("%w: vertex %d (%g, %g) is not a valid coordinate", ErrInvalidGeofence, i, p.Lat, p.Lng)
+		}
+	}
+	return nil
+}
+
+// InsideGeofence reports whether point lies in polygon, or within accuracy
+// metres of its edge so an imprecise fix near the boundary isn't flagged. It
+// needs no network or map service, so it works wherever the polygon is known.
+// Polygons crossing the antimeridian are not supported.
+func InsideGeofence(polygon model.GeoPolygon, point model.GeoPoint, accuracy float64) bool {
+	if len(polygon) < 3 {
+		return true
+	}
+
+	// Project onto a plane in metres around the point: x east, y north.
+	scale := metresPerDegreeLng * math.Cos(point.Lat*math.Pi/180)
+	xy := func(p model.GeoPoint) (float64, float64) {
+		return (p.Lng - point.Lng) * scale, (p.Lat - point.Lat) * metresPerDegreeLat
+	}
+
+	// Ray casting from the point (the origin) along +x.
+	inside := false
+	nearest := math.Inf(1)
+	for i := range polygon {
+		ax, ay := xy(polygon[i])
+		bx, by := xy(polygon[(i+1)%len(polygon)])
+		if (ay > 0) != (by > 0) && ax+(0-ay)*(bx-ax)/(by-ay) > 0 {
+			inside = !inside
+		}
+		nearest = math.Min(nearest, distanceToSegment(ax, ay, bx, by))
+	}
+	return inside || nearest <= accuracy
+}
+
+// distanceToSegment is the distance from the origin to the segment a-b.
+func distanceToSegment(ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if lenSq := dx*dx + dy*dy; lenSq > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/lenSq))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
+
+// Geofences maps WorkSiteId to the site's geofence. A nil map checks nothing.
+type Geofences map[int32]model.GeoPolygon
+
+func LoadGeofences(db *gorm.DB) (Geofences, error) {
+	var rows []model.WorkSiteGeofence
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	geofences := make(Geofences, len(rows))
+	for _, r := range rows {
+		geofences[r.WorkSiteID] = r.Polygon
+	}
+	return geofences, nil
+}
+
+// OffSite reports whether any of the records was tapped outside the geofence
+// of emp's work site. Taps without a GPS fix, and employees whose site has no
+// geofence, are never off site.
+func (g Geofences) OffSite(emp models.Employee, records []*model.ClockinRecord) bool {
+	polygon, ok := g[emp.WorkSiteID]
+	if !ok {
+		return false
+	}
+	for _, r := range records {
+		if r.Latitude == nil || r.Longitude == nil {
+			continue
+		}
+		accuracy := 0.0
+		if r.Accuracy != nil {
+			accuracy = *r.Accuracy
+		}
+		if !InsideGeofence(polygon, model.GeoPoint{Lat: *r.Latitude, Lng: *r.Longitude}, accuracy) {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveGeofence sets the geofence of a WorkSites row, replacing any earlier one.
+func SaveGeofence(db *gorm.DB, workSiteID int32, polygon model.GeoPolygon) (*model.WorkSiteGeofence, error) {
+	if err := ValidateGeofence(polygon); err != nil {
+		return nil, err
+	}
+	var count int64
+	if err := db.Model(&models.WorkSite{}).Where("WorkSiteId = ?", workSiteID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrWorkSiteNotFound
+	}
+
+	geofence := model.WorkSiteGeofence{WorkSiteID: workSiteID}
+	if err := db.Where(model.WorkSiteGeofence{WorkSiteID: workSiteID}).FirstOrInit(&geofence).Error; err != nil {
+		return nil, err
+	}
+	geofence.Polygon = polygon
+	if err := db.Save(&geofence).Error; err != nil {
+		return nil, err
+	}
+	return &geofence, nil
+}
+
+// DeleteGeofence removes a work site's geofence, so its taps are no longer
+// checked.
+func DeleteGeofence(db *gorm.DB, workSiteID int32) error {
+	res := db.Where("work_site_id = ?", workSiteID).Delete(&model.WorkSiteGeofence{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrWorkSiteNotFound
+	}
+	return nil
+}
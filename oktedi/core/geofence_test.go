@@ -0,0 +1,60 @@
+package core
+
+import (
+	"testing"
+
+	"axiapac.com/axiapac/core/models"
+	"axiapac.com/axiapac/oktedi/model"
+	"axiapac.com/axiapac/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// A ~1.1 km square near Tabubil, plus a notch cut into its east side.
+var testSite = model.GeoPolygon{
+	{Lat: -5.270, Lng: 141.220},
+	{Lat: -5.270, Lng: 141.230},
+	{Lat: -5.274, Lng: 141.230},
+	{Lat: -5.275, Lng: 141.226},
+	{Lat: -5.276, Lng: 141.230},
+	{Lat: -5.280, Lng: 141.230},
+	{Lat: -5.280, Lng: 141.220},
+}
+
+func TestInsideGeofence(t *testing.T) {
+	tests := []struct {
+		name     string
+		point    model.GeoPoint
+		accuracy float64
+		inside   bool
+	}{
+		{"centre", model.GeoPoint{Lat: -5.275, Lng: 141.222}, 0, true},
+		{"in the notch", model.GeoPoint{Lat: -5.275, Lng: 141.228}, 0, false},
+		{"north of the site", model.GeoPoint{Lat: -5.268, Lng: 141.225}, 0, false},
+		// ~220 m north of the boundary.
+		{"outside, fix within accuracy", model.GeoPoint{Lat: -5.268, Lng: 141.225}, 250, true},
+		{"outside, fix beyond accuracy", model.GeoPoint{Lat: -5.268, Lng: 141.225}, 150, false},
+		{"far away", model.GeoPoint{Lat: -6.0, Lng: 143.0}, 50, false},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.inside, InsideGeofence(testSite, tc.point, tc.accuracy), tc.name)
+	}
+}
+
+func TestValidateGeofence(t *testing.T) {
+	assert.NoError(t, ValidateGeofence(testSite))
+	assert.ErrorIs(t, ValidateGeofence(testSite[:2]), ErrInvalidGeofence)
+	assert.ErrorIs(t, ValidateGeofence(model.GeoPolygon{{Lat: 0, Lng: 0}, {Lat: 91, Lng: 0}, {Lat: 0, Lng: 1}}), ErrInvalidGeofence)
+}
+
+func TestGeofencesOffSite(t *testing.T) {
+	geofences := Geofences{1: testSite}
+	at := func(lat, lng float64) *model.ClockinRecord {
+		return &model.ClockinRecord{Latitude: utils.Ptr(lat), Longitude: utils.Ptr(lng)}
+	}
+	onSite := models.Employee{WorkSiteID: 1}
+
+	assert.False(t, geofences.OffSite(onSite, []*model.ClockinRecord{at(-5.275, 141.222), {}}))
+	assert.True(t, geofences.OffSite(onSite, []*model.ClockinRecord{at(-5.275, 141.222), at(-5.268, 141.225)}))
+	assert.False(t, geofences.OffSite(models.Employee{WorkSiteID: 2}, []*model.ClockinRecord{at(-5.268, 141.225)}), "site without a geofence")
+	assert.False(t, Geofences(nil).OffSite(onSite, []*model.ClockinRecord{at(-5.268, 141.225)}))
+}
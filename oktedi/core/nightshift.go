@@ -0,0 +1,158 @@
+package core
+
+import (
+	"time"
+
+	"axiapac.com/axiapac/core/models"
+	"axiapac.com/axiapac/oktedi/model"
+	"axiapac.com/axiapac/utils"
+	"gorm.io/gorm"
+)
+
+// ShiftDate returns the date (YYYY-MM-DD) of the shift a tap at t belongs to.
+// Taps go to their Brisbane calendar date, except early taps after a night
+// shift, one whose defined finish is before its start (e.g. 18:00–06:00).
+// Those belong to the previous day's shift, up to halfway between its finish
+// and its next start, or up to the day's own defined start if that is sooner.
+func ShiftDate(
+	t time.Time,
+	emp models.Employee,
+	empWorkHours map[int32]map[int32]models.EmployeeWorkHour,
+	regionWorkHours map[int32]map[int32]models.RegionWorkHour,
+) string {
+	local := t.In(utils.BrisbaneTZ)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, utils.BrisbaneTZ)
+	prev := day.AddDate(0, 0, -1)
+	if cutoff, ok := nightShiftCutoff(prev, emp, empWorkHours, regionWorkHours); ok && local.Before(cutoff) {
+		return prev.Format("2006-01-02")
+	}
+	return day.Format("2006-01-02")
+}
+
+// nightShiftCutoff returns when taps stop counting towards day's shift the
+// next morning, if day's defined hours cross midnight.
+func nightShiftCutoff(
+	day time.Time,
+	emp models.Employee,
+	empWorkHours map[int32]map[int32]models.EmployeeWorkHour,
+	regionWorkHours map[int32]map[int32]models.RegionWorkHour,
+) (time.Time, bool) {
+	def, found := GetDefinedWorkHours(day, emp, empWorkHours, regionWorkHours)
+	if !found {
+		return time.Time{}, false
+	}
+	start, err1 := ParseTimeOnDate(day, def.Start)
+	finish, err2 := ParseTimeOnDate(day, def.Finish)
+	if err1 != nil || err2 != nil || !finish.Before(start) {
+		return time.Time{}, false
+	}
+	finish = finish.Add(24 * time.Hour)
+	cutoff := finish.Add(start.Add(24*time.Hour).Sub(finish) / 2)
+
+	// A day shift the next morning starts the next day's work.
+	next := day.AddDate(0, 0, 1)
+	if nextDef, ok := GetDefinedWorkHours(next, emp, empWorkHours, regionWorkHours); ok {
+		if nextStart, err := ParseTimeOnDate(next, nextDef.Start); err == nil && nextStart.After(finish) && nextStart.Before(cutoff) {
+			cutoff = nextStart
+		}
+	}
+	return cutoff, true
+}
+
+// recordsForShiftDate keeps the taps whose shift is on date: the date's own
+// taps, less those finishing the previous day's night shift, plus the next
+// day's taps finishing this date's. Kept taps carry the shift date, so they
+// group with the rest of their shift. Taps whose tag resolves to no employee
+// stay on their calendar date.
+func recordsForShiftDate(date string, records []*model.ClockinRecord, refData *ReferenceData) []*model.ClockinRecord {
+	kept := make([]*model.ClockinRecord, 0, len(records))
+	for _, r := range records {
+		shiftDate := r.Date
+		if emp, ok := refData.employeeForTag(r.Tag, r.Date); ok {
+			if t, err := utils.ParseISOTime(r.Timestamp); err == nil {
+				shiftDate = ShiftDate(*t, emp, refData.EmpWorkHours, refData.RegionWorkHours)
+			}
+		}
+		if shiftDate != date {
+			continue
+		}
+		if r.Date != date {
+			moved := *r
+			moved.Date = date
+			r = &moved
+		}
+		kept = append(kept, r)
+	}
+	return kept
+}
+
+// ShiftClockinRecords reads the taps of emp's shift on date (YYYY-MM-DD) made
+// with the given cards, as Prepare attributes them: a night shift includes its
+// taps after midnight.
+func ShiftClockinRecords(db *gorm.DB, emp models.Employee, tags []string, date string) ([]model.ClockinRecord, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	empWHMap, regionWHMap, err := loadWorkHours(db, emp)
+	if err != nil {
+		return nil, err
+	}
+	var records []model.ClockinRecord
+	if err := db.Where("tag IN ? AND date IN ?", tags, []string{date, nextDate(date)}).
+		Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	kept := records[:0]
+	for _, r := range records {
+		t, err := utils.ParseISOTime(r.Timestamp)
+		if err != nil {
+			if r.Date == date {
+				kept = append(kept, r)
+			}
+			continue
+		}
+		if ShiftDate(*t, emp, empWHMap, regionWHMap) == date {
+			kept = append(kept, r)
+		}
+	}
+	return kept, nil
+}
+
+// loadWorkHours reads emp's defined work hours, keyed as GetDefinedWorkHours
+// expects.
+func loadWorkHours(db *gorm.DB, emp models.Employee) (map[int32]map[int32]models.EmployeeWorkHour, map[int32]map[int32]models.RegionWorkHour, error) {
+	empWHMap := make(map[int32]map[int32]models.EmployeeWorkHour)
+	var empWorkHours []models.EmployeeWorkHour
+	if err := db.Where("EmployeeId = ?", emp.EmployeeID).Find(&empWorkHours).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, wh := range empWorkHours {
+		if _, ok := empWHMap[wh.EmployeeID]; !ok {
+			empWHMap[wh.EmployeeID] = make(map[int32]models.EmployeeWorkHour)
+		}
+		empWHMap[wh.EmployeeID][wh.DayOfWeek] = wh
+	}
+
+	regionWHMap := make(map[int32]map[int32]models.RegionWorkHour)
+	var regionWorkHours []models.RegionWorkHour
+	if err := db.Where("CalendarRegionId = ?", emp.CalendarRegionID).Find(&regionWorkHours).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, wh := range regionWorkHours {
+		if _, ok := regionWHMap[wh.CalendarRegionID]; !ok {
+			regionWHMap[wh.CalendarRegionID] = make(map[int32]models.RegionWorkHour)
+		}
+		regionWHMap[wh.CalendarRegionID][wh.DayOfWeek] = wh
+	}
+	return empWHMap, regionWHMap, nil
+}
+
+// nextDate returns the date after a YYYY-MM-DD date.
+func nextDate(date string) string {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return d.AddDate(0, 0, 1).Format("2006-01-02")
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"axiapac.com/axiapac/core/models"
+	"axiapac.com/axiapac/oktedi/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Employee 50 works nights Monday to Thursday (18:00–06:00) and a Friday day
+// shift (07:00–15:00).
+func nightShiftRefData() *ReferenceData {
+	emp := models.Employee{EmployeeID: 50, IdentificationTag: "TAG50", JobID: 1}
+	refData := baseRefData([]models.Employee{emp}, map[int32]models.PayrollTimeType{})
+	night := models.EmployeeWorkHour{EmployeeID: 50, Start: "18:00", Finish: "06:00"}
+	refData.EmpWorkHours = map[int32]map[int32]models.EmployeeWorkHour{
+		50: {1: night, 2: night, 3: night, 4: night, 5: {EmployeeID: 50, Start: "07:00", Finish: "15:00"}},
+	}
+	return refData
+}
+
+// brisbane is a Brisbane wall-clock time in January 2026.
+func brisbane(day, hour, minute int) time.Time {
+	return time.Date(2026, 1, day, hour, minute, 0, 0, time.FixedZone("AEST", 10*3600))
+}
+
+func TestShiftDate(t *testing.T) {
+	require.Equal(t, time.Monday, brisbane(12, 0, 0).Weekday())
+	refData := nightShiftRefData()
+	emp := refData.EmpMap[50]
+
+	tests := []struct {
+		name string
+		tap  time.Time
+		date string
+	}{
+		{"Monday night start", brisbane(12, 18, 5), "2026-01-12"},
+		{"Monday night finish", brisbane(13, 5, 55), "2026-01-12"},
+		{"late finish, before the midpoint", brisbane(13, 11, 59), "2026-01-12"},
+		{"midpoint starts the next day", brisbane(13, 12, 0), "2026-01-13"},
+		{"Tuesday night start", brisbane(13, 17, 50), "2026-01-13"},
+		{"Thursday night finish", brisbane(16, 6, 10), "2026-01-15"},
+		{"Friday day shift cuts Thursday's night short", brisbane(16, 7, 0), "2026-01-16"},
+		{"after a day shift", brisbane(17, 5, 0), "2026-01-17"},
+		{"Monday morning, after a day off", brisbane(12, 5, 0), "2026-01-12"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.date, ShiftDate(tt.tap.UTC(), emp, refData.EmpWorkHours, refData.RegionWorkHours))
+		})
+	}
+}
+
+func TestNightShiftPrepare(t *testing.T) {
+	refData := nightShiftRefData()
+	tap := func(id, tag string, at time.Time) *model.ClockinRecord {
+		return &model.ClockinRecord{ID: id, Tag: tag, Timestamp: at.UTC().Format(time.RFC3339), Date: at.Format("2006-01-02")}
+	}
+	// Prepare for Monday reads Monday's and Tuesday's taps.
+	records := []*model.ClockinRecord{
+		tap("mon-in", "TAG50", brisbane(12, 18, 2)),
+		tap("mon-out", "TAG50", brisbane(13, 6, 3)),
+		tap("tue-in", "TAG50", brisbane(13, 17, 58)),
+		tap("unknown", "NOBODY", brisbane(13, 5, 0)),
+	}
+
+	monday := recordsForShiftDate("2026-01-12", records, refData)
+	require.Len(t, monday, 2)
+	assert.Equal(t, "mon-in", monday[0].ID)
+	assert.Equal(t, "mon-out", monday[1].ID)
+	assert.Equal(t, "2026-01-12", monday[1].Date)
+	assert.Equal(t, "2026-01-13", records[1].Date, "the fetched record is left as is")
+
+	tuesday := recordsForShiftDate("2026-01-13", records, refData)
+	require.Len(t, tuesday, 2)
+	assert.Equal(t, "tue-in", tuesday[0].ID)
+	assert.Equal(t, "unknown", tuesday[1].ID)
+
+	// One timesheet, dated Monday, snapped to the defined 18:00–06:00.
+	date := time.Date(2026, 1, 12, 0, 0, 0, 0, time.UTC)
+	timesheetMap := map[int32]model.OktediTimesheet{}
+	processed, errored := processClockInRecords(date, monday, refData, timesheetMap)
+	assert.ElementsMatch(t, []string{"mon-in", "mon-out"}, processed)
+	assert.Empty(t, errored)
+	removeSeconds(timesheetMap)
+	applySnappingRules(timesheetMap, refData)
+
+	ts := timesheetMap[50]
+	assert.Equal(t, date, ts.Date)
+	assert.Equal(t, time.Date(2026, 1, 12, 18, 0, 0, 0, time.UTC), ts.StartTime)
+	assert.Equal(t, time.Date(2026, 1, 13, 6, 0, 0, 0, time.UTC), ts.FinishTime)
+	assert.InDelta(t, 12.0, ts.Hours, 1e-9)
+	assert.Equal(t, "", ts.ReviewStatus)
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"errors"
+	"path"
+
+	"axiapac.com/axiapac/oktedi/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxPhotoSize caps a clock-in photo upload, in bytes.
+const MaxPhotoSize = 5 << 20
+
+// PhotoContentTypes are the image types a kiosk may upload.
+var PhotoContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// ErrPhotoDevice rejects a photo from a device other than the one that made
+// the tap, or than the one that sent the photo it would replace.
+var ErrPhotoDevice = errors.New("photo must come from the device that made the tap")
+
+// PhotoKey is where a tap's photo is kept in the photo store. Keys start with
+// the tenant so tenants can share a bucket.
+func PhotoKey(tenant, recordID string) string {
+	return path.Join(tenant, "records", recordID)
+}
+
+// SaveRecordPhoto stores a photo's details, replacing any earlier photo of the
+// same tap.
+func SaveRecordPhoto(db *gorm.DB, photo *model.RecordPhoto) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "record_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"storage_key", "content_type", "size", "sha256", "device_id", "updated_at"}),
+	}).Create(photo).Error
+}
+
+// CheckPhotoDevice returns ErrPhotoDevice unless deviceID made the tap (when
+// the server has it yet) and sent any photo the tap already has. Run it in the
+// transaction saving the photo; it locks the photo row.
+func CheckPhotoDevice(db *gorm.DB, recordID, deviceID string) error {
+	var record model.ClockinRecord
+	err := db.Unscoped().Select("id", "device_id").Where("id = ?", recordID).Take(&record).Error
+	switch {
+	case err == nil:
+		if record.DeviceID != deviceID {
+			return ErrPhotoDevice
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	var photo model.RecordPhoto
+	err = db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("record_id = ?", recordID).Take(&photo).Error
+	switch {
+	case err == nil:
+		if photo.DeviceID != deviceID {
+			return ErrPhotoDevice
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+	return nil
+}
+
+// LoadRecordPhotos returns the photos of the given taps, by record id. Taps
+// without a photo are left out.
+func LoadRecordPhotos(db *gorm.DB, recordIDs []string) (map[string]model.RecordPhoto, error) {
+	photos := make(map[string]model.RecordPhoto)
+	if len(recordIDs) == 0 {
+		return photos, nil
+	}
+	var rows []model.RecordPhoto
+	if err := db.Where("record_id IN ?", recordIDs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range rows {
+		photos[p.RecordID] = p
+	}
+	return photos, nil
+}
@@ -6,6 +6,7 @@ import (
 	"sort"
 	"time"
 
+	"axiapac.com/axiapac/core"
 	"axiapac.com/axiapac/core/models"
 	"axiapac.com/axiapac/oktedi/model"
 	"axiapac.com/axiapac/utils"
@@ -48,6 +49,15 @@ type ReferenceData struct {
 	EmpWorkHours    map[int32]map[int32]models.EmployeeWorkHour
 	RegionWorkHours map[int32]map[int32]models.RegionWorkHour
 	TimeTypeMap     map[int32]models.PayrollTimeType
+	Devices         DeviceRegistry
+	Geofences       Geofences
+	Cards           CardHolders
+}
+
+// employeeForTag resolves a tap's tag to the employee who held the card on
+// date. Tags the card registry doesn't track go to the current holder.
+func (r *ReferenceData) employeeForTag(tag, date string) (models.Employee, bool) {
+	return r.Cards.EmployeeOn(tag, date, r.EmpMap, r.TagMap)
 }
 
 func ProcessClockInRecordsWithFilters(db *gorm.DB, date time.Time, opts PrepareOptions, summary *PrepareSummary) error {
@@ -60,10 +70,11 @@ func ProcessClockInRecordsWithFilters(db *gorm.DB, date time.Time, opts PrepareO
 	}
 
 	// 2. Fetch Records
-	supervisorRecords, clockInRecords, err := fetchRecords(db, dateStr, opts, refData.Employees)
+	supervisorRecords, clockInRecords, err := fetchRecords(db, dateStr, opts, refData)
 	if err != nil {
 		return err
 	}
+	clockInRecords = recordsForShiftDate(dateStr, clockInRecords, refData)
 
 	// 3. Process Records
 	// Map EmployeeID -> OktediTimesheet
@@ -193,6 +204,21 @@ func fetchReferenceData(db *gorm.DB) (*ReferenceData, error) {
 		ttMap[tt.PayrollTimeTypeID] = tt
 	}
 
+	devices, err := LoadDeviceRegistry(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch devices: %w", err)
+	}
+
+	geofences, err := LoadGeofences(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch geofences: %w", err)
+	}
+
+	cards, err := LoadCardHolders(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch card assignments: %w", err)
+	}
+
 	return &ReferenceData{
 		Employees:       employees,
 		EmpMap:          empMap,
@@ -202,10 +228,13 @@ func fetchReferenceData(db *gorm.DB) (*ReferenceData, error) {
 		EmpWorkHours:    empWHMap,
 		RegionWorkHours: regionWHMap,
 		TimeTypeMap:     ttMap,
+		Devices:         devices,
+		Geofences:       geofences,
+		Cards:           cards,
 	}, nil
 }
 
-func fetchRecords(db *gorm.DB, dateStr string, opts PrepareOptions, employees []models.Employee) ([]model.SupervisorRecord, []*model.ClockinRecord, error) {
+func fetchRecords(db *gorm.DB, dateStr string, opts PrepareOptions, refData *ReferenceData) ([]model.SupervisorRecord, []*model.ClockinRecord, error) {
 	fmt.Println("Fetching records...")
 	var supervisorRecords []model.SupervisorRecord
 	supQuery := db.Where("date = ?", dateStr)
@@ -220,11 +249,12 @@ func fetchRecords(db *gorm.DB, dateStr string, opts PrepareOptions, employees []
 		return nil, nil, fmt.Errorf("failed to fetch supervisor records: %w", err)
 	}
 
+	// The next day's taps too: a night shift finishes after midnight.
 	var clockInRecords []*model.ClockinRecord
-	clkQuery := db.Where("date = ?", dateStr)
+	clkQuery := db.Where("date IN ?", []string{dateStr, nextDate(dateStr)})
 	if len(opts.Employees) > 0 || len(opts.Supervisors) > 0 {
 		var validTags []string
-		for _, e := range employees {
+		for _, e := range refData.Employees {
 			match := true
 			if len(opts.Employees) > 0 {
 				found := false
@@ -247,8 +277,8 @@ func fetchRecords(db *gorm.DB, dateStr string, opts PrepareOptions, employees []
 				match = match && found
 			}
 
-			if match && e.IdentificationTag != "" {
-				validTags = append(validTags, e.IdentificationTag)
+			if match {
+				validTags = append(validTags, refData.Cards.ShiftTags(e, dateStr)...)
 			}
 		}
 
@@ -277,7 +307,7 @@ func processClockInRecords(date time.Time, clockInRecords []*model.ClockinRecord
 			groupIDs[i] = r.ID
 		}
 
-		emp, ok := refData.TagMap[g.Tag]
+		emp, ok := refData.employeeForTag(g.Tag, g.Date)
 		if !ok {
 			fmt.Printf("Warning: No employee found for tag %s\n", g.Tag)
 			errorIDs = append(errorIDs, groupIDs...)
@@ -305,10 +335,22 @@ func processClockInRecords(date time.Time, clockInRecords []*model.ClockinRecord
 			continue
 		}
 
+		// Only time inside in/out segments is worked, so a worker who leaves
+		// site and comes back isn't paid for the gap. Start and finish still
+		// span every tap.
+		segments, unmatched := g.Segments()
+		hours, err := WorkedHours(segments)
+		if err != nil {
+			fmt.Printf("Warning: Failed to parse time for %s: %v\n", g.Tag, err)
+			errorIDs = append(errorIDs, groupIDs...)
+			continue
+		}
+
 		ts := model.OktediTimesheet{
 			EmployeeID:   emp.EmployeeID,
 			Date:         date,
-			Hours:        endTime.Sub(*startTime).Hours(),
+			Hours:        hours,
+			Gap:          math.Max(0, endTime.Sub(*startTime).Hours()-hours),
 			StartTime:    *startTime,
 			FinishTime:   *endTime,
 			ReviewStatus: "",
@@ -322,6 +364,22 @@ func processClockInRecords(date time.Time, clockInRecords []*model.ClockinRecord
 		if emp.CostCentreID != 0 {
 			ts.CostCentreID = utils.Ptr(emp.CostCentreID)
 		}
+		// A kiosk with a default project books the taps there; the employee's
+		// cost centre is kept only if that project has it.
+		if projectID := refData.Devices.DefaultProject(g.GetDeviceID()); projectID != 0 && projectID != emp.JobID {
+			ts.ProjectID = utils.Ptr(projectID)
+			if !jobHasCostCentre(refData.JobCCMap[projectID], emp.CostCentreID) {
+				ts.CostCentreID = nil
+			}
+		}
+		// Both are kept by updateReviewStatus, like "absent". Unmatched taps
+		// win: the hours leave them out until a reviewer settles them.
+		switch {
+		case len(unmatched) > 0:
+			ts.ReviewStatus = "unmatched"
+		case refData.Geofences.OffSite(emp, g.Records):
+			ts.ReviewStatus = "off-site"
+		}
 
 		timesheetMap[emp.EmployeeID] = ts
 		processedIDs = append(processedIDs, groupIDs...)
@@ -330,6 +388,18 @@ func processClockInRecords(date time.Time, clockInRecords []*model.ClockinRecord
 	return processedIDs, errorIDs
 }
 
+func jobHasCostCentre(jobCCs map[string]models.CostCentre, costCentreID int32) bool {
+	if costCentreID == 0 {
+		return false
+	}
+	for _, cc := range jobCCs {
+		if cc.CostCentreID == costCentreID {
+			return true
+		}
+	}
+	return false
+}
+
 func applySupervisorRecords(date time.Time, supervisorRecords []model.SupervisorRecord, timesheetMap map[int32]model.OktediTimesheet, refData *ReferenceData) {
 	// Sort by ID ascending so that later records overwrite earlier ones
 	sort.Slice(supervisorRecords, func(i, j int) bool {
@@ -354,6 +424,7 @@ func applySupervisorRecords(date time.Time, supervisorRecords []model.Supervisor
 			ts.Hours = duration.Hours()
 			ts.StartTime = *rec.Clockin
 			ts.FinishTime = *rec.Clockout
+			ts.Gap = 0
 		} else if !exists {
 			// If creating new timesheet from supervisor record, use defined hours if available
 			if def, found := GetDefinedWorkHours(date, refData.EmpMap[empID], refData.EmpWorkHours, refData.RegionWorkHours); found {
@@ -403,12 +474,33 @@ func applySupervisorRecords(date time.Time, supervisorRecords []model.Supervisor
 	}
 }
 
+// persistTimesheets saves the day's timesheets in one transaction, retried on
+// deadlock (kiosk pushes write the same tables). The summary is only counted
+// for the attempt that commits.
 func persistTimesheets(db *gorm.DB, dateStr string, timesheetMap map[int32]model.OktediTimesheet, summary *PrepareSummary) error {
 	fmt.Printf("Saving %d timesheets to DB...\n", len(timesheetMap))
 	if len(timesheetMap) == 0 {
 		return nil
 	}
 
+	var run PrepareSummary
+	if err := core.RetryTransaction(db, func(tx *gorm.DB) error {
+		run = PrepareSummary{}
+		return saveTimesheets(tx, dateStr, timesheetMap, &run)
+	}); err != nil {
+		return err
+	}
+
+	if summary != nil {
+		summary.New += run.New
+		summary.Recomputed += run.Recomputed
+		summary.KeptApproved += run.KeptApproved
+		summary.KeptAbsent += run.KeptAbsent
+	}
+	return nil
+}
+
+func saveTimesheets(db *gorm.DB, dateStr string, timesheetMap map[int32]model.OktediTimesheet, summary *PrepareSummary) error {
 	var empIDs []int32
 	for id := range timesheetMap {
 		empIDs = append(empIDs, id)
@@ -487,7 +579,7 @@ func removeSeconds(timesheetMap map[int32]model.OktediTimesheet) {
 
 		// Recalculate hours
 		duration := ts.FinishTime.Sub(ts.StartTime)
-		ts.Hours = math.Max(0, duration.Hours())
+		ts.Hours = math.Max(0, duration.Hours()-ts.Gap)
 		timesheetMap[empID] = ts
 	}
 }
@@ -510,7 +602,7 @@ func applySnappingRules(timesheetMap map[int32]model.OktediTimesheet, refData *R
 
 		// Recalculate hours after snapping
 		duration := ts.FinishTime.Sub(ts.StartTime)
-		ts.Hours = math.Max(0, duration.Hours())
+		ts.Hours = math.Max(0, duration.Hours()-ts.Gap)
 		timesheetMap[empID] = ts
 	}
 }
@@ -528,6 +620,19 @@ func applyBreaks(timesheetMap map[int32]model.OktediTimesheet) {
 	}
 }
 
+// SpanHours is the ordinary hours a timesheet's start and finish give, worked
+// out as Prepare does: the span less the gap no segment covers, less the break
+// when the day is longer than it, less the overtime.
+func SpanHours(ts model.OktediTimesheet) float64 {
+	hours := math.Max(0, ts.FinishTime.Sub(ts.StartTime).Hours()-ts.Gap)
+	if ts.Break != nil && *ts.Break > 0 {
+		if breakHours := float64(*ts.Break) / 60.0; hours > breakHours {
+			hours -= breakHours
+		}
+	}
+	return math.Max(0, hours-ts.Overtime)
+}
+
 // applyOvertime moves work past the defined finish into the Overtime field.
 // Overtime applies only when the (snapped) finish is beyond the finish-late
 // tolerance window (defined finish + FinishLateThreshold); the overtime hours are
@@ -599,6 +704,12 @@ func updateReviewStatus(date time.Time, timesheetMap map[int32]model.OktediTimes
 			continue
 		}
 
+		// A tap outside the site's geofence, or one that pairs with no other,
+		// always needs review, whatever the hours.
+		if ts.ReviewStatus == "off-site" || ts.ReviewStatus == "unmatched" {
+			continue
+		}
+
 		// Layer 1: normal review status.
 		UpdateSingleReviewStatus(&ts, emp, refData.EmpWorkHours, refData.RegionWorkHours)
 
@@ -774,26 +885,11 @@ func RefreshReviewStatus(db *gorm.DB, ts *model.OktediTimesheet) error {
 		return err
 	}
 
-	empWHMap := make(map[int32]map[int32]models.EmployeeWorkHour)
-	var empWorkHours []models.EmployeeWorkHour
-	if err := db.Where("EmployeeId = ?", emp.EmployeeID).Find(&empWorkHours).Error; err == nil {
-		for _, wh := range empWorkHours {
-			if _, ok := empWHMap[wh.EmployeeID]; !ok {
-				empWHMap[wh.EmployeeID] = make(map[int32]models.EmployeeWorkHour)
-			}
-			empWHMap[wh.EmployeeID][wh.DayOfWeek] = wh
-		}
-	}
-
-	regionWHMap := make(map[int32]map[int32]models.RegionWorkHour)
-	var regionWorkHours []models.RegionWorkHour
-	if err := db.Where("CalendarRegionId = ?", emp.CalendarRegionID).Find(&regionWorkHours).Error; err == nil {
-		for _, wh := range regionWorkHours {
-			if _, ok := regionWHMap[wh.CalendarRegionID]; !ok {
-				regionWHMap[wh.CalendarRegionID] = make(map[int32]models.RegionWorkHour)
-			}
-			regionWHMap[wh.CalendarRegionID][wh.DayOfWeek] = wh
-		}
+	// Work hours are best-effort here: when they can't be read the status is
+	// judged without them rather than failing the edit.
+	empWHMap, regionWHMap, err := loadWorkHours(db, emp)
+	if err != nil {
+		empWHMap, regionWHMap = nil, nil
 	}
 
 	UpdateSingleReviewStatus(ts, emp, empWHMap, regionWHMap)
@@ -447,3 +447,140 @@ func TestProcessClockInRecordsAttributesNonActiveEmployee(t *testing.T) {
 	assert.Empty(t, errored)
 	assert.ElementsMatch(t, []string{"r1", "r2"}, processed)
 }
+
+// Taps at a kiosk with a default project are booked to that project. The
+// employee's cost centre follows only when the project has it.
+func TestProcessClockInRecordsDeviceDefaultProject(t *testing.T) {
+	emp := models.Employee{EmployeeID: 40, IdentificationTag: "TAG40", JobID: 1, CostCentreID: 7}
+	records := func(deviceID string) []*model.ClockinRecord {
+		return []*model.ClockinRecord{
+			{ID: "r1", Tag: "TAG40", Date: "2026-01-10", Timestamp: "2026-01-10T08:00:00Z", DeviceID: deviceID},
+			{ID: "r2", Tag: "TAG40", Date: "2026-01-10", Timestamp: "2026-01-10T16:00:00Z", DeviceID: deviceID},
+		}
+	}
+	refData := baseRefData([]models.Employee{emp}, map[int32]models.PayrollTimeType{})
+	refData.JobCCMap = map[int32]map[string]models.CostCentre{
+		2: {"CC7": {CostCentreID: 7, Code: "CC7"}},
+	}
+	refData.Devices = DeviceRegistry{
+		"village": {ID: "village", DefaultProjectID: utils.Ptr(int32(2))},
+		"plant":   {ID: "plant", DefaultProjectID: utils.Ptr(int32(3))},
+		"gate":    {ID: "gate"},
+	}
+
+	for _, tc := range []struct {
+		deviceID   string
+		project    int32
+		costCentre *int32
+	}{
+		{"village", 2, utils.Ptr(int32(7))},
+		{"plant", 3, nil},
+		{"gate", 1, utils.Ptr(int32(7))},
+		{"unregistered", 1, utils.Ptr(int32(7))},
+	} {
+		timesheetMap := map[int32]model.OktediTimesheet{}
+		processClockInRecords(testDate, records(tc.deviceID), refData, timesheetMap)
+		ts := timesheetMap[40]
+		require.NotNil(t, ts.ProjectID, tc.deviceID)
+		assert.Equal(t, tc.project, *ts.ProjectID, tc.deviceID)
+		assert.Equal(t, tc.costCentre, ts.CostCentreID, tc.deviceID)
+	}
+}
+
+func TestProcessClockInRecordsOffSite(t *testing.T) {
+	emp := models.Employee{EmployeeID: 41, IdentificationTag: "TAG41", JobID: 1, WorkSiteID: 5}
+	tap := func(id, ts string, lat, lng float64) *model.ClockinRecord {
+		return &model.ClockinRecord{ID: id, Tag: "TAG41", Date: "2026-01-10", Timestamp: ts,
+			Latitude: utils.Ptr(lat), Longitude: utils.Ptr(lng), Accuracy: utils.Ptr(10.0)}
+	}
+	refData := baseRefData([]models.Employee{emp}, map[int32]models.PayrollTimeType{})
+	refData.Geofences = Geofences{5: {{Lat: -5.0, Lng: 141.0}, {Lat: -5.0, Lng: 141.01}, {Lat: -5.01, Lng: 141.01}, {Lat: -5.01, Lng: 141.0}}}
+
+	timesheetMap := map[int32]model.OktediTimesheet{}
+	processClockInRecords(testDate, []*model.ClockinRecord{
+		tap("r1", "2026-01-10T08:00:00Z", -5.005, 141.005),
+		tap("r2", "2026-01-10T16:00:00Z", -5.005, 141.005),
+	}, refData, timesheetMap)
+	assert.Equal(t, "", timesheetMap[41].ReviewStatus)
+
+	timesheetMap = map[int32]model.OktediTimesheet{}
+	processClockInRecords(testDate, []*model.ClockinRecord{
+		tap("r1", "2026-01-10T08:00:00Z", -5.005, 141.005),
+		tap("r2", "2026-01-10T16:00:00Z", -5.2, 141.005),
+	}, refData, timesheetMap)
+	assert.Equal(t, "off-site", timesheetMap[41].ReviewStatus)
+}
+
+func TestProcessClockInRecordsCardHolderOnDate(t *testing.T) {
+	// Card TAG42 moved from employee 42 to employee 43 on Jan 10; 42 now holds
+	// TAG42B.
+	former := models.Employee{EmployeeID: 42, IdentificationTag: "TAG42B", JobID: 1}
+	current := models.Employee{EmployeeID: 43, IdentificationTag: "TAG42", JobID: 1}
+	refData := baseRefData([]models.Employee{former, current}, map[int32]models.PayrollTimeType{})
+	refData.Cards = CardHolders{
+		"TAG42": {
+			{Tag: "TAG42", EmployeeID: 42, EffectiveFrom: "2000-01-01", EffectiveTo: utils.Ptr("2026-01-09")},
+			{Tag: "TAG42", EmployeeID: 43, EffectiveFrom: "2026-01-10"},
+		},
+		"TAG42B": {
+			{Tag: "TAG42B", EmployeeID: 42, EffectiveFrom: "2026-01-10"},
+		},
+	}
+	taps := func(date string) []*model.ClockinRecord {
+		return []*model.ClockinRecord{
+			{ID: date + "-1", Tag: "TAG42", Date: date, Timestamp: date + "T08:00:00Z"},
+			{ID: date + "-2", Tag: "TAG42", Date: date, Timestamp: date + "T16:00:00Z"},
+		}
+	}
+
+	timesheetMap := map[int32]model.OktediTimesheet{}
+	processClockInRecords(rosterOnDate, taps("2026-01-09"), refData, timesheetMap)
+	assert.Contains(t, timesheetMap, int32(42))
+	assert.NotContains(t, timesheetMap, int32(43))
+
+	timesheetMap = map[int32]model.OktediTimesheet{}
+	processClockInRecords(testDate, taps("2026-01-10"), refData, timesheetMap)
+	assert.Contains(t, timesheetMap, int32(43))
+	assert.NotContains(t, timesheetMap, int32(42))
+
+	// A card nobody held on the date resolves to no one.
+	refData.Cards["TAG42"][0].EffectiveTo = utils.Ptr("2026-01-08")
+	timesheetMap = map[int32]model.OktediTimesheet{}
+	_, errorIDs := processClockInRecords(rosterOnDate, taps("2026-01-09"), refData, timesheetMap)
+	assert.Empty(t, timesheetMap)
+	assert.Len(t, errorIDs, 2)
+}
+
+func TestProcessClockInRecordsSegments(t *testing.T) {
+	emp := models.Employee{EmployeeID: 44, IdentificationTag: "TAG44", JobID: 1}
+	refData := baseRefData([]models.Employee{emp}, map[int32]models.PayrollTimeType{})
+	tap := func(id, kind, ts string) *model.ClockinRecord {
+		return &model.ClockinRecord{ID: id, Tag: "TAG44", Date: "2026-01-10", Kind: kind, Timestamp: "2026-01-10T" + ts + "Z"}
+	}
+
+	// Left site from 11:00 to 13:00: paid 8h, not the 10h span.
+	timesheetMap := map[int32]model.OktediTimesheet{}
+	processed, errored := processClockInRecords(testDate, []*model.ClockinRecord{
+		tap("r1", "in", "07:00:00"), tap("r2", "out", "11:00:00"),
+		tap("r3", "in", "13:00:00"), tap("r4", "out", "17:00:00"),
+	}, refData, timesheetMap)
+	assert.Len(t, processed, 4)
+	assert.Empty(t, errored)
+	// The later steps work hours out from the span again; the gap stays out.
+	removeSeconds(timesheetMap)
+	applySnappingRules(timesheetMap, refData)
+	ts := timesheetMap[44]
+	assert.InDelta(t, 8.0, ts.Hours, 1e-9)
+	assert.Equal(t, 10*time.Hour, ts.FinishTime.Sub(ts.StartTime))
+	assert.Equal(t, "", ts.ReviewStatus)
+
+	// A missed tap out before lunch: only the afternoon counts, and the day
+	// is flagged.
+	timesheetMap = map[int32]model.OktediTimesheet{}
+	processClockInRecords(testDate, []*model.ClockinRecord{
+		tap("r1", "in", "07:00:00"), tap("r3", "in", "13:00:00"), tap("r4", "out", "17:00:00"),
+	}, refData, timesheetMap)
+	ts = timesheetMap[44]
+	assert.InDelta(t, 4.0, ts.Hours, 1e-9)
+	assert.Equal(t, "unmatched", ts.ReviewStatus)
+}
@@ -100,3 +100,23 @@ func TestApplyOvertimeSkipsAbsent(t *testing.T) {
 	applyOvertime(tsMap, refData)
 	assert.Equal(t, 0.0, tsMap[empID].Overtime)
 }
+
+func TestSpanHours(t *testing.T) {
+	start := time.Date(2026, 1, 12, 7, 0, 0, 0, time.UTC)
+	brk := int32(30)
+	tests := []struct {
+		name     string
+		ts       model.OktediTimesheet
+		expected float64
+	}{
+		{"span less gap and break", model.OktediTimesheet{StartTime: start, FinishTime: start.Add(9 * time.Hour), Gap: 1, Break: &brk}, 7.5},
+		{"overtime is left out", model.OktediTimesheet{StartTime: start, FinishTime: start.Add(10 * time.Hour), Break: &brk, Overtime: 1}, 8.5},
+		{"break kept when the day is shorter", model.OktediTimesheet{StartTime: start, FinishTime: start.Add(time.Hour), Gap: 0.75, Break: &brk}, 0.25},
+		{"gap wider than the span", model.OktediTimesheet{StartTime: start, FinishTime: start.Add(time.Hour), Gap: 2}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.expected, SpanHours(tt.ts), 1e-9)
+		})
+	}
+}
@@ -0,0 +1,491 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"axiapac.com/axiapac/oktedi/model"
+	"axiapac.com/axiapac/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Collections served by the kiosk pull, named as the kiosk's WatermelonDB
+// tables.
+const (
+	SyncEmployees             = "employees"
+	SyncJobs                  = "jobs"
+	SyncJobCostCentres        = "job_cost_centres"
+	SyncSupervisorAssignments = "supervisor_assignments"
+)
+
+// SupervisorAssignmentSyncDays bounds the supervisor assignments served to
+// kiosks to the last two weeks; older ones are pulled as deleted.
+const SupervisorAssignmentSyncDays = 14
+
+// Raw WatermelonDB records: string ids and snake_case columns.
+
+type SyncEmployee struct {
+	ID           string  `json:"id"`
+	Code         string  `json:"code"`
+	Tag          string  `json:"tag"`
+	FirstName    string  `json:"first_name"`
+	LastName     string  `json:"last_name"`
+	Avatar       *string `json:"avatar"`
+	JobID        *string `json:"job_id"`
+	CostCentreID *string `json:"cost_centre_id"`
+	SupervisorID *string `json:"supervisor_id"`
+	BackToBackID *string `json:"back_to_back_id"`
+}
+
+type SyncJob struct {
+	ID          string `json:"id"`
+	JobNo       string `json:"job_no"`
+	Description string `json:"description"`
+}
+
+// SyncJobCostCentre is a cost centre on a job. A cost centre can be on several
+// jobs, so its id is "<job id>-<cost centre id>".
+type SyncJobCostCentre struct {
+	ID           string `json:"id"`
+	JobID        string `json:"job_id"`
+	CostCentreID string `json:"cost_centre_id"`
+	Code         string `json:"code"`
+	Description  string `json:"description"`
+}
+
+type SyncSupervisorAssignment struct {
+	ID           string `json:"id"`
+	SupervisorID string `json:"supervisor_id"`
+	EmployeeID   string `json:"employee_id"`
+	Project      string `json:"project"`
+	Wbs          string `json:"wbs"`
+	Date         string `json:"date"`
+	// Clock times as Unix milliseconds, WatermelonDB's date representation.
+	Clockin  *int64 `json:"clockin"`
+	Clockout *int64 `json:"clockout"`
+}
+
+// CollectionChanges is one collection of a WatermelonDB pull changeset.
+type CollectionChanges struct {
+	Created []any    `json:"created"`
+	Updated []any    `json:"updated"`
+	Deleted []string `json:"deleted"`
+}
+
+// PullResult is the WatermelonDB pull response. Timestamp (Unix milliseconds)
+// is the client's next lastPulledAt.
+type PullResult struct {
+	Changes   map[string]*CollectionChanges `json:"changes"`
+	Timestamp int64                         `json:"timestamp"`
+}
+
+// PullSync names the /pull collections' refresh in oktedi_sync_state.
+const PullSync = "pull"
+
+// SyncRefreshInterval is how often the sync rows are re-hashed from the source
+// tables. Pulls in between only read the rows as they stand, so they can use
+// the replica, and see source changes up to an interval late.
+const SyncRefreshInterval = time.Minute
+
+// ErrSyncStale means the sync rows were last refreshed more than
+// SyncRefreshInterval ago, or never: refresh them with RefreshSync first.
+var ErrSyncStale = errors.New("sync rows are due a refresh")
+
+// syncBatch bounds the ids loaded per query.
+const syncBatch = 500
+
+// SyncSource is a collection tracked in oktedi_sync_rows.
+type SyncSource struct {
+	Collection string
+	// Load returns the records currently served, keyed by id: all of them
+	// when ids is nil, otherwise those in ids.
+	Load func(db *gorm.DB, ids []string, now time.Time) (map[string]any, error)
+}
+
+// PullSources are the collections /pull serves.
+var PullSources = []SyncSource{
+	{SyncEmployees, loadSyncEmployees},
+	{SyncJobs, loadSyncJobs},
+	{SyncJobCostCentres, loadSyncJobCostCentres},
+	{SyncSupervisorAssignments, loadSyncSupervisorAssignments},
+}
+
+// Pull returns what changed in every served collection after `since` (the
+// zero time for a first pull), as of the last RefreshSync. Its timestamp is
+// that refresh. Pull only reads, so it can run on the replica; it returns
+// ErrSyncStale when the rows are due a refresh.
+func Pull(db *gorm.DB, since, now time.Time) (*PullResult, error) {
+	version, err := SyncVersion(db, PullSync, now)
+	if err != nil {
+		return nil, err
+	}
+	result := &PullResult{
+		Changes:   make(map[string]*CollectionChanges, len(PullSources)),
+		Timestamp: version.UnixMilli(),
+	}
+
+	for _, source := range PullSources {
+		var rows []model.SyncRow
+		if err := db.Where("collection = ? AND updated_at > ?", source.Collection, since.UTC()).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		// A first pull serves everything; later ones only the changed rows.
+		var ids []string
+		if !since.IsZero() {
+			ids = []string{}
+			for _, row := range rows {
+				if row.DeletedAt == nil {
+					ids = append(ids, row.RecordID)
+				}
+			}
+		}
+		current, err := LoadSyncRecords(db, source, ids, now)
+		if err != nil {
+			return nil, err
+		}
+		result.Changes[source.Collection] = classifySyncRows(rows, current, since)
+	}
+	return result, nil
+}
+
+// LoadSyncRecords is source.Load in batches: all records when ids is nil,
+// none when it is empty.
+func LoadSyncRecords(db *gorm.DB, source SyncSource, ids []string, now time.Time) (map[string]any, error) {
+	if ids == nil {
+		return source.Load(db, nil, now)
+	}
+	records := make(map[string]any, len(ids))
+	for start := 0; start < len(ids); start += syncBatch {
+		batch, err := source.Load(db, ids[start:min(start+syncBatch, len(ids))], now)
+		if err != nil {
+			return nil, err
+		}
+		for id, record := range batch {
+			records[id] = record
+		}
+	}
+	return records, nil
+}
+
+// SyncVersion returns when the sync `name` was last refreshed, the cursor for
+// what is read alongside it, or ErrSyncStale if it is due a refresh.
+func SyncVersion(db *gorm.DB, name string, now time.Time) (time.Time, error) {
+	var state model.SyncState
+	if err := db.Where("name = ?", name).Take(&state).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, ErrSyncStale
+		}
+		return time.Time{}, err
+	}
+	if syncStale(state.RefreshedAt, now) {
+		return time.Time{}, ErrSyncStale
+	}
+	return *state.RefreshedAt, nil
+}
+
+// RefreshSync re-hashes sources into oktedi_sync_rows unless another request
+// has within SyncRefreshInterval. It holds the lock on the sync's state row
+// throughout, so concurrent pulls refresh once. Run it in a transaction on the
+// primary.
+func RefreshSync(db *gorm.DB, name string, sources []SyncSource, now time.Time) error {
+	// Create the state row first so the lock is on a row, not a gap.
+	if err := db.Clauses(clause.Insert{Modifier: "IGNORE"}).Create(&model.SyncState{Name: name}).Error; err != nil {
+		return err
+	}
+	var state model.SyncState
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("name = ?", name).Take(&state).Error; err != nil {
+		return err
+	}
+	if !syncStale(state.RefreshedAt, now) {
+		return nil
+	}
+
+	stamp := refreshStamp(state.RefreshedAt, now)
+	for _, source := range sources {
+		current, err := source.Load(db, nil, stamp)
+		if err != nil {
+			return err
+		}
+		if err := refreshSyncRows(db, source.Collection, current, stamp); err != nil {
+			return err
+		}
+	}
+	return db.Model(&model.SyncState{}).Where("name = ?", name).Update("refreshed_at", stamp).Error
+}
+
+// ChangedSince returns the ids in collection created or changed, and those
+// deleted, after since, as of the last RefreshSync. It only reads.
+func ChangedSince(db *gorm.DB, collection string, since time.Time) (changed, deleted []string, err error) {
+	var rows []model.SyncRow
+	if err := db.Select("record_id", "deleted_at").
+		Where("collection = ? AND updated_at > ?", collection, since.UTC()).
+		Order("record_id").Find(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, row := range rows {
+		if row.DeletedAt != nil {
+			deleted = append(deleted, row.RecordID)
+		} else {
+			changed = append(changed, row.RecordID)
+		}
+	}
+	return changed, deleted, nil
+}
+
+// syncStale reports whether a sync refreshed at refreshedAt (nil: never) is
+// due a refresh at now.
+func syncStale(refreshedAt *time.Time, now time.Time) bool {
+	return refreshedAt == nil || now.Sub(*refreshedAt) >= SyncRefreshInterval
+}
+
+// refreshStamp is the time a refresh stamps its changes with: now, or just
+// after the previous refresh if another server's clock ran ahead, so stamps
+// never go backwards past a cursor already handed out.
+func refreshStamp(previous *time.Time, now time.Time) time.Time {
+	now = now.UTC().Truncate(time.Millisecond)
+	if previous != nil && !now.After(*previous) {
+		return previous.UTC().Add(time.Millisecond)
+	}
+	return now
+}
+
+// refreshSyncRows stamps new, changed and reappearing records with now and marks
+// records no longer served as deleted.
+func refreshSyncRows(db *gorm.DB, collection string, current map[string]any, now time.Time) error {
+	var existing []model.SyncRow
+	if err := db.Select("record_id", "hash", "deleted_at").
+		Where("collection = ?", collection).Find(&existing).Error; err != nil {
+		return err
+	}
+
+	hashes := make(map[string]string, len(current))
+	for id, record := range current {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		hashes[id] = hex.EncodeToString(sum[:])
+	}
+
+	changed, removed := diffSyncRows(existing, hashes)
+	if len(changed) > 0 {
+		rows := utils.Map(changed, func(id string) model.SyncRow {
+			return model.SyncRow{Collection: collection, RecordID: id, Hash: hashes[id], CreatedAt: now, UpdatedAt: now}
+		})
+		// A concurrent pull may have stamped the same change first; keep its
+		// stamp unless the content really differs. MySQL applies the
+		// assignments in order, so hash is compared before it is replaced.
+		if err := db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "collection"}, {Name: "record_id"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "created_at"}, Value: gorm.Expr("IF(deleted_at IS NOT NULL, VALUES(created_at), created_at)")},
+				{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("IF(hash <> VALUES(hash) OR deleted_at IS NOT NULL, VALUES(updated_at), updated_at)")},
+				{Column: clause.Column{Name: "deleted_at"}, Value: nil},
+				{Column: clause.Column{Name: "hash"}, Value: gorm.Expr("VALUES(hash)")},
+			},
+		}).CreateInBatches(&rows, 500).Error; err != nil {
+			return err
+		}
+	}
+
+	for start := 0; start < len(removed); start += 500 {
+		batch := removed[start:min(start+500, len(removed))]
+		if err := db.Model(&model.SyncRow{}).
+			Where("collection = ? AND record_id IN ? AND deleted_at IS NULL", collection, batch).
+			Updates(map[string]any{"deleted_at": now, "updated_at": now}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffSyncRows compares the recorded rows with the current content hashes and
+// returns the ids to stamp (new, changed or back after a delete) and the ids
+// no longer served.
+func diffSyncRows(existing []model.SyncRow, hashes map[string]string) (changed, removed []string) {
+	seen := make(map[string]bool, len(existing))
+	for _, row := range existing {
+		seen[row.RecordID] = true
+		hash, ok := hashes[row.RecordID]
+		switch {
+		case !ok:
+			if row.DeletedAt == nil {
+				removed = append(removed, row.RecordID)
+			}
+		case hash != row.Hash || row.DeletedAt != nil:
+			changed = append(changed, row.RecordID)
+		}
+	}
+	for id := range hashes {
+		if !seen[id] {
+			changed = append(changed, id)
+		}
+	}
+	return changed, removed
+}
+
+// classifySyncRows splits the rows changed since `since` into a changeset.
+// Deletes are omitted from a first pull, which has nothing to delete.
+func classifySyncRows(rows []model.SyncRow, current map[string]any, since time.Time) *CollectionChanges {
+	changes := &CollectionChanges{Created: []any{}, Updated: []any{}, Deleted: []string{}}
+	for _, row := range rows {
+		if row.DeletedAt != nil {
+			if !since.IsZero() {
+				changes.Deleted = append(changes.Deleted, row.RecordID)
+			}
+			continue
+		}
+		record, ok := current[row.RecordID]
+		if !ok {
+			continue
+		}
+		if row.CreatedAt.After(since) {
+			changes.Created = append(changes.Created, record)
+		} else {
+			changes.Updated = append(changes.Updated, record)
+		}
+	}
+	return changes
+}
+
+func keyed[T any](records []T, id func(T) string) map[string]any {
+	byID := make(map[string]any, len(records))
+	for _, record := range records {
+		byID[id(record)] = record
+	}
+	return byID
+}
+
+func loadSyncEmployees(db *gorm.DB, ids []string, _ time.Time) (map[string]any, error) {
+	query := db.Table("employees")
+	if ids != nil {
+		query = query.Where("employees.employeeid IN ?", ids)
+	}
+	var employees []SyncEmployee
+	if err := query.
+		Select(`
+		CAST(employees.employeeid AS CHAR) AS id,
+		employees.identificationTag AS tag,
+		employees.code AS code,
+		employees.picture AS avatar,
+		employees.firstname AS first_name,
+		employees.surname AS last_name,
+		CAST(employees.jobid AS CHAR) AS job_id,
+		CAST(employees.costcentreid AS CHAR) AS cost_centre_id,
+		CAST(employees.reportstoid AS CHAR) AS supervisor_id,
+		CAST(CAST(JSON_EXTRACT(employees.attributes, '$.backToBack.id') AS UNSIGNED) AS CHAR) AS back_to_back_id
+	`).
+		Scan(&employees).Error; err != nil {
+		return nil, err
+	}
+	return keyed(employees, func(e SyncEmployee) string { return e.ID }), nil
+}
+
+func loadSyncJobs(db *gorm.DB, ids []string, _ time.Time) (map[string]any, error) {
+	query := db.Table("jobs")
+	if ids != nil {
+		query = query.Where("jobs.jobid IN ?", ids)
+	}
+	var jobs []SyncJob
+	if err := query.
+		Select(`
+		CAST(jobs.jobid AS CHAR) AS id,
+		jobs.jobno AS job_no,
+		jobs.description AS description
+	`).
+		Scan(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return keyed(jobs, func(j SyncJob) string { return j.ID }), nil
+}
+
+func loadSyncJobCostCentres(db *gorm.DB, ids []string, _ time.Time) (map[string]any, error) {
+	query := db.Table("jobcostcentres jcc").Joins("JOIN costcentres cc USING (costcentreid)")
+	if ids != nil {
+		pairs := JobCostCentrePairs(ids)
+		if len(pairs) == 0 {
+			return map[string]any{}, nil
+		}
+		query = query.Where("(jcc.jobid, jcc.costcentreid) IN ?", pairs)
+	}
+	var costCentres []SyncJobCostCentre
+	if err := query.Select(`
+			CAST(jcc.jobid AS CHAR) AS job_id,
+			CAST(cc.costcentreid AS CHAR) AS cost_centre_id,
+			cc.code AS code,
+			cc.description AS description
+		`).
+		Scan(&costCentres).Error; err != nil {
+		return nil, err
+	}
+	return keyJobCostCentres(costCentres), nil
+}
+
+// JobCostCentrePairs parses "<job id>-<cost centre id>" ids into
+// (job id, cost centre id) pairs for an IN query, skipping malformed ones.
+func JobCostCentrePairs(ids []string) [][]any {
+	pairs := make([][]any, 0, len(ids))
+	for _, id := range ids {
+		job, costCentre, ok := strings.Cut(id, "-")
+		if !ok {
+			continue
+		}
+		jobID, err1 := strconv.Atoi(job)
+		costCentreID, err2 := strconv.Atoi(costCentre)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		pairs = append(pairs, []any{jobID, costCentreID})
+	}
+	return pairs
+}
+
+// keyJobCostCentres sets each row's id from its job and cost centre, and keys
+// the rows by it.
+func keyJobCostCentres(costCentres []SyncJobCostCentre) map[string]any {
+	for i := range costCentres {
+		costCentres[i].ID = costCentres[i].JobID + "-" + costCentres[i].CostCentreID
+	}
+	return keyed(costCentres, func(cc SyncJobCostCentre) string { return cc.ID })
+}
+
+func loadSyncSupervisorAssignments(db *gorm.DB, ids []string, now time.Time) (map[string]any, error) {
+	from := now.In(utils.BrisbaneTZ).AddDate(0, 0, -SupervisorAssignmentSyncDays).Format("2006-01-02")
+	query := db.Where("date >= ?", from)
+	if ids != nil {
+		query = query.Where("id IN ?", ids)
+	}
+	var records []model.SupervisorRecord
+	if err := query.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	assignments := utils.Map(records, func(r model.SupervisorRecord) SyncSupervisorAssignment {
+		return SyncSupervisorAssignment{
+			ID:           strconv.Itoa(int(r.ID)),
+			SupervisorID: strconv.Itoa(r.SupervisorId),
+			EmployeeID:   strconv.Itoa(r.EmployeeId),
+			Project:      r.Project,
+			Wbs:          r.Wbs,
+			Date:         r.Date,
+			Clockin:      unixMilli(r.Clockin),
+			Clockout:     unixMilli(r.Clockout),
+		}
+	})
+	return keyed(assignments, func(a SyncSupervisorAssignment) string { return a.ID }), nil
+}
+
+func unixMilli(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	ms := t.UnixMilli()
+	return &ms
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"axiapac.com/axiapac/oktedi/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSyncRows(t *testing.T) {
+	deletedAt := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	existing := []model.SyncRow{
+		{RecordID: "1", Hash: "a"},                        // unchanged
+		{RecordID: "2", Hash: "b"},                        // changed
+		{RecordID: "3", Hash: "c"},                        // gone
+		{RecordID: "4", Hash: "d", DeletedAt: &deletedAt}, // still gone
+		{RecordID: "5", Hash: "e", DeletedAt: &deletedAt}, // back
+	}
+	hashes := map[string]string{"1": "a", "2": "B", "5": "e", "6": "f"}
+
+	changed, removed := diffSyncRows(existing, hashes)
+	sort.Strings(changed)
+	assert.Equal(t, []string{"2", "5", "6"}, changed)
+	assert.Equal(t, []string{"3"}, removed)
+}
+
+func TestClassifySyncRows(t *testing.T) {
+	since := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	before := since.Add(-time.Hour)
+	after := since.Add(time.Minute)
+	current := map[string]any{
+		"1": SyncJob{ID: "1"},
+		"2": SyncJob{ID: "2"},
+	}
+	rows := []model.SyncRow{
+		{RecordID: "1", CreatedAt: after, UpdatedAt: after},
+		{RecordID: "2", CreatedAt: before, UpdatedAt: after},
+		{RecordID: "3", CreatedAt: before, UpdatedAt: after, DeletedAt: &after},
+	}
+
+	changes := classifySyncRows(rows, current, since)
+	assert.Equal(t, []any{SyncJob{ID: "1"}}, changes.Created)
+	assert.Equal(t, []any{SyncJob{ID: "2"}}, changes.Updated)
+	assert.Equal(t, []string{"3"}, changes.Deleted)
+
+	// A first pull creates everything and deletes nothing.
+	first := classifySyncRows(rows, current, time.Time{})
+	assert.Len(t, first.Created, 2)
+	assert.Empty(t, first.Updated)
+	assert.Empty(t, first.Deleted)
+}
+
+func TestKeyJobCostCentres(t *testing.T) {
+	// Cost centre 7 is on jobs 1 and 2.
+	rows := keyJobCostCentres([]SyncJobCostCentre{
+		{JobID: "1", CostCentreID: "7", Code: "CC7"},
+		{JobID: "2", CostCentreID: "7", Code: "CC7"},
+		{JobID: "2", CostCentreID: "8", Code: "CC8"},
+	})
+	assert.Equal(t, map[string]any{
+		"1-7": SyncJobCostCentre{ID: "1-7", JobID: "1", CostCentreID: "7", Code: "CC7"},
+		"2-7": SyncJobCostCentre{ID: "2-7", JobID: "2", CostCentreID: "7", Code: "CC7"},
+		"2-8": SyncJobCostCentre{ID: "2-8", JobID: "2", CostCentreID: "8", Code: "CC8"},
+	}, rows)
+}
+
+func TestSyncStale(t *testing.T) {
+	now := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	recent := now.Add(-SyncRefreshInterval / 2)
+	old := now.Add(-SyncRefreshInterval)
+
+	assert.True(t, syncStale(nil, now), "never refreshed")
+	assert.False(t, syncStale(&recent, now))
+	assert.True(t, syncStale(&old, now))
+}
+
+func TestRefreshStamp(t *testing.T) {
+	now := time.Date(2026, 1, 5, 12, 0, 0, 123456789, time.UTC)
+	assert.Equal(t, now.Truncate(time.Millisecond), refreshStamp(nil, now))
+
+	earlier := now.Add(-time.Minute)
+	assert.Equal(t, now.Truncate(time.Millisecond), refreshStamp(&earlier, now))
+
+	// Another server stamped ahead of this one's clock; stay after it.
+	ahead := now.Add(time.Second).Truncate(time.Millisecond)
+	assert.Equal(t, ahead.Add(time.Millisecond), refreshStamp(&ahead, now))
+}
+
+func TestJobCostCentrePairs(t *testing.T) {
+	pairs := JobCostCentrePairs([]string{"1-7", "2-8", "7", "x-1"})
+	assert.Equal(t, [][]any{{1, 7}, {2, 8}}, pairs)
+}
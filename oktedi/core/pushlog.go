@@ -0,0 +1,50 @@
+package core
+
+import (
+	"errors"
+
+	"axiapac.com/axiapac/oktedi/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxPushLogLimit caps how many receipts ListPushes returns.
+const MaxPushLogLimit = 500
+
+// FindPushReceipt returns the receipt for batchID, or nil, locking it (or its
+// slot, so a concurrent retry of the same batch waits) until the transaction
+// ends.
+func FindPushReceipt(db *gorm.DB, batchID string) (*model.PushLog, error) {
+	var receipt model.PushLog
+	err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("batch_id = ?", batchID).Take(&receipt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// RecordPush stores a push receipt, replacing an earlier one for the same
+// batch id.
+func RecordPush(db *gorm.DB, receipt *model.PushLog) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "batch_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"device_id", "created_count", "updated_count", "deleted_count", "last_pulled_at", "payload_hash", "outcome", "status", "error", "response", "updated_at"}),
+	}).Create(receipt).Error
+}
+
+// ListPushes returns a device's most recent push receipts, newest first.
+func ListPushes(db *gorm.DB, deviceID string, limit int) ([]model.PushLog, error) {
+	if limit <= 0 || limit > MaxPushLogLimit {
+		limit = MaxPushLogLimit
+	}
+	var receipts []model.PushLog
+	err := db.Where("device_id = ?", deviceID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&receipts).Error
+	return receipts, err
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"sort"
+	"strings"
 
 	"axiapac.com/axiapac/oktedi/model"
 	"axiapac.com/axiapac/utils"
@@ -28,8 +29,8 @@ func (rg *RecordGroup) GetClockOut() string {
 }
 
 // GetDeviceID returns the device the clock-in (earliest) record came from, ""
-// when the group is empty. Used by the evacuation register to resolve the area
-// an employee signed in at.
+// when the group is empty. Its registry entry gives the area the employee
+// signed in at and the project the taps are booked to.
 func (rg *RecordGroup) GetDeviceID() string {
 	if len(rg.Records) == 0 {
 		return ""
@@ -37,6 +38,83 @@ func (rg *RecordGroup) GetDeviceID() string {
 	return rg.Records[0].DeviceID
 }
 
+// Segment is a stretch on site, from an "in" tap to the "out" tap after it.
+type Segment struct {
+	In  *model.ClockinRecord
+	Out *model.ClockinRecord
+}
+
+// Hours is the time between the segment's taps.
+func (s Segment) Hours() (float64, error) {
+	in, err := utils.ParseISOTime(s.In.Timestamp)
+	if err != nil {
+		return 0, err
+	}
+	out, err := utils.ParseISOTime(s.Out.Timestamp)
+	if err != nil {
+		return 0, err
+	}
+	return out.Sub(*in).Hours(), nil
+}
+
+// WorkedHours is the total time of the segments.
+func WorkedHours(segments []Segment) (float64, error) {
+	total := 0.0
+	for _, seg := range segments {
+		h, err := seg.Hours()
+		if err != nil {
+			return 0, err
+		}
+		total += h
+	}
+	return total, nil
+}
+
+// Segments pairs the group's taps into segments; see SegmentRecords.
+func (rg *RecordGroup) Segments() ([]Segment, []*model.ClockinRecord) {
+	return SegmentRecords(rg.Records)
+}
+
+// SegmentRecords pairs taps, in time order, into in/out segments. A tap with
+// no Kind closes an open segment and otherwise opens one, so taps from kiosks
+// that don't send kinds pair up in turn. Taps left without a partner are
+// returned as unmatched: an "out" with no segment open, an "in" followed by
+// another "in", and an "in" never closed.
+func SegmentRecords(records []*model.ClockinRecord) (segments []Segment, unmatched []*model.ClockinRecord) {
+	sorted := make([]*model.ClockinRecord, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp < sorted[j].Timestamp
+	})
+
+	var open *model.ClockinRecord
+	for _, r := range sorted {
+		kind := strings.ToLower(r.Kind)
+		if kind != "in" && kind != "out" {
+			kind = "in"
+			if open != nil {
+				kind = "out"
+			}
+		}
+		switch {
+		case kind == "in":
+			if open != nil {
+				unmatched = append(unmatched, open)
+			}
+			open = r
+		case open != nil:
+			segments = append(segments, Segment{In: open, Out: r})
+			open = nil
+		default:
+			unmatched = append(unmatched, r)
+		}
+	}
+	if open != nil {
+		unmatched = append(unmatched, open)
+	}
+	return segments, unmatched
+}
+
 func GroupRecords(records []*model.ClockinRecord) []*RecordGroup {
 	// group by date - although we are processing single date, the util is generic
 	var groups []*RecordGroup
@@ -61,3 +139,38 @@ func GroupRecords(records []*model.ClockinRecord) []*RecordGroup {
 	}
 	return groups
 }
+
+// EmployeeDay keys an employee's records for one date.
+type EmployeeDay struct {
+	EmployeeID int32
+	Date       string
+}
+
+// GroupRecordsByEmployee groups records by their employee, as holder resolves
+// them (normally whoever held the record's card on its date), and by date, so
+// an employee who changed cards during the day gets one group. Records holder
+// places nowhere are left out. Each group is sorted by timestamp and takes its
+// Tag from its first record.
+func GroupRecordsByEmployee(records []*model.ClockinRecord, holder func(r *model.ClockinRecord) (int32, bool)) map[EmployeeDay]*RecordGroup {
+	groups := make(map[EmployeeDay]*RecordGroup)
+	for _, r := range records {
+		empID, ok := holder(r)
+		if !ok {
+			continue
+		}
+		key := EmployeeDay{EmployeeID: empID, Date: r.Date}
+		g := groups[key]
+		if g == nil {
+			g = &RecordGroup{Date: r.Date}
+			groups[key] = g
+		}
+		g.Records = append(g.Records, r)
+	}
+	for _, g := range groups {
+		sort.Slice(g.Records, func(i, j int) bool {
+			return g.Records[i].Timestamp < g.Records[j].Timestamp
+		})
+		g.Tag = g.Records[0].Tag
+	}
+	return groups
+}
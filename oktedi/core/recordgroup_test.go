@@ -0,0 +1,86 @@
+package core
+
+import (
+	"testing"
+
+	"axiapac.com/axiapac/oktedi/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tap(id, kind, hhmm string) *model.ClockinRecord {
+	return &model.ClockinRecord{ID: id, Kind: kind, Timestamp: "2026-01-10T" + hhmm + ":00Z"}
+}
+
+func segmentIDs(segments []Segment) [][2]string {
+	ids := make([][2]string, len(segments))
+	for i, s := range segments {
+		ids[i] = [2]string{s.In.ID, s.Out.ID}
+	}
+	return ids
+}
+
+func recordIDList(records []*model.ClockinRecord) []string {
+	ids := make([]string, len(records))
+	for i, r := range records {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+func TestSegmentRecords(t *testing.T) {
+	tests := []struct {
+		name      string
+		records   []*model.ClockinRecord
+		segments  [][2]string
+		unmatched []string
+	}{
+		{
+			name:     "split shift, out of order",
+			records:  []*model.ClockinRecord{tap("c", "in", "13:00"), tap("a", "in", "07:00"), tap("d", "out", "17:00"), tap("b", "out", "11:00")},
+			segments: [][2]string{{"a", "b"}, {"c", "d"}},
+		},
+		{
+			name:     "no kinds pair in turn",
+			records:  []*model.ClockinRecord{tap("a", "", "07:00"), tap("b", "", "11:00"), tap("c", "", "13:00"), tap("d", "", "17:00")},
+			segments: [][2]string{{"a", "b"}, {"c", "d"}},
+		},
+		{
+			name:      "missed tap out before lunch",
+			records:   []*model.ClockinRecord{tap("a", "in", "07:00"), tap("c", "in", "13:00"), tap("d", "out", "17:00")},
+			segments:  [][2]string{{"c", "d"}},
+			unmatched: []string{"a"},
+		},
+		{
+			name:      "out with nothing open",
+			records:   []*model.ClockinRecord{tap("a", "out", "07:00"), tap("b", "IN", "08:00"), tap("c", "OUT", "16:00")},
+			segments:  [][2]string{{"b", "c"}},
+			unmatched: []string{"a"},
+		},
+		{
+			name:      "single tap",
+			records:   []*model.ClockinRecord{tap("a", "in", "07:00")},
+			segments:  [][2]string{},
+			unmatched: []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments, unmatched := SegmentRecords(tt.records)
+			assert.Equal(t, tt.segments, segmentIDs(segments))
+			if tt.unmatched == nil {
+				tt.unmatched = []string{}
+			}
+			assert.Equal(t, tt.unmatched, recordIDList(unmatched))
+		})
+	}
+}
+
+func TestWorkedHours(t *testing.T) {
+	segments, _ := SegmentRecords([]*model.ClockinRecord{
+		tap("a", "in", "07:00"), tap("b", "out", "11:00"), tap("c", "in", "13:00"), tap("d", "out", "17:30"),
+	})
+	hours, err := WorkedHours(segments)
+	require.NoError(t, err)
+	assert.Equal(t, 8.5, hours)
+}
@@ -29,10 +29,12 @@ func CreateClient(user *models.User, domain string) (*v1.AxiapacClient, error) {
 	}
 
 	token, err := security.CreateIdentityToken(&security.AxiapacIdentity{
-		Id:       int(user.ID),
-		UserName: user.UserName,
-		Provider: user.Provider,
-		Email:    user.Email,
+		Id:            int(user.ID),
+		UserName:      user.UserName,
+		Provider:      user.Provider,
+		Email:         user.Email,
+		Tenant:        core.TenantFromHost(domain),
+		SecurityStamp: user.SecurityStamp,
 	}, secret, 3600)
 
 	if err != nil {
@@ -0,0 +1,3 @@
+DROP TABLE `oktedi_timesheets`;
+DROP TABLE `oktedi_supervisor_records`;
+DROP TABLE `oktedi_records`;
@@ -0,0 +1,55 @@
+-- Create the original oktedi tables, as oktedi/cmd/seed used to via GORM:
+-- oktedi_records (model.ClockinRecord), oktedi_supervisor_records
+-- (model.SupervisorRecord) and oktedi_timesheets (model.OktediTimesheet,
+-- before 001 added `overtime`).
+--
+-- IF NOT EXISTS so tenants seeded before the runner existed pass through.
+-- MySQL/MariaDB.
+
+CREATE TABLE IF NOT EXISTS `oktedi_records` (
+    `id`             VARCHAR(191) NOT NULL,
+    `tag`            LONGTEXT     NULL,
+    `date`           LONGTEXT     NULL,
+    `kind`           LONGTEXT     NULL,
+    `timestamp`      LONGTEXT     NULL,
+    `device_id`      LONGTEXT     NULL,
+    `card_id`        LONGTEXT     NULL,
+    `status`         LONGTEXT     NULL,
+    `changed`        LONGTEXT     NULL,
+    `process_status` LONGTEXT     NULL,
+    `created_at`     TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`     TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `oktedi_supervisor_records` (
+    `id`            INT         NOT NULL AUTO_INCREMENT,
+    `supervisor_id` BIGINT      NULL,
+    `employee_id`   BIGINT      NULL,
+    `project`       LONGTEXT    NULL,
+    `wbs`           LONGTEXT    NULL,
+    `date`          LONGTEXT    NULL,
+    `clockin`       DATETIME(3) NULL,
+    `clockout`      DATETIME(3) NULL,
+    `device_id`     LONGTEXT    NULL,
+    `created_at`    TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`    TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `oktedi_timesheets` (
+    `id`             INT           NOT NULL AUTO_INCREMENT,
+    `date`           DATE          NULL,
+    `hours`          DECIMAL(10,2) NULL,
+    `start_time`     DATETIME      NULL,
+    `finish_time`    DATETIME      NULL,
+    `review_status`  VARCHAR(50)   NULL,
+    `approved`       BOOL          NOT NULL,
+    `break`          INT           NULL,
+    `notes`          TEXT          NULL,
+    `employee_id`    INT           NOT NULL,
+    `timesheet_id`   INT           NULL,
+    `project_id`     INT           NULL,
+    `cost_centre_id` INT           NULL,
+    PRIMARY KEY (`id`)
+);
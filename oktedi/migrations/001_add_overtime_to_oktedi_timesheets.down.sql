@@ -0,0 +1 @@
+ALTER TABLE `oktedi_timesheets` DROP COLUMN `overtime`;
@@ -7,6 +7,3 @@
 
 ALTER TABLE `oktedi_timesheets`
     ADD COLUMN `overtime` DECIMAL(10,2) NOT NULL DEFAULT 0.00 AFTER `break`;
-
--- Rollback:
--- ALTER TABLE `oktedi_timesheets` DROP COLUMN `overtime`;
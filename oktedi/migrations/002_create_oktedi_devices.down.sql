@@ -0,0 +1 @@
+DROP TABLE `oktedi_devices`;
@@ -0,0 +1,18 @@
+-- Create `oktedi_devices`, the enrolled kiosk registry.
+-- Mirrors model.Device (oktedi/model/device.go). Enrollment codes and refresh
+-- tokens are stored as SHA-256 hex digests, never in plain text.
+-- MySQL/MariaDB.
+
+CREATE TABLE IF NOT EXISTS `oktedi_devices` (
+    `id`                    VARCHAR(64) NOT NULL,
+    `user_id`               INT         NOT NULL,
+    `enrollment_code_hash`  VARCHAR(64) NULL,
+    `enrollment_expires_at` DATETIME    NULL,
+    `enrolled_at`           DATETIME    NULL,
+    `refresh_token_hash`    VARCHAR(64) NULL,
+    `refresh_expires_at`    DATETIME    NULL,
+    `revoked_at`            DATETIME    NULL,
+    `created_at`            TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`            TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`)
+);
@@ -0,0 +1 @@
+DROP TABLE `oktedi_sync_rows`;
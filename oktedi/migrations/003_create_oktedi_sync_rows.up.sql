@@ -0,0 +1,16 @@
+-- Create `oktedi_sync_rows`, the change log behind the WatermelonDB pull.
+-- Mirrors model.SyncRow (oktedi/model/syncrow.go). One row per record served
+-- to kiosks: the SHA-256 of its last served content, when it last changed and,
+-- once it disappears from the source table, when it was deleted.
+-- MySQL/MariaDB.
+
+CREATE TABLE IF NOT EXISTS `oktedi_sync_rows` (
+    `collection` VARCHAR(32) NOT NULL,
+    `record_id`  VARCHAR(64) NOT NULL,
+    `hash`       CHAR(64)    NOT NULL,
+    `created_at` DATETIME(3) NOT NULL,
+    `updated_at` DATETIME(3) NOT NULL,
+    `deleted_at` DATETIME(3) NULL,
+    PRIMARY KEY (`collection`, `record_id`),
+    KEY `idx_oktedi_sync_rows_updated` (`collection`, `updated_at`)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE `oktedi_records`
+    DROP COLUMN `deleted_at`,
+    DROP COLUMN `deleted_by`;
@@ -0,0 +1,7 @@
+-- Soft-delete tombstones for clock-in taps deleted on a kiosk. Mirrors
+-- model.ClockinRecord.DeletedAt / DeletedBy (the device that deleted it).
+-- MySQL/MariaDB.
+
+ALTER TABLE `oktedi_records`
+    ADD COLUMN `deleted_at` DATETIME(3) NULL,
+    ADD COLUMN `deleted_by` VARCHAR(64) NULL;
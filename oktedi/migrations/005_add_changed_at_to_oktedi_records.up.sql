@@ -0,0 +1,8 @@
+-- When a kiosk-owned field of a clock-in record last changed (push or
+-- tombstone), for push conflict detection. Unlike `updated_at` it ignores
+-- server bookkeeping such as `process_status`. Mirrors
+-- model.ClockinRecord.ChangedAt.
+-- MySQL/MariaDB.
+
+ALTER TABLE `oktedi_records`
+    ADD COLUMN `changed_at` DATETIME(3) NULL;
@@ -0,0 +1 @@
+DROP TABLE `oktedi_push_log`;
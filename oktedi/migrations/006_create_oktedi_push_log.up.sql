@@ -0,0 +1,25 @@
+-- Create `oktedi_push_log`, one receipt per kiosk push. Mirrors model.PushLog
+-- (oktedi/model/pushlog.go). `batch_id` is the client's id for the push; a
+-- push replayed with the same id gets the stored `response` back instead of
+-- being applied twice. Pushes without a batch id are logged with NULL.
+-- MySQL/MariaDB.
+
+CREATE TABLE IF NOT EXISTS `oktedi_push_log` (
+    `id`             BIGINT      NOT NULL AUTO_INCREMENT,
+    `batch_id`       VARCHAR(64) NULL,
+    `device_id`      VARCHAR(64) NOT NULL,
+    `created_count`  INT         NOT NULL,
+    `updated_count`  INT         NOT NULL,
+    `deleted_count`  INT         NOT NULL,
+    `last_pulled_at` BIGINT      NOT NULL,
+    `payload_hash`   CHAR(64)    NOT NULL,
+    `outcome`        VARCHAR(16) NOT NULL,
+    `status`         INT         NOT NULL,
+    `error`          TEXT        NULL,
+    `response`       MEDIUMTEXT  NULL,
+    `created_at`     DATETIME(3) NOT NULL,
+    `updated_at`     DATETIME(3) NOT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_oktedi_push_log_batch` (`batch_id`),
+    KEY `idx_oktedi_push_log_device` (`device_id`, `created_at`)
+);
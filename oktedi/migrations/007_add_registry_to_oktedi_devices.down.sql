@@ -0,0 +1,11 @@
+-- Drop the seeded kiosks unless they have since been enrolled.
+DELETE FROM `oktedi_devices`
+WHERE `id` IN ('351494370028086', '351494370029795')
+  AND `user_id` = 0 AND `enrolled_at` IS NULL AND `enrollment_code_hash` IS NULL;
+
+ALTER TABLE `oktedi_devices`
+    DROP COLUMN `name`,
+    DROP COLUMN `area`,
+    DROP COLUMN `default_project_id`,
+    DROP COLUMN `app_version`,
+    DROP COLUMN `last_seen_at`;
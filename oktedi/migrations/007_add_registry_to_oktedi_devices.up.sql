@@ -0,0 +1,18 @@
+-- Registry details for kiosks: a friendly name, the area it sits in (shown on
+-- the evacuation register), the project its taps are booked to by default, and
+-- the app version and time it last pushed. Replaces the hardcoded
+-- core.DeviceArea map, whose two FIFO Village kiosks are seeded here. Mirrors
+-- model.Device (oktedi/model/device.go).
+-- MySQL/MariaDB.
+
+ALTER TABLE `oktedi_devices`
+    ADD COLUMN `name`               VARCHAR(100) NULL,
+    ADD COLUMN `area`               VARCHAR(100) NULL,
+    ADD COLUMN `default_project_id` INT          NULL,
+    ADD COLUMN `app_version`        VARCHAR(32)  NULL,
+    ADD COLUMN `last_seen_at`       DATETIME(3)  NULL;
+
+INSERT INTO `oktedi_devices` (`id`, `user_id`, `area`) VALUES
+    ('351494370028086', 0, 'FIFO Village'),
+    ('351494370029795', 0, 'FIFO Village')
+ON DUPLICATE KEY UPDATE `area` = VALUES(`area`);
@@ -0,0 +1,6 @@
+DROP TABLE `oktedi_work_site_geofences`;
+
+ALTER TABLE `oktedi_records`
+    DROP COLUMN `latitude`,
+    DROP COLUMN `longitude`,
+    DROP COLUMN `accuracy`;
@@ -0,0 +1,19 @@
+-- Tap locations and work site geofences. A kiosk may send the GPS fix
+-- (decimal degrees, accuracy in metres) with each tap; Prepare and attendance
+-- flag taps outside the geofence of the employee's work site. Mirrors
+-- model.ClockinRecord and model.WorkSiteGeofence (oktedi/model/geofence.go).
+-- MySQL/MariaDB.
+
+ALTER TABLE `oktedi_records`
+    ADD COLUMN `latitude`  DOUBLE NULL,
+    ADD COLUMN `longitude` DOUBLE NULL,
+    ADD COLUMN `accuracy`  DOUBLE NULL;
+
+-- One polygon per WorkSites row, as a JSON array of {"lat", "lng"} vertices.
+CREATE TABLE IF NOT EXISTS `oktedi_work_site_geofences` (
+    `work_site_id` INT       NOT NULL,
+    `polygon`      TEXT      NOT NULL,
+    `created_at`   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (`work_site_id`)
+);
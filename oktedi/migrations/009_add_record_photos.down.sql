@@ -0,0 +1 @@
+DROP TABLE `oktedi_record_photos`;
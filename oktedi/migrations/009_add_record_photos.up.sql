@@ -0,0 +1,17 @@
+-- Create `oktedi_record_photos`, the photo a kiosk took with a tap. Mirrors
+-- model.RecordPhoto (oktedi/model/recordphoto.go). The image itself lives in
+-- the photo store (S3 or local disk) under `storage_key`. A photo may be
+-- uploaded before the push that carries its tap, so `record_id` has no
+-- foreign key. MySQL/MariaDB.
+
+CREATE TABLE IF NOT EXISTS `oktedi_record_photos` (
+    `record_id`    VARCHAR(191) NOT NULL,
+    `storage_key`  VARCHAR(512) NOT NULL,
+    `content_type` VARCHAR(64)  NOT NULL,
+    `size`         BIGINT       NOT NULL,
+    `sha256`       CHAR(64)     NOT NULL,
+    `device_id`    VARCHAR(64)  NOT NULL,
+    `created_at`   DATETIME(3)  NOT NULL,
+    `updated_at`   DATETIME(3)  NOT NULL,
+    PRIMARY KEY (`record_id`)
+);
@@ -0,0 +1,2 @@
+DROP TABLE `oktedi_card_assignments`;
+DROP TABLE `oktedi_cards`;
@@ -0,0 +1,52 @@
+-- NFC card registry. `oktedi_cards` holds each card's state and
+-- `oktedi_card_assignments` who held it when, so Prepare can resolve a tap to
+-- the employee who held the card on the tap's date. Effective dates are
+-- YYYY-MM-DD strings like `oktedi_records`.`date`; `effective_to` is inclusive
+-- and NULL while the card is held. `Employees`.`IdentificationTag` stays the
+-- current card. `open_tag` is the tag while the assignment is open, so the
+-- unique key allows one open assignment per card. Mirrors model.Card and
+-- model.CardAssignment (oktedi/model/card.go).
+-- MySQL/MariaDB.
+
+CREATE TABLE IF NOT EXISTS `oktedi_cards` (
+    `tag`        VARCHAR(191) NOT NULL,
+    `status`     VARCHAR(16)  NOT NULL,
+    `notes`      VARCHAR(255) NOT NULL DEFAULT '',
+    `created_at` DATETIME(3)  NOT NULL,
+    `updated_at` DATETIME(3)  NOT NULL,
+    PRIMARY KEY (`tag`)
+);
+
+CREATE TABLE IF NOT EXISTS `oktedi_card_assignments` (
+    `id`             BIGINT       NOT NULL AUTO_INCREMENT,
+    `tag`            VARCHAR(191) NOT NULL,
+    `employee_id`    INT          NOT NULL,
+    `effective_from` CHAR(10)     NOT NULL,
+    `effective_to`   CHAR(10)     NULL,
+    `assigned_by`    INT          NOT NULL,
+    `created_at`     DATETIME(3)  NOT NULL,
+    `updated_at`     DATETIME(3)  NOT NULL,
+    `open_tag`       VARCHAR(191) AS (IF(`effective_to` IS NULL, `tag`, NULL)) STORED,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uq_oktedi_card_assignments_open_tag` (`open_tag`),
+    KEY `idx_oktedi_card_assignments_tag` (`tag`, `effective_from`),
+    KEY `idx_oktedi_card_assignments_employee` (`employee_id`, `effective_from`)
+);
+
+-- Every card in use today, held since before any tap on record.
+INSERT IGNORE INTO `oktedi_cards` (`tag`, `status`, `created_at`, `updated_at`)
+SELECT DISTINCT `IdentificationTag`, 'active', NOW(3), NOW(3)
+FROM `Employees`
+WHERE `IdentificationTag` IS NOT NULL AND `IdentificationTag` <> '';
+
+-- A tag two employees share fails here on the open-tag key, naming the tag,
+-- and the migration stops with no assignments written. List them with
+--   SELECT `IdentificationTag`, GROUP_CONCAT(`EmployeeId`) FROM `Employees`
+--   WHERE `IdentificationTag` <> '' GROUP BY `IdentificationTag`
+--   HAVING COUNT(*) > 1;
+-- give each employee their own card and rerun.
+INSERT INTO `oktedi_card_assignments` (`tag`, `employee_id`, `effective_from`, `assigned_by`, `created_at`, `updated_at`)
+SELECT `IdentificationTag`, `EmployeeId`, '2000-01-01', 0, NOW(3), NOW(3)
+FROM `Employees`
+WHERE `IdentificationTag` IS NOT NULL AND `IdentificationTag` <> ''
+ORDER BY `EmployeeId`;
@@ -0,0 +1,9 @@
+-- Add the `gap` column to oktedi_timesheets.
+-- Mirrors model.OktediTimesheet.Gap (oktedi/model/timesheet.go):
+--   Gap float64 `gorm:"column:gap;type:decimal(10,2);not null"`
+--
+-- The hours between start and finish that no in/out segment covers, so hours
+-- worked out again from the span leave them out. Existing rows backfill to 0.
+
+ALTER TABLE `oktedi_timesheets`
+    ADD COLUMN `gap` DECIMAL(10,2) NOT NULL DEFAULT 0.00 AFTER `overtime`;
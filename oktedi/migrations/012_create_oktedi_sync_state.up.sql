@@ -0,0 +1,11 @@
+-- Create `oktedi_sync_state`: when each set of sync collections (`pull`,
+-- `data`) was last re-hashed into oktedi_sync_rows. Mirrors model.SyncState
+-- (oktedi/model/syncstate.go). Pulls refresh the rows at most once a minute
+-- and otherwise only read them.
+-- MySQL/MariaDB.
+
+CREATE TABLE IF NOT EXISTS `oktedi_sync_state` (
+    `name`         VARCHAR(32) NOT NULL,
+    `refreshed_at` DATETIME(3) NULL,
+    PRIMARY KEY (`name`)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE `oktedi_records`
+    DROP COLUMN `changed_by`;
@@ -0,0 +1,7 @@
+-- The device whose push or delete last set `changed_at`, so a push retried
+-- without a batch id doesn't conflict with its own earlier write. Mirrors
+-- model.ClockinRecord.ChangedBy.
+-- MySQL/MariaDB.
+
+ALTER TABLE `oktedi_records`
+    ADD COLUMN `changed_by` VARCHAR(64) NULL;
@@ -0,0 +1,9 @@
+// Package migrations holds the oktedi schema migrations, applied to each
+// tenant by oktedi/cmd/migrate. Files are `NNN_name.up.sql` with a matching
+// `NNN_name.down.sql`; never edit one that has shipped, add the next number.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var Files embed.FS
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+
+	"axiapac.com/axiapac/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Every migration loads, numbers are contiguous from 000, and each one can be
+// rolled back.
+func TestMigrationsLoad(t *testing.T) {
+	migrations, err := core.LoadMigrations(Files)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, i, m.Version, "migration %s is out of sequence", m.Name)
+		assert.NotEmpty(t, core.SplitStatements(m.Up), "%03d_%s up", m.Version, m.Name)
+		assert.NotEmpty(t, core.SplitStatements(m.Down), "%03d_%s down", m.Version, m.Name)
+	}
+}
+
+// Migrations are rerun after a failure part way, so tables they create must
+// not already exist.
+func TestMigrationsCreateIfNotExists(t *testing.T) {
+	migrations, err := core.LoadMigrations(Files)
+	require.NoError(t, err)
+
+	for _, m := range migrations {
+		for _, stmt := range core.SplitStatements(m.Up) {
+			if strings.HasPrefix(stmt, "CREATE TABLE") {
+				assert.True(t, strings.HasPrefix(stmt, "CREATE TABLE IF NOT EXISTS"), "%03d_%s: %.60s", m.Version, m.Name, stmt)
+			}
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	stmts := core.SplitStatements(`-- comment
+ALTER TABLE t
+    ADD COLUMN c INT;
+
+-- another
+DROP TABLE u;
+SELECT 1`)
+	assert.Equal(t, []string{"ALTER TABLE t\n    ADD COLUMN c INT", "DROP TABLE u", "SELECT 1"}, stmts)
+}
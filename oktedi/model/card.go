@@ -0,0 +1,56 @@
+package model
+
+import "time"
+
+// Card states. Only an active card is held by an employee.
+const (
+	CardActive     = "active"
+	CardUnassigned = "unassigned" // handed back; can be assigned again
+	CardLost       = "lost"       // can be assigned again once found
+	CardRevoked    = "revoked"    // never assigned again
+)
+
+// Card is an NFC card (identification tag) kiosks read.
+type Card struct {
+	Tag    string `gorm:"primaryKey;column:tag;type:varchar(191)" json:"tag"`
+	Status string `gorm:"column:status;type:varchar(16);not null" json:"status"`
+	Notes  string `gorm:"column:notes;type:varchar(255);not null" json:"notes"`
+
+	CreatedAt time.Time `gorm:"column:created_at;type:datetime(3);not null" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"column:updated_at;type:datetime(3);not null" json:"updatedAt"`
+}
+
+func (Card) TableName() string {
+	return "oktedi_cards"
+}
+
+// CardAssignment is one employee's holding of a card, from EffectiveFrom to
+// EffectiveTo inclusive (YYYY-MM-DD). EffectiveTo is nil while it is held; a
+// card has at most one open assignment (the generated `open_tag` unique key).
+type CardAssignment struct {
+	ID            int64   `gorm:"primaryKey;column:id" json:"id"`
+	Tag           string  `gorm:"column:tag;type:varchar(191);not null" json:"tag"`
+	EmployeeID    int32   `gorm:"column:employee_id;not null" json:"employeeId"`
+	EffectiveFrom string  `gorm:"column:effective_from;type:char(10);not null" json:"effectiveFrom"`
+	EffectiveTo   *string `gorm:"column:effective_to;type:char(10)" json:"effectiveTo"`
+	AssignedBy    int32   `gorm:"column:assigned_by;not null" json:"assignedBy"`
+
+	CreatedAt time.Time `gorm:"column:created_at;type:datetime(3);not null" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"column:updated_at;type:datetime(3);not null" json:"updatedAt"`
+}
+
+func (CardAssignment) TableName() string {
+	return "oktedi_card_assignments"
+}
+
+// Holds reports whether the assignment covers date (YYYY-MM-DD).
+func (a CardAssignment) Holds(date string) bool {
+	return a.EffectiveFrom <= date && (a.EffectiveTo == nil || date <= *a.EffectiveTo)
+}
+
+// HeldAfter reports whether the assignment runs past date (YYYY-MM-DD). A card
+// handed back on date can go to someone else from date: the new holder takes
+// the handover day.
+func (a CardAssignment) HeldAfter(date string) bool {
+	return a.EffectiveTo == nil || *a.EffectiveTo > date
+}
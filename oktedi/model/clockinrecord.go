@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type ClockinRecord struct {
 	ID        string `json:"id"`
@@ -11,6 +15,12 @@ type ClockinRecord struct {
 	DeviceID  string `json:"device_id"`
 	CardID    string `json:"card_id"`
 
+	// GPS fix the kiosk took with the tap, when it had one: decimal degrees,
+	// and the fix's accuracy radius in metres.
+	Latitude  *float64 `gorm:"column:latitude" json:"latitude"`
+	Longitude *float64 `gorm:"column:longitude" json:"longitude"`
+	Accuracy  *float64 `gorm:"column:accuracy" json:"accuracy"`
+
 	Status  string `json:"_status"`
 	Changed string `json:"_changed"`
 
@@ -18,6 +28,18 @@ type ClockinRecord struct {
 	ProcessStatus string    `json:"process_status"`
 	CreatedAt     time.Time `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP;<-:create"`
 	UpdatedAt     time.Time `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP"`
+
+	// ChangedAt is when a kiosk-owned field last changed, by a push or a
+	// delete; pushes from kiosks that pulled before then are conflicts.
+	ChangedAt *time.Time `gorm:"column:changed_at;type:datetime(3)" json:"changed_at"`
+	// ChangedBy is the device that made that change; its own retries don't
+	// conflict with it.
+	ChangedBy string `gorm:"column:changed_by;type:varchar(64)" json:"changed_by"`
+
+	// Tombstone for a tap deleted on a kiosk. GORM leaves tombstoned records
+	// out of every query on this model; use Unscoped to see them.
+	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at;type:datetime(3)" json:"deleted_at"`
+	DeletedBy string         `gorm:"column:deleted_by;type:varchar(64)" json:"deleted_by"`
 }
 
 func (ClockinRecord) TableName() string {
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// Device is an enrolled kiosk, keyed by the same device id the kiosk stamps on
+// every ClockinRecord. Secrets are stored as SHA-256 hashes only: the one-time
+// enrollment code until it is redeemed, then the current refresh token.
+type Device struct {
+	ID     string `gorm:"primaryKey;column:id;type:varchar(64)" json:"id"`
+	UserID int32  `gorm:"column:user_id;not null" json:"userId"` // user the kiosk acts as (token nameid)
+
+	EnrollmentCodeHash  string     `gorm:"column:enrollment_code_hash;type:varchar(64)" json:"-"`
+	EnrollmentExpiresAt *time.Time `gorm:"column:enrollment_expires_at;type:datetime" json:"enrollmentExpiresAt"`
+	EnrolledAt          *time.Time `gorm:"column:enrolled_at;type:datetime" json:"enrolledAt"`
+	RefreshTokenHash    string     `gorm:"column:refresh_token_hash;type:varchar(64)" json:"-"`
+	RefreshExpiresAt    *time.Time `gorm:"column:refresh_expires_at;type:datetime" json:"refreshExpiresAt"`
+	RevokedAt           *time.Time `gorm:"column:revoked_at;type:datetime" json:"revokedAt"`
+
+	// Registry details, managed by admins; a kiosk can be registered before it
+	// enrolls (user_id 0).
+	Name             string     `gorm:"column:name;type:varchar(100)" json:"name"`
+	Area             string     `gorm:"column:area;type:varchar(100)" json:"area"`              // evacuation register area
+	DefaultProjectID *int32     `gorm:"column:default_project_id" json:"defaultProjectId"`      // Jobs.JobId its taps are booked to
+	AppVersion       string     `gorm:"column:app_version;type:varchar(32)" json:"appVersion"`  // from X-App-Version on the last push
+	LastSeenAt       *time.Time `gorm:"column:last_seen_at;type:datetime(3)" json:"lastSeenAt"` // last push
+
+	CreatedAt time.Time `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP;<-:create" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP" json:"updatedAt"`
+}
+
+func (Device) TableName() string {
+	return "oktedi_devices"
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// GeoPoint is a WGS84 coordinate in decimal degrees.
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// GeoPolygon is a closed ring of vertices; the last vertex joins the first.
+// Stored as a JSON array.
+type GeoPolygon []GeoPoint
+
+func (p *GeoPolygon) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	default:
+		return fmt.Errorf("cannot scan %T into GeoPolygon", value)
+	}
+}
+
+func (p GeoPolygon) Value() (driver.Value, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// WorkSiteGeofence is the boundary of a WorkSites row. Taps by employees of
+// the site that fall outside it are flagged for review.
+type WorkSiteGeofence struct {
+	WorkSiteID int32      `gorm:"primaryKey;autoIncrement:false;column:work_site_id" json:"workSiteId"`
+	Polygon    GeoPolygon `gorm:"column:polygon;type:text;not null" json:"polygon"`
+
+	CreatedAt time.Time `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP;<-:create" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP" json:"updatedAt"`
+}
+
+func (WorkSiteGeofence) TableName() string {
+	return "oktedi_work_site_geofences"
+}
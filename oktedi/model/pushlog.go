@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// Push outcomes recorded in PushLog.Outcome.
+const (
+	PushOutcomeOK       = "ok"
+	PushOutcomeConflict = "conflict"
+	PushOutcomeError    = "error"
+)
+
+// PushLog is the receipt for one kiosk push: who sent it, what it held and
+// how it ended. Only an "ok" receipt is replayed to a retried batch; a failed
+// batch is applied again and its receipt overwritten.
+type PushLog struct {
+	ID           int64   `gorm:"primaryKey;column:id" json:"id"`
+	BatchID      *string `gorm:"column:batch_id;type:varchar(64);uniqueIndex" json:"batchId"`
+	DeviceID     string  `gorm:"column:device_id;type:varchar(64);not null" json:"deviceId"`
+	Created      int     `gorm:"column:created_count;not null" json:"created"`
+	Updated      int     `gorm:"column:updated_count;not null" json:"updated"`
+	Deleted      int     `gorm:"column:deleted_count;not null" json:"deleted"`
+	LastPulledAt int64   `gorm:"column:last_pulled_at;not null" json:"lastPulledAt"`
+	PayloadHash  string  `gorm:"column:payload_hash;type:char(64);not null" json:"payloadHash"`
+	Outcome      string  `gorm:"column:outcome;type:varchar(16);not null" json:"outcome"`
+	Status       int     `gorm:"column:status;not null" json:"status"` // HTTP status returned
+	Error        string  `gorm:"column:error;type:text" json:"error,omitempty"`
+	Response     string  `gorm:"column:response;type:mediumtext" json:"-"`
+
+	CreatedAt time.Time `gorm:"column:created_at;type:datetime(3);not null" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"column:updated_at;type:datetime(3);not null" json:"updatedAt"`
+}
+
+func (PushLog) TableName() string {
+	return "oktedi_push_log"
+}
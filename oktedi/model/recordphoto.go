@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// RecordPhoto is the photo a kiosk took with a clock-in tap, so supervisors
+// can check who actually tapped. The image is kept in the photo store under
+// StorageKey; uploading again replaces it.
+type RecordPhoto struct {
+	RecordID    string `gorm:"primaryKey;column:record_id;type:varchar(191)" json:"recordId"`
+	StorageKey  string `gorm:"column:storage_key;type:varchar(512);not null" json:"-"`
+	ContentType string `gorm:"column:content_type;type:varchar(64);not null" json:"contentType"`
+	Size        int64  `gorm:"column:size;not null" json:"size"`
+	SHA256      string `gorm:"column:sha256;type:char(64);not null" json:"sha256"`
+	DeviceID    string `gorm:"column:device_id;type:varchar(64);not null" json:"deviceId"`
+
+	CreatedAt time.Time `gorm:"column:created_at;type:datetime(3);not null" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"column:updated_at;type:datetime(3);not null" json:"updatedAt"`
+}
+
+func (RecordPhoto) TableName() string {
+	return "oktedi_record_photos"
+}
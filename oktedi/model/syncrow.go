@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// SyncRow tracks one record served by the kiosk pull. The source tables
+// (employees, jobs, …) belong to Axiapac and carry no change timestamps, so a
+// periodic refresh hashes what would be served and stamps UpdatedAt when the
+// hash changes; DeletedAt is set once the record is no longer served.
+type SyncRow struct {
+	Collection string     `gorm:"primaryKey;column:collection;type:varchar(32)" json:"collection"`
+	RecordID   string     `gorm:"primaryKey;column:record_id;type:varchar(64)" json:"recordId"`
+	Hash       string     `gorm:"column:hash;type:char(64);not null" json:"-"`
+	CreatedAt  time.Time  `gorm:"column:created_at;type:datetime(3);not null;autoCreateTime:false" json:"createdAt"`
+	UpdatedAt  time.Time  `gorm:"column:updated_at;type:datetime(3);not null;autoUpdateTime:false" json:"updatedAt"`
+	DeletedAt  *time.Time `gorm:"column:deleted_at;type:datetime(3)" json:"deletedAt"`
+}
+
+func (SyncRow) TableName() string {
+	return "oktedi_sync_rows"
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// SyncState records when a set of sync collections was last re-hashed into
+// oktedi_sync_rows. RefreshedAt is the cursor handed to clients with what they
+// read; nil until the first refresh.
+type SyncState struct {
+	Name        string     `gorm:"primaryKey;column:name;type:varchar(32)" json:"name"`
+	RefreshedAt *time.Time `gorm:"column:refreshed_at;type:datetime(3)" json:"refreshedAt"`
+}
+
+func (SyncState) TableName() string {
+	return "oktedi_sync_state"
+}
@@ -27,6 +27,10 @@ type OktediTimesheet struct {
 	Overtime     float64   `gorm:"column:overtime;type:decimal(10,2);not null"`
 	Notes        string    `gorm:"column:notes;type:text"`
 
+	// Gap is the time, in hours, between the day's start and finish that no
+	// in/out segment covers. Hours worked out from the span must leave it out.
+	Gap float64 `gorm:"column:gap;type:decimal(10,2);not null"`
+
 	// Foreign Keys
 	EmployeeID   int32  `gorm:"column:employee_id;not null"`
 	TimesheetID  *int32 `gorm:"column:timesheet_id;null"`
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveCached(t *testing.T, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/data", func(c *gin.Context) { WriteCachedJSON(c, body) })
+
+	req := httptest.NewRequest(http.MethodGet, "/data", nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestWriteCachedJSON(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"data":"x"}`), 200)
+
+	first := serveCached(t, body, nil)
+	require.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, body, first.Body.Bytes())
+
+	notModified := serveCached(t, body, map[string]string{"If-None-Match": `"other", ` + etag})
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Empty(t, notModified.Body.Bytes())
+
+	zipped := serveCached(t, body, map[string]string{"Accept-Encoding": "br, gzip"})
+	require.Equal(t, "gzip", zipped.Header().Get("Content-Encoding"))
+	zr, err := gzip.NewReader(zipped.Body)
+	require.NoError(t, err)
+	plain, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, body, plain)
+
+	refused := serveCached(t, body, map[string]string{"Accept-Encoding": "gzip;q=0"})
+	assert.Empty(t, refused.Header().Get("Content-Encoding"))
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"sync"
+
+	oktedi "axiapac.com/axiapac/oktedi/core"
+)
+
+// attendanceBuffer is how many events a subscriber may fall behind by before
+// it is dropped.
+const attendanceBuffer = 64
+
+// AttendanceHub fans attendance events out to the dashboards subscribed to
+// each tenant. It is in-memory: a dashboard only hears about pushes handled by
+// the server it is connected to.
+type AttendanceHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan oktedi.AttendanceEvent]struct{}
+}
+
+func NewAttendanceHub() *AttendanceHub {
+	return &AttendanceHub{subscribers: make(map[string]map[chan oktedi.AttendanceEvent]struct{})}
+}
+
+// Subscribe returns the tenant's events and a function to stop receiving them.
+// The channel is closed if the subscriber falls too far behind; the client
+// should then reload the attendance and subscribe again.
+func (h *AttendanceHub) Subscribe(tenant string) (<-chan oktedi.AttendanceEvent, func()) {
+	ch := make(chan oktedi.AttendanceEvent, attendanceBuffer)
+	h.mu.Lock()
+	if h.subscribers[tenant] == nil {
+		h.subscribers[tenant] = make(map[chan oktedi.AttendanceEvent]struct{})
+	}
+	h.subscribers[tenant][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(tenant, ch)
+	}
+}
+
+// HasSubscribers reports whether anyone is listening to the tenant, so
+// publishers can skip resolving events nobody will see.
+func (h *AttendanceHub) HasSubscribers(tenant string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers[tenant]) > 0
+}
+
+// Publish sends events to the tenant's subscribers without blocking.
+func (h *AttendanceHub) Publish(tenant string, events ...oktedi.AttendanceEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers[tenant] {
+	send:
+		for _, event := range events {
+			select {
+			case ch <- event:
+			default:
+				h.remove(tenant, ch)
+				break send
+			}
+		}
+	}
+}
+
+// remove closes and forgets ch, if it is still subscribed. h.mu must be held.
+func (h *AttendanceHub) remove(tenant string, ch chan oktedi.AttendanceEvent) {
+	subs := h.subscribers[tenant]
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+	delete(subs, ch)
+	close(ch)
+	if len(subs) == 0 {
+		delete(h.subscribers, tenant)
+	}
+}
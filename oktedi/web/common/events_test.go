@@ -0,0 +1,41 @@
+package common
+
+import (
+	"testing"
+
+	oktedi "axiapac.com/axiapac/oktedi/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttendanceHub(t *testing.T) {
+	hub := NewAttendanceHub()
+	a, unsubscribeA := hub.Subscribe("tenant_a")
+	b, unsubscribeB := hub.Subscribe("tenant_b")
+	defer unsubscribeB()
+	assert.True(t, hub.HasSubscribers("tenant_a"))
+	assert.False(t, hub.HasSubscribers("tenant_c"))
+
+	hub.Publish("tenant_a", oktedi.AttendanceEvent{EmployeeID: 1}, oktedi.AttendanceEvent{EmployeeID: 2})
+	assert.Equal(t, int32(1), (<-a).EmployeeID)
+	assert.Equal(t, int32(2), (<-a).EmployeeID)
+	assert.Empty(t, b, "events stay within their tenant")
+
+	unsubscribeA()
+	_, open := <-a
+	assert.False(t, open)
+	assert.False(t, hub.HasSubscribers("tenant_a"))
+	unsubscribeA() // idempotent
+
+	// A subscriber that stops reading is dropped rather than blocking pushes.
+	for i := 0; i <= attendanceBuffer; i++ {
+		hub.Publish("tenant_b", oktedi.AttendanceEvent{EmployeeID: int32(i)})
+	}
+	for range attendanceBuffer {
+		_, open := <-b
+		require.True(t, open)
+	}
+	_, open = <-b
+	assert.False(t, open)
+	assert.False(t, hub.HasSubscribers("tenant_b"))
+}
@@ -1,16 +1,24 @@
 package common
 
 import (
-	"database/sql"
+	"errors"
 	"net"
+	"net/http"
+	"time"
 
 	"axiapac.com/axiapac/core"
+	"axiapac.com/axiapac/security"
+	web "axiapac.com/axiapac/web/common"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
 )
 
 type Handler struct {
 	Dm *core.DatabaseManager
+	// DB, when set, serves Read and Write instead of Dm (e.g. a fake in
+	// tests).
+	DB core.TenantDB
 }
 
 func GetHostname(host string) string {
@@ -20,7 +28,127 @@ func GetHostname(host string) string {
 	return host
 }
 
-func (h *Handler) GetDB(r *gin.Context) (*gorm.DB, *sql.Conn, error) {
+// GetTenant returns the request's tenant schema: the one resolved by
+// RequireTenant, or else the first label of the Host header.
+func GetTenant(c *gin.Context) string {
+	if tenant := c.GetString("tenant"); tenant != "" {
+		return tenant
+	}
+	return core.TenantFromHost(GetHostname(c.Request.Host))
+}
+
+// RequireTenant resolves the Host header to an active tenant before any handler
+// touches the database: 404 for hosts that are not tenants, 403 for deactivated
+// or expired subscriptions. The schema is stored in the context under "tenant".
+func (h *Handler) RequireTenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, err := h.Dm.ResolveTenant(c.Request.Context(), GetHostname(c.Request.Host))
+		if err != nil {
+			switch {
+			case errors.Is(err, core.ErrTenantNotFound):
+				c.AbortWithStatusJSON(http.StatusNotFound, web.NewErrorResponse(err.Error()))
+			case errors.Is(err, core.ErrTenantInactive):
+				c.AbortWithStatusJSON(http.StatusForbidden, web.NewErrorResponse(err.Error()))
+			default:
+				c.AbortWithStatusJSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+			}
+			return
+		}
+		c.Set("tenant", tenant)
+		c.Next()
+	}
+}
+
+func (h *Handler) GetDB(r *gin.Context) (*gorm.DB, *core.Conn, error) {
 	hostname := GetHostname(r.Request.Host)
 	return h.Dm.GetDB(r.Request.Context(), hostname)
 }
+
+func (h *Handler) tenantDB() core.TenantDB {
+	if h.DB != nil {
+		return h.DB
+	}
+	return h.Dm
+}
+
+// Read runs fn on the tenant's read replica (the primary when there is none,
+// or after a recent write; see ReadYourWrites). Use it for read-only
+// endpoints.
+func (h *Handler) Read(c *gin.Context, fn func(db *gorm.DB) error) error {
+	return h.tenantDB().ExecRead(c.Request.Context(), GetHostname(c.Request.Host), fn)
+}
+
+// Write runs fn on the tenant's primary.
+func (h *Handler) Write(c *gin.Context, fn func(db *gorm.DB) error) error {
+	return h.tenantDB().Exec(c.Request.Context(), GetHostname(c.Request.Host), fn)
+}
+
+// readPrimaryCookie marks a client that wrote recently; its reads go to the
+// primary until the cookie expires.
+const readPrimaryCookie = "axiapac.ReadPrimary"
+
+// ReadYourWrites pins reads to the primary for `window` after a client's last
+// write, so a dashboard that just saved a timesheet doesn't read a stale
+// replica. Writes (any method but GET/HEAD/OPTIONS) set a cookie for the
+// window; clients without cookies (kiosks) can send `X-Read-Primary: true`.
+// readOnly lists the full paths of POST routes that only read, such as
+// searches taking a body; they are treated like GETs.
+func (h *Handler) ReadYourWrites(window time.Duration, readOnly ...string) gin.HandlerFunc {
+	reads := make(map[string]bool, len(readOnly))
+	for _, path := range readOnly {
+		reads[path] = true
+	}
+	return func(c *gin.Context) {
+		primary := c.GetHeader("X-Read-Primary") == "true"
+		if _, err := c.Cookie(readPrimaryCookie); err == nil {
+			primary = true
+		}
+
+		switch {
+		case c.Request.Method == http.MethodGet, c.Request.Method == http.MethodHead, c.Request.Method == http.MethodOptions:
+		case reads[c.FullPath()]:
+		default:
+			primary = true
+			// Set before the handler runs; headers are gone once it writes.
+			c.SetCookie(readPrimaryCookie, "1", int(window/time.Second), "/", "", c.Request.TLS != nil, true)
+		}
+
+		if primary {
+			c.Request = c.Request.WithContext(core.WithPrimary(c.Request.Context()))
+		}
+		c.Next()
+	}
+}
+
+// GetUserID pulls the authenticated user's id from the `nameid` claim, which the
+// auth middleware attaches. Handles both string and numeric JSON encodings.
+func GetUserID(c *gin.Context) (int32, bool) {
+	v, ok := c.Get("claims")
+	if !ok {
+		return 0, false
+	}
+	claims, ok := v.(jwt.MapClaims)
+	if !ok {
+		return 0, false
+	}
+	return security.ClaimUserID(claims)
+}
+
+// GetDeviceID returns the kiosk device id from the `sid` claim of a device
+// access token, or "" for other tokens. Only device tokens (provider
+// "device") count: other tokens may carry a placeholder `sid`.
+func GetDeviceID(c *gin.Context) string {
+	v, ok := c.Get("claims")
+	if !ok {
+		return ""
+	}
+	claims, ok := v.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	if provider, _ := claims["provider"].(string); provider != "device" {
+		return ""
+	}
+	sid, _ := claims["sid"].(string)
+	return sid
+}
@@ -0,0 +1,57 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadYourWrites(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api")
+	api.Use((&Handler{}).ReadYourWrites(10*time.Second, api.BasePath()+"/timesheets/search"))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api.GET("/timesheets/:id", ok)
+	api.POST("/timesheets/search", ok)
+	api.POST("/timesheets/prepare", ok)
+
+	tests := []struct {
+		method, path string
+		pinned       bool
+	}{
+		{http.MethodGet, "/api/timesheets/1", false},
+		{http.MethodPost, "/api/timesheets/search", false},
+		{http.MethodPost, "/api/timesheets/prepare", true},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		pinned := false
+		for _, cookie := range w.Result().Cookies() {
+			pinned = pinned || cookie.Name == readPrimaryCookie
+		}
+		assert.Equal(t, tt.pinned, pinned, "%s %s", tt.method, tt.path)
+	}
+}
+
+func TestGetDeviceID(t *testing.T) {
+	tests := []struct {
+		claims jwt.MapClaims
+		device string
+	}{
+		{jwt.MapClaims{"provider": "device", "sid": "kiosk-1"}, "kiosk-1"},
+		{jwt.MapClaims{"provider": "axiapac", "sid": "axgo-deviceId"}, ""},
+		{jwt.MapClaims{"sid": "kiosk-1"}, ""},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Set("claims", tt.claims)
+		assert.Equal(t, tt.device, GetDeviceID(c), "%v", tt.claims)
+	}
+}
@@ -0,0 +1,66 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"axiapac.com/axiapac/core"
+	web "axiapac.com/axiapac/web/common"
+	"github.com/gin-gonic/gin"
+)
+
+// Axiapac modules (RolePermissions.Module) that gate the oktedi routes.
+const (
+	ModuleTimesheets = "Timesheets"
+	ModuleEmployees  = "Employees"
+)
+
+// RequirePermission only lets the request through when the authenticated user
+// (JWT `nameid`) holds at least `level` on `module` through their roles.
+// Mount it after the authentication middleware. The resolved permissions are
+// stored in the context under "permissions".
+func (h *Handler) RequirePermission(module string, level core.AccessLevel) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := GetUserID(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, web.NewErrorResponse("no authenticated user"))
+			return
+		}
+
+		perms, err := h.permissions(c, userID)
+		if err != nil {
+			if errors.Is(err, core.ErrUserNotFound) {
+				c.AbortWithStatusJSON(http.StatusForbidden, web.NewErrorResponse(err.Error()))
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+			return
+		}
+
+		if !perms.Allows(module, level) {
+			c.AbortWithStatusJSON(http.StatusForbidden, web.NewErrorResponse(
+				fmt.Sprintf("permission denied: %s access to %s is required", level, module)))
+			return
+		}
+
+		c.Set("permissions", perms)
+		c.Next()
+	}
+}
+
+func (h *Handler) permissions(c *gin.Context, userID int32) (*core.UserPermissions, error) {
+	if v, ok := c.Get("permissions"); ok {
+		if perms, ok := v.(*core.UserPermissions); ok && perms.UserID == userID {
+			return perms, nil
+		}
+	}
+
+	db, conn, err := h.GetDB(c)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return core.LoadUserPermissions(db, userID)
+}
@@ -0,0 +1,29 @@
+package common
+
+import (
+	"errors"
+	"time"
+
+	"axiapac.com/axiapac/core"
+	oktedi "axiapac.com/axiapac/oktedi/core"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ReadSynced runs read, which serves the sync `name`, on the replica. When
+// read finds the sync rows due a refresh (oktedi.ErrSyncStale), the sources
+// are refreshed on the primary and read runs again there, in the same
+// transaction, so what it serves matches the new cursor.
+func ReadSynced(c *gin.Context, dm *core.DatabaseManager, name string, sources []oktedi.SyncSource, now time.Time, read func(db *gorm.DB) error) error {
+	hostname := GetHostname(c.Request.Host)
+	err := dm.ExecRead(c.Request.Context(), hostname, read)
+	if !errors.Is(err, oktedi.ErrSyncStale) {
+		return err
+	}
+	return dm.Transaction(c.Request.Context(), hostname, func(tx *gorm.DB) error {
+		if err := oktedi.RefreshSync(tx, name, sources, now); err != nil {
+			return err
+		}
+		return read(tx)
+	})
+}
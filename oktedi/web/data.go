@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"axiapac.com/axiapac/core"
+	oktedi "axiapac.com/axiapac/oktedi/core"
+	oktedicommon "axiapac.com/axiapac/oktedi/web/common"
+	"axiapac.com/axiapac/web/common"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Collections tracking /data's rows in oktedi_sync_rows. They are separate
+// from the /pull collections because the fields served differ.
+const (
+	dataEmployees   = "data_employees"
+	dataJobs        = "data_jobs"
+	dataCostCentres = "data_cost_centres"
+)
+
+// dataSync names /data's refresh in oktedi_sync_state.
+const dataSync = "data"
+
+// dataSources are /data's collections, keyed as their deleted ids are.
+var dataSources = []oktedi.SyncSource{
+	{Collection: dataEmployees, Load: syncLoader(loadEmployees, func(e EmployeeInfo) string { return idKey(e.ID) })},
+	{Collection: dataJobs, Load: syncLoader(loadJobs, func(j JobInfo) string { return idKey(j.ID) })},
+	{Collection: dataCostCentres, Load: syncLoader(loadCostCentres, costCentreKey)},
+}
+
+type Data struct {
+	Employees   []EmployeeInfo   `json:"employees"`
+	Jobs        []JobInfo        `json:"jobs"`
+	CostCentres []CostCentreInfo `json:"costCentres"`
+	// Deleted lists the ids removed since the `since` cursor; absent from a
+	// full response.
+	Deleted *DeletedData `json:"deleted,omitempty"`
+}
+
+type DeletedData struct {
+	Employees   []uint          `json:"employees"`
+	Jobs        []uint          `json:"jobs"`
+	CostCentres []CostCentreKey `json:"costCentres"`
+}
+
+// CostCentreKey identifies a cost centre on a job; a cost centre can be on
+// several jobs.
+type CostCentreKey struct {
+	JobId int  `json:"jobId"`
+	ID    uint `json:"id"`
+}
+
+type JobInfo struct {
+	ID          uint   `json:"id"`
+	JobNo       string `json:"jobNo"`
+	Description string `json:"description"`
+}
+
+type CostCentreInfo struct {
+	ID          uint   `json:"id"`
+	JobId       int    `json:"jobId"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+// referenceData serves the kiosk's employees, jobs and cost centres.
+//
+//	GET /data              everything
+//	GET /data?since=<ms>   only rows changed since, plus deleted ids
+//
+// The X-Data-Version header is the cursor for the next `since`. Responses
+// carry an ETag (304 on If-None-Match) and are gzipped on request.
+func referenceData(dm *core.DatabaseManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var since time.Time
+		if q := c.Query("since"); q != "" {
+			ms, err := strconv.ParseInt(q, 10, 64)
+			if err != nil || ms <= 0 {
+				c.JSON(http.StatusBadRequest, common.NewErrorResponse("invalid since; expected the X-Data-Version of an earlier response"))
+				return
+			}
+			since = time.UnixMilli(ms)
+		}
+
+		// Both modes read the replica, taking the version from the same
+		// reads; the first request after the sync rows go stale refreshes
+		// them on the primary.
+		now := time.Now()
+		var data Data
+		var version time.Time
+		if err := oktedicommon.ReadSynced(c, dm, dataSync, dataSources, now, func(db *gorm.DB) error {
+			var err error
+			if version, err = oktedi.SyncVersion(db, dataSync, now); err != nil {
+				return err
+			}
+			if since.IsZero() {
+				data, err = loadReferenceData(db)
+			} else {
+				data, err = changedReferenceData(db, since)
+			}
+			return err
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, common.NewErrorResponse(err.Error()))
+			return
+		}
+
+		body, err := json.Marshal(common.NewSuccessResponse(data))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, common.NewErrorResponse(err.Error()))
+			return
+		}
+		c.Header("X-Data-Version", strconv.FormatInt(version.UnixMilli(), 10))
+		oktedicommon.WriteCachedJSON(c, body)
+	}
+}
+
+func loadReferenceData(db *gorm.DB) (Data, error) {
+	var data Data
+	var err error
+	if data.Employees, err = loadEmployees(db, nil); err != nil {
+		return data, err
+	}
+	if data.Jobs, err = loadJobs(db, nil); err != nil {
+		return data, err
+	}
+	data.CostCentres, err = loadCostCentres(db, nil)
+	return data, err
+}
+
+// loadEmployees loads the employees in ids, or all of them when ids is nil.
+func loadEmployees(db *gorm.DB, ids []string) ([]EmployeeInfo, error) {
+	query := db.Table("employees")
+	if ids != nil {
+		query = query.Where("employees.employeeid IN ?", ids).Order("employees.employeeid")
+	}
+	var employees []EmployeeInfo
+	err := query.
+		Select(`
+		employees.employeeid as id,
+        employees.identificationTag as tag,
+		employees.code as code,
+		employees.picture as avatar,
+        employees.firstname as first_name,
+        employees.surname as last_name,
+		employees.jobid as job_id,
+		employees.costcentreid AS cost_centre_id,
+        employees.reportstoid as supervisor_id,
+		CAST(JSON_EXTRACT(employees.attributes, '$.backToBack.id') AS UNSIGNED) as back_to_back_id
+    `).
+		Scan(&employees).Error
+	return employees, err
+}
+
+// loadJobs loads the jobs in ids, or all of them when ids is nil.
+func loadJobs(db *gorm.DB, ids []string) ([]JobInfo, error) {
+	query := db.Table("jobs")
+	if ids != nil {
+		query = query.Where("jobs.jobid IN ?", ids).Order("jobs.jobid")
+	}
+	var jobs []JobInfo
+	err := query.
+		Select(`
+		jobs.jobid as id,
+        jobs.jobno as job_no,
+        jobs.description as description
+    `).
+		Scan(&jobs).Error
+	return jobs, err
+}
+
+// loadCostCentres loads the job cost centres keyed in ids, or all of them
+// when ids is nil.
+func loadCostCentres(db *gorm.DB, ids []string) ([]CostCentreInfo, error) {
+	query := db.Table("jobcostcentres jcc").Joins("JOIN costcentres cc USING (costcentreid)")
+	if ids != nil {
+		pairs := oktedi.JobCostCentrePairs(ids)
+		if len(pairs) == 0 {
+			return []CostCentreInfo{}, nil
+		}
+		query = query.Where("(jcc.jobid, jcc.costcentreid) IN ?", pairs).Order("jcc.jobid, jcc.costcentreid")
+	}
+	var costCentres []CostCentreInfo
+	err := query.
+		Select(`
+			jcc.jobid AS job_id,
+			cc.costcentreid AS id,
+			cc.code AS code,
+			cc.description AS description
+		`).
+		Scan(&costCentres).Error
+	return costCentres, err
+}
+
+// syncLoader adapts a /data loader to oktedi.SyncSource.Load.
+func syncLoader[T any](load func(db *gorm.DB, ids []string) ([]T, error), key func(T) string) func(*gorm.DB, []string, time.Time) (map[string]any, error) {
+	return func(db *gorm.DB, ids []string, _ time.Time) (map[string]any, error) {
+		rows, err := load(db, ids)
+		if err != nil {
+			return nil, err
+		}
+		byKey := make(map[string]any, len(rows))
+		for _, row := range rows {
+			byKey[key(row)] = row
+		}
+		return byKey, nil
+	}
+}
+
+// changedReferenceData loads the rows changed after since, as of the last
+// refresh, and the deleted ids.
+func changedReferenceData(db *gorm.DB, since time.Time) (Data, error) {
+	data := Data{Deleted: &DeletedData{}}
+	var err error
+	if data.Employees, data.Deleted.Employees, err = changedRows(db, dataEmployees, loadEmployees, parseIDKey, since); err != nil {
+		return data, err
+	}
+	if data.Jobs, data.Deleted.Jobs, err = changedRows(db, dataJobs, loadJobs, parseIDKey, since); err != nil {
+		return data, err
+	}
+	data.CostCentres, data.Deleted.CostCentres, err = changedRows(db, dataCostCentres, loadCostCentres, parseCostCentreKey, since)
+	return data, err
+}
+
+// changedRows loads the rows of collection changed after since, and the keys
+// of those removed, parsed by deletedKey. Keys it can't parse are left out.
+func changedRows[T, K any](db *gorm.DB, collection string, load func(db *gorm.DB, ids []string) ([]T, error), deletedKey func(string) (K, bool), since time.Time) ([]T, []K, error) {
+	changed, deleted, err := oktedi.ChangedSince(db, collection, since)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows := make([]T, 0, len(changed))
+	for start := 0; start < len(changed); start += dataBatch {
+		batch, err := load(db, changed[start:min(start+dataBatch, len(changed))])
+		if err != nil {
+			return nil, nil, err
+		}
+		rows = append(rows, batch...)
+	}
+	deletedKeys := make([]K, 0, len(deleted))
+	for _, k := range deleted {
+		if parsed, ok := deletedKey(k); ok {
+			deletedKeys = append(deletedKeys, parsed)
+		}
+	}
+	return rows, deletedKeys, nil
+}
+
+// dataBatch bounds the ids loaded per query.
+const dataBatch = 500
+
+func idKey(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+func parseIDKey(key string) (uint, bool) {
+	n, err := strconv.ParseUint(key, 10, 64)
+	return uint(n), err == nil
+}
+
+// costCentreKey is "<job id>-<cost centre id>".
+func costCentreKey(cc CostCentreInfo) string {
+	return strconv.Itoa(cc.JobId) + "-" + idKey(cc.ID)
+}
+
+func parseCostCentreKey(key string) (CostCentreKey, bool) {
+	job, id, ok := strings.Cut(key, "-")
+	if !ok {
+		return CostCentreKey{}, false
+	}
+	jobID, err := strconv.Atoi(job)
+	if err != nil {
+		return CostCentreKey{}, false
+	}
+	ccID, ok := parseIDKey(id)
+	return CostCentreKey{JobId: jobID, ID: ccID}, ok
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCostCentreKey(t *testing.T) {
+	// Cost centre 7 on jobs 1 and 2 is two rows.
+	a := costCentreKey(CostCentreInfo{JobId: 1, ID: 7})
+	b := costCentreKey(CostCentreInfo{JobId: 2, ID: 7})
+	assert.Equal(t, "1-7", a)
+	assert.NotEqual(t, a, b)
+
+	key, ok := parseCostCentreKey(b)
+	assert.True(t, ok)
+	assert.Equal(t, CostCentreKey{JobId: 2, ID: 7}, key)
+
+	// Keys from before cost centres were keyed by job.
+	_, ok = parseCostCentreKey("7")
+	assert.False(t, ok)
+}
@@ -1,6 +1,7 @@
 package dashboard
 
 import (
+	"io"
 	"net/http"
 	"strconv"
 	"time"
@@ -11,16 +12,22 @@ import (
 	"axiapac.com/axiapac/utils"
 	web "axiapac.com/axiapac/web/common"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// streamHeartbeat keeps idle event streams open through proxies.
+const streamHeartbeat = 25 * time.Second
+
 type Endpoint struct {
 	base common.Handler
+	hub  *common.AttendanceHub
 }
 
-func Register(r *gin.RouterGroup, dm *core.DatabaseManager) {
-	endpoint := &Endpoint{base: common.Handler{Dm: dm}}
+func Register(r *gin.RouterGroup, dm *core.DatabaseManager, hub *common.AttendanceHub) {
+	endpoint := &Endpoint{base: common.Handler{Dm: dm}, hub: hub}
 	r.GET("/dashboard/attendance", endpoint.Attendance)
-	r.GET("/dashboard/evacuation-register", endpoint.EvacuationRegister)
+	r.GET("/dashboard/attendance/stream", endpoint.AttendanceStream)
+	r.GET("/dashboard/evacuation-register", endpoint.base.RequirePermission(common.ModuleEmployees, core.AccessRead), endpoint.EvacuationRegister)
 }
 
 // Attendance returns the full per-employee attendance view for a date. The
@@ -41,15 +48,12 @@ func (ep *Endpoint) Attendance(c *gin.Context) {
 		date = parsed
 	}
 
-	db, conn, err := ep.base.GetDB(c)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
-		return
-	}
-	defer conn.Close()
-
-	result, err := oktedi.LoadAttendance(db, date, now)
-	if err != nil {
+	var result *oktedi.AttendanceResult
+	if err := ep.base.Read(c, func(db *gorm.DB) error {
+		var err error
+		result, err = oktedi.LoadAttendance(db, date, now)
+		return err
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
 		return
 	}
@@ -57,10 +61,47 @@ func (ep *Endpoint) Attendance(c *gin.Context) {
 	c.JSON(http.StatusOK, web.NewSuccessResponse(result))
 }
 
+// AttendanceStream sends the tenant's attendance events as kiosk pushes arrive,
+// as Server-Sent Events named "attendance" with an oktedi.AttendanceEvent as
+// data. The client loads GET /dashboard/attendance first, then applies each
+// event to the row for its employee and date. When the stream ends the client
+// should reload and reconnect, since events may have been missed.
+//
+//	GET /dashboard/attendance/stream
+func (ep *Endpoint) AttendanceStream(c *gin.Context) {
+	events, unsubscribe := ep.hub.Subscribe(common.GetTenant(c))
+	defer unsubscribe()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // stop nginx buffering the stream
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent("attendance", event)
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
 // EvacuationRegister streams the Major Projects Attendance/ Evacuation Register
 // as a PDF for a date, optionally scoped to a single project. It reuses the
 // attendance read, then applies the register's own rules (clocked-in-only at a
-// mapped device, area from device) inside EvacuationRegisterPDF.
+// device with a registered area) inside EvacuationRegisterPDF.
 //
 //	GET /dashboard/evacuation-register?date=YYYY-MM-DD&projectId=N  (both optional)
 func (ep *Endpoint) EvacuationRegister(c *gin.Context) {
@@ -76,15 +117,12 @@ func (ep *Endpoint) EvacuationRegister(c *gin.Context) {
 		date = parsed
 	}
 
-	db, conn, err := ep.base.GetDB(c)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
-		return
-	}
-	defer conn.Close()
-
-	result, err := oktedi.LoadAttendance(db, date, now)
-	if err != nil {
+	var result *oktedi.AttendanceResult
+	if err := ep.base.Read(c, func(db *gorm.DB) error {
+		var err error
+		result, err = oktedi.LoadAttendance(db, date, now)
+		return err
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
 		return
 	}
@@ -0,0 +1,385 @@
+package device
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"axiapac.com/axiapac/core"
+	"axiapac.com/axiapac/core/models"
+	oktedi "axiapac.com/axiapac/oktedi/core"
+	"axiapac.com/axiapac/oktedi/model"
+	common "axiapac.com/axiapac/oktedi/web/common"
+	"axiapac.com/axiapac/security"
+	web "axiapac.com/axiapac/web/common"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type Endpoint struct {
+	base    common.Handler
+	keyring *security.Keyring
+}
+
+// Register adds the admin device endpoints to the authenticated group.
+func Register(r *gin.RouterGroup, dm *core.DatabaseManager, keyring *security.Keyring) {
+	endpoint := &Endpoint{base: common.Handler{Dm: dm}, keyring: keyring}
+	r.GET("/devices", endpoint.base.RequirePermission(common.ModuleTimesheets, core.AccessRead), endpoint.List)
+	r.GET("/devices/:id", endpoint.base.RequirePermission(common.ModuleTimesheets, core.AccessRead), endpoint.Get)
+	r.PUT("/devices/:id", endpoint.Update)
+	r.DELETE("/devices/:id", endpoint.Revoke)
+	r.POST("/devices/:id/enrollment", endpoint.CreateEnrollment)
+	r.POST("/devices/:id/revoke", endpoint.Revoke)
+	r.GET("/devices/:id/pushes", endpoint.base.RequirePermission(common.ModuleTimesheets, core.AccessRead), endpoint.Pushes)
+}
+
+// RegisterPublic adds the endpoints a kiosk calls before it holds an access
+// token. They must be mounted outside the authentication middleware.
+func RegisterPublic(r *gin.RouterGroup, dm *core.DatabaseManager, keyring *security.Keyring) {
+	endpoint := &Endpoint{base: common.Handler{Dm: dm}, keyring: keyring}
+	r.POST("/devices/enroll", endpoint.Enroll)
+	r.POST("/devices/token", endpoint.Token)
+}
+
+type CreateEnrollmentDTO struct {
+	// UserID is the user the kiosk acts as. It must not be a system
+	// administrator.
+	UserID int32 `json:"userId" binding:"required"`
+}
+
+type EnrollmentDTO struct {
+	DeviceID  string    `json:"deviceId"`
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type UpdateDeviceDTO struct {
+	Name             string `json:"name" binding:"max=100"`
+	Area             string `json:"area" binding:"max=100"`
+	DefaultProjectID *int32 `json:"defaultProjectId"`
+}
+
+type EnrollDTO struct {
+	DeviceID string `json:"deviceId" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type RefreshDTO struct {
+	DeviceID     string `json:"deviceId" binding:"required"`
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+type TokenDTO struct {
+	AccessToken      string    `json:"accessToken"`
+	ExpiresIn        int64     `json:"expiresIn"` // seconds
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+// CreateEnrollment issues a one-time enrollment code for the device in the
+// path, acting as the user in the body. The code is shown once; the kiosk
+// redeems it at POST /devices/enroll.
+//
+//	POST /devices/:id/enrollment  {"userId": 42}
+func (ep *Endpoint) CreateEnrollment(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	var body CreateEnrollmentDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse(web.FormatBindingError(err)))
+		return
+	}
+
+	db, conn, err := ep.base.GetDB(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+	defer conn.Close()
+
+	userID, ok := requireAdmin(c, db, "enroll devices")
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	code, err := oktedi.CreateDeviceEnrollment(db, deviceID, body.UserID, now)
+	if err != nil {
+		if errors.Is(err, oktedi.ErrKioskUserAdmin) || errors.Is(err, core.ErrUserNotFound) {
+			c.JSON(http.StatusBadRequest, web.NewErrorResponse(err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+
+	auditMsg := "Enrollment code issued for device " + deviceID
+	if err := core.AuditChange(db, userID, "Device", 0, 2, c.ClientIP(), "Kiosk device enrollment", auditMsg, auditMsg); err != nil {
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, web.NewSuccessResponse(EnrollmentDTO{
+		DeviceID:  deviceID,
+		Code:      code,
+		ExpiresAt: now.Add(oktedi.DeviceEnrollmentCodeTTL),
+	}))
+}
+
+// Revoke blocks a device from refreshing its tokens. It also serves
+// DELETE /devices/:id: the registry row stays so the device's earlier taps
+// keep their area and default project.
+func (ep *Endpoint) Revoke(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	db, conn, err := ep.base.GetDB(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+	defer conn.Close()
+
+	userID, ok := requireAdmin(c, db, "revoke devices")
+	if !ok {
+		return
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := oktedi.RevokeDevice(tx, deviceID, time.Now()); err != nil {
+			return err
+		}
+		auditMsg := "Device " + deviceID + " revoked"
+		return core.AuditChange(tx, userID, "Device", 0, 2, c.ClientIP(), "Kiosk device revoked", auditMsg, auditMsg)
+	}); err != nil {
+		if errors.Is(err, oktedi.ErrDeviceNotFound) {
+			c.JSON(http.StatusNotFound, web.NewErrorResponse(err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, web.NewSuccessResponse(gin.H{}))
+}
+
+// List returns the device registry.
+func (ep *Endpoint) List(c *gin.Context) {
+	var devices []model.Device
+	if err := ep.base.Read(c, func(db *gorm.DB) error {
+		var err error
+		devices, err = oktedi.ListDevices(db)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, web.NewSuccessResponse(devices))
+}
+
+// Get returns one device's registry entry.
+func (ep *Endpoint) Get(c *gin.Context) {
+	var device *model.Device
+	if err := ep.base.Read(c, func(db *gorm.DB) error {
+		var err error
+		device, err = oktedi.GetDevice(db, c.Param("id"))
+		return err
+	}); err != nil {
+		if errors.Is(err, oktedi.ErrDeviceNotFound) {
+			c.JSON(http.StatusNotFound, web.NewErrorResponse(err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, web.NewSuccessResponse(device))
+}
+
+// Update sets a device's name, area and default project, registering the
+// device if it is new.
+func (ep *Endpoint) Update(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	var body UpdateDeviceDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse(web.FormatBindingError(err)))
+		return
+	}
+
+	db, conn, err := ep.base.GetDB(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+	defer conn.Close()
+
+	userID, ok := requireAdmin(c, db, "edit devices")
+	if !ok {
+		return
+	}
+
+	var device *model.Device
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		device, err = oktedi.SaveDeviceDetails(tx, deviceID, oktedi.DeviceDetails{
+			Name:             body.Name,
+			Area:             body.Area,
+			DefaultProjectID: body.DefaultProjectID,
+		})
+		if err != nil {
+			return err
+		}
+		auditMsg := "Device " + deviceID + " details updated"
+		return core.AuditChange(tx, userID, "Device", 0, 2, c.ClientIP(), "Kiosk device updated", auditMsg, auditMsg)
+	}); err != nil {
+		if errors.Is(err, oktedi.ErrUnknownProject) {
+			c.JSON(http.StatusBadRequest, web.NewErrorResponse(err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, web.NewSuccessResponse(device))
+}
+
+// Pushes lists the device's most recent push receipts, newest first, so
+// support can see whether a tap ever reached the server.
+//
+//	GET /devices/:id/pushes?limit=50  (limit optional, at most 500)
+func (ep *Endpoint) Pushes(c *gin.Context) {
+	limit := 50
+	if q := c.Query("limit"); q != "" {
+		n, err := strconv.Atoi(q)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, web.NewErrorResponse("invalid limit"))
+			return
+		}
+		limit = n
+	}
+
+	var receipts []model.PushLog
+	if err := ep.base.Read(c, func(db *gorm.DB) error {
+		var err error
+		receipts, err = oktedi.ListPushes(db, c.Param("id"), limit)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, web.NewSuccessResponse(receipts))
+}
+
+// Enroll redeems a one-time enrollment code for the first token pair.
+func (ep *Endpoint) Enroll(c *gin.Context) {
+	var body EnrollDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse(web.FormatBindingError(err)))
+		return
+	}
+
+	db, conn, err := ep.base.GetDB(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+	defer conn.Close()
+
+	var grant *oktedi.DeviceGrant
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		grant, err = oktedi.EnrollDevice(tx, body.DeviceID, body.Code, time.Now())
+		return err
+	}); err != nil {
+		ep.credentialError(c, err)
+		return
+	}
+	ep.issueTokens(c, grant)
+}
+
+// Token exchanges a refresh token for a new access token and a rotated
+// refresh token.
+func (ep *Endpoint) Token(c *gin.Context) {
+	var body RefreshDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse(web.FormatBindingError(err)))
+		return
+	}
+
+	db, conn, err := ep.base.GetDB(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+	defer conn.Close()
+
+	var grant *oktedi.DeviceGrant
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		grant, err = oktedi.RefreshDevice(tx, body.DeviceID, body.RefreshToken, time.Now())
+		return err
+	}); err != nil {
+		ep.credentialError(c, err)
+		return
+	}
+	ep.issueTokens(c, grant)
+}
+
+func (ep *Endpoint) issueTokens(c *gin.Context, grant *oktedi.DeviceGrant) {
+	device := grant.Device
+	ttl := int64(oktedi.DeviceAccessTokenTTL / time.Second)
+	accessToken, err := ep.keyring.CreateIdentityToken(&security.AxiapacIdentity{
+		Id:            int(device.UserID),
+		UserName:      "kiosk:" + device.ID,
+		Provider:      "device",
+		Tenant:        common.GetTenant(c),
+		DeviceID:      device.ID,
+		SecurityStamp: grant.SecurityStamp,
+	}, ttl)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, web.NewSuccessResponse(TokenDTO{
+		AccessToken:      accessToken,
+		ExpiresIn:        ttl,
+		RefreshToken:     grant.RefreshToken,
+		RefreshExpiresAt: *device.RefreshExpiresAt,
+	}))
+}
+
+// requireAdmin returns the calling user's id, or answers 401/403 and returns
+// false unless they are a system administrator.
+func requireAdmin(c *gin.Context, db *gorm.DB, action string) (int32, bool) {
+	userID, ok := common.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, web.NewErrorResponse("no authenticated user"))
+		return 0, false
+	}
+	var user models.User
+	if err := db.Where("Id = ?", userID).Take(&user).Error; err != nil || !user.SysAdmin {
+		c.JSON(http.StatusForbidden, web.NewErrorResponse("only administrators can "+action))
+		return 0, false
+	}
+	return userID, true
+}
+
+// credentialError maps enrollment/refresh failures to 401 without revealing
+// which part of the credential was wrong.
+func (ep *Endpoint) credentialError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, oktedi.ErrDeviceRevoked),
+		errors.Is(err, core.ErrUserDeactivated),
+		errors.Is(err, core.ErrUserLockedOut):
+		c.JSON(http.StatusUnauthorized, web.NewErrorResponse(err.Error()))
+	case errors.Is(err, oktedi.ErrDeviceNotFound),
+		errors.Is(err, core.ErrUserNotFound),
+		errors.Is(err, oktedi.ErrInvalidEnrollmentCode),
+		errors.Is(err, oktedi.ErrInvalidRefreshToken):
+		c.JSON(http.StatusUnauthorized, web.NewErrorResponse("invalid device credentials"))
+	default:
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+	}
+}
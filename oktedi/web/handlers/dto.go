@@ -6,6 +6,9 @@ import "time"
 type WatermelonPush struct {
 	Changes      Changes `json:"changes"`
 	LastPulledAt int64   `json:"lastPulledAt"`
+	// BatchID identifies the push across retries; a batch already applied is
+	// answered from the push log instead of being applied again.
+	BatchID string `json:"batchId" binding:"max=64"`
 }
 
 type Changes struct {
@@ -19,6 +22,10 @@ type EmployeeClockInRecord struct {
 	Timestamp time.Time `json:"timestamp"`
 	CardID    string    `json:"cardId"`
 	DeviceID  string    `json:"deviceId"`
+	// Optional GPS fix: decimal degrees, accuracy in metres.
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Accuracy  *float64 `json:"accuracy"`
 
 	Status  string `json:"_status"`
 	Changed string `json:"_changed"`
@@ -27,5 +34,12 @@ type EmployeeClockInRecord struct {
 type Records struct {
 	Created []EmployeeClockInRecord `json:"created"`
 	Updated []EmployeeClockInRecord `json:"updated"`
-	Deleted []EmployeeClockInRecord `json:"deleted"`
+	Deleted []string                `json:"deleted"` // ids only, as WatermelonDB sends them
+}
+
+// WatermelonPull is the pull request body. LastPulledAt is the timestamp the
+// previous pull returned (Unix milliseconds); null or 0 on the first pull.
+type WatermelonPull struct {
+	LastPulledAt  *int64 `json:"lastPulledAt"`
+	SchemaVersion int    `json:"schemaVersion"`
 }
@@ -0,0 +1,181 @@
+package employee
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"axiapac.com/axiapac/core"
+	oktedicore "axiapac.com/axiapac/oktedi/core"
+	"axiapac.com/axiapac/oktedi/model"
+	common "axiapac.com/axiapac/oktedi/web/common"
+	"axiapac.com/axiapac/utils"
+	web "axiapac.com/axiapac/web/common"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AssignCardDTO struct {
+	// Tag is the card to assign; empty takes the employee's card back.
+	Tag string `json:"tag" binding:"max=191"`
+	// EffectiveFrom (YYYY-MM-DD) defaults to today.
+	EffectiveFrom string `json:"effectiveFrom"`
+}
+
+type CardStatusDTO struct {
+	Status string `json:"status" binding:"required,oneof=lost revoked unassigned"`
+	Notes  string `json:"notes" binding:"max=255"`
+	// Date (YYYY-MM-DD) is the holder's last day with the card; defaults to
+	// today.
+	Date string `json:"date"`
+}
+
+type CardDTO struct {
+	model.Card
+	Assignments []model.CardAssignment `json:"assignments"`
+}
+
+// AssignCard assigns an NFC card to the employee, ending the one they held.
+// A card someone else holds is a 409 "card_in_use", and a lost or revoked one
+// a 409 "card_unavailable".
+//
+//	PUT /employees/:id  {"tag": "04A2...", "effectiveFrom": "2026-01-12"}
+func (ep *Endpoint) AssignCard(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse("invalid employee id"))
+		return
+	}
+	var body AssignCardDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse(web.FormatBindingError(err)))
+		return
+	}
+	from, ok := cardDate(c, body.EffectiveFrom)
+	if !ok {
+		return
+	}
+
+	userID, _ := common.GetUserID(c)
+	if err := ep.base.Write(c, func(db *gorm.DB) error {
+		return core.RetryTransaction(db, func(tx *gorm.DB) error {
+			if err := oktedicore.AssignCard(tx, int32(id), body.Tag, from, userID); err != nil {
+				return err
+			}
+			auditMsg := "Identification Tag changed to " + body.Tag
+			if body.Tag != "" {
+				auditMsg += " from " + from
+			}
+			return core.AuditChange(tx, userID, "Employee", int32(id), 2, c.ClientIP(), "Employee identificationtag updated", auditMsg, auditMsg)
+		})
+	}); err != nil {
+		writeCardError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, web.NewSuccessResponse(gin.H{}))
+}
+
+// Cards returns the employee's card history, latest first.
+func (ep *Endpoint) Cards(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse("invalid employee id"))
+		return
+	}
+
+	var assignments []model.CardAssignment
+	if err := ep.base.Read(c, func(db *gorm.DB) error {
+		assignments, err = oktedicore.CardAssignments(db, int32(id))
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, web.NewSuccessResponse(assignments))
+}
+
+// Card returns a card and who held it, latest first.
+func (ep *Endpoint) Card(c *gin.Context) {
+	var dto CardDTO
+	if err := ep.base.Read(c, func(db *gorm.DB) error {
+		card, assignments, err := oktedicore.GetCard(db, c.Param("tag"))
+		if err != nil {
+			return err
+		}
+		dto = CardDTO{Card: *card, Assignments: assignments}
+		return nil
+	}); err != nil {
+		writeCardError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, web.NewSuccessResponse(dto))
+}
+
+// SetCardStatus reports a card lost, revokes it, or records it handed back.
+// Its holder loses it after Date. A lost card can be assigned again once it is
+// marked unassigned; a revoked one never can.
+//
+//	PUT /cards/:tag/status  {"status": "lost", "notes": "lost on shift"}
+func (ep *Endpoint) SetCardStatus(c *gin.Context) {
+	tag := c.Param("tag")
+	var body CardStatusDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse(web.FormatBindingError(err)))
+		return
+	}
+	on, ok := cardDate(c, body.Date)
+	if !ok {
+		return
+	}
+
+	userID, _ := common.GetUserID(c)
+	var card *model.Card
+	if err := ep.base.Write(c, func(db *gorm.DB) error {
+		return core.RetryTransaction(db, func(tx *gorm.DB) error {
+			var err error
+			if card, err = oktedicore.SetCardStatus(tx, tag, body.Status, body.Notes, on); err != nil {
+				return err
+			}
+			auditMsg := fmt.Sprintf("Card %s marked %s from %s", tag, body.Status, on)
+			return core.AuditChange(tx, userID, "Card", 0, 2, c.ClientIP(), "Card status changed", auditMsg, auditMsg)
+		})
+	}); err != nil {
+		writeCardError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, web.NewSuccessResponse(card))
+}
+
+// cardDate validates a YYYY-MM-DD date, defaulting to today in Brisbane.
+func cardDate(c *gin.Context, date string) (string, bool) {
+	if date == "" {
+		return utils.BrisbaneNow().Format("2006-01-02"), true
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse("invalid date: "+date))
+		return "", false
+	}
+	return date, true
+}
+
+func writeCardError(c *gin.Context, err error) {
+	var inUse *oktedicore.CardInUseError
+	switch {
+	case errors.As(err, &inUse):
+		c.JSON(http.StatusConflict, web.NewCodedErrorResponse("card_in_use", inUse.Error(), gin.H{"tag": inUse.Tag, "employeeId": inUse.EmployeeID}))
+	case errors.Is(err, oktedicore.ErrCardUnavailable):
+		c.JSON(http.StatusConflict, web.NewCodedErrorResponse("card_unavailable", err.Error(), nil))
+	case errors.Is(err, oktedicore.ErrCardDate), errors.Is(err, oktedicore.ErrCardStatus):
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse(err.Error()))
+	case errors.Is(err, oktedicore.ErrEmployeeMissing), errors.Is(err, oktedicore.ErrCardNotFound):
+		c.JSON(http.StatusNotFound, web.NewErrorResponse(err.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+	}
+}
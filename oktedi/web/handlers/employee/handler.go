@@ -26,6 +26,10 @@ func Register(r *gin.RouterGroup, dm *core.DatabaseManager) {
 	endpoint := &Endpoint{base: common.Handler{Dm: dm}}
 	r.POST("/employees/search", endpoint.Search)
 	r.GET("/employees/:id", endpoint.Detail)
+	r.PUT("/employees/:id", endpoint.base.RequirePermission(common.ModuleEmployees, core.AccessWrite), endpoint.AssignCard)
+	r.GET("/employees/:id/cards", endpoint.base.RequirePermission(common.ModuleEmployees, core.AccessRead), endpoint.Cards)
+	r.GET("/cards/:tag", endpoint.base.RequirePermission(common.ModuleEmployees, core.AccessRead), endpoint.Card)
+	r.PUT("/cards/:tag/status", endpoint.base.RequirePermission(common.ModuleEmployees, core.AccessWrite), endpoint.SetCardStatus)
 }
 
 type Sort struct {
@@ -1,77 +1,272 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"axiapac.com/axiapac/core"
+	oktedi "axiapac.com/axiapac/oktedi/core"
 	"axiapac.com/axiapac/oktedi/model"
 	oktedicommon "axiapac.com/axiapac/oktedi/web/common"
 	"axiapac.com/axiapac/utils"
 	"axiapac.com/axiapac/web/common"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
-func WatermelonPushHandler(dm *core.DatabaseManager) gin.HandlerFunc {
+// PushConflictError rejects a push that touches records changed on the server
+// after the kiosk's lastPulledAt. The kiosk should pull and push again.
+type PushConflictError struct {
+	IDs []string
+}
+
+func (e *PushConflictError) Error() string {
+	return fmt.Sprintf("%d records changed on the server since the last pull: %s", len(e.IDs), strings.Join(e.IDs, ", "))
+}
+
+// WatermelonPushHandler applies a kiosk push and publishes the resulting
+// attendance changes to the tenant's live dashboards on hub.
+func WatermelonPushHandler(dm *core.DatabaseManager, hub *oktedicommon.AttendanceHub) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var push WatermelonPush
 
-		// Parse JSON body
-		if err := c.ShouldBindJSON(&push); err != nil {
+		// Parse JSON body, keeping the raw bytes for the payload hash
+		if err := c.ShouldBindBodyWith(&push, binding.JSON); err != nil {
 			c.JSON(http.StatusBadRequest, common.NewErrorResponse(common.FormatBindingError(err)))
 			return
 		}
+		body, _ := c.Get(gin.BodyBytesKey)
+		sum := sha256.Sum256(body.([]byte))
+
+		deviceID := oktedicommon.GetDeviceID(c)
+		receipt := model.PushLog{
+			DeviceID:     deviceID,
+			Created:      len(push.Changes.Records.Created),
+			Updated:      len(push.Changes.Records.Updated),
+			Deleted:      len(push.Changes.Records.Deleted),
+			LastPulledAt: push.LastPulledAt,
+			PayloadHash:  hex.EncodeToString(sum[:]),
+		}
+		if push.BatchID != "" {
+			receipt.BatchID = &push.BatchID
+		}
+
+		// Every push, whatever its outcome, counts as the device being seen.
+		touchDevice := func(db *gorm.DB, now time.Time) error {
+			if deviceID == "" {
+				return nil
+			}
+			return oktedi.TouchDevice(db, deviceID, c.GetHeader("X-App-Version"), now)
+		}
 
+		var replay *model.PushLog
+		var events []oktedi.AttendanceEvent
+		tenant := oktedicommon.GetTenant(c)
 		hostname := oktedicommon.GetHostname(c.Request.Host)
-		if err := dm.Exec(c.Request.Context(), hostname, func(db *gorm.DB) error {
-			if err := BulkUpsertEmployeeClockInRecords(db, push.Changes.Records.Created); err != nil {
+		if err := dm.Transaction(c.Request.Context(), hostname, func(tx *gorm.DB) error {
+			replay, events = nil, nil
+			if err := touchDevice(tx, time.Now()); err != nil {
+				return err
+			}
+			if push.BatchID != "" {
+				prior, err := oktedi.FindPushReceipt(tx, push.BatchID)
+				if err != nil {
+					return err
+				}
+				if prior != nil && prior.Outcome == model.PushOutcomeOK {
+					replay = prior
+					return nil
+				}
+			}
+
+			// Kiosks that predate the pull endpoint send no lastPulledAt and
+			// are not checked.
+			if push.LastPulledAt > 0 {
+				conflicts, err := FindPushConflicts(tx, push.Changes.Records, deviceID, time.UnixMilli(push.LastPulledAt))
+				if err != nil {
+					return err
+				}
+				if len(conflicts) > 0 {
+					return &PushConflictError{IDs: conflicts}
+				}
+			}
+
+			now := time.Now()
+			if err := BulkUpsertEmployeeClockInRecords(tx, push.Changes.Records.Created, deviceID, now); err != nil {
+				return err
+			}
+			if err := UpdateEmployeeClockInRecords(tx, push.Changes.Records.Updated, deviceID, now); err != nil {
+				return err
+			}
+			deleted, err := TombstoneClockInRecords(tx, push.Changes.Records.Deleted, deviceID, now)
+			if err != nil {
 				return err
 			}
-			if err := BulkUpsertEmployeeClockInRecords(db, push.Changes.Records.Updated); err != nil {
+			if deleted > 0 {
+				userID, _ := oktedicommon.GetUserID(c)
+				auditMsg := fmt.Sprintf("%d clock-in records deleted on device %s: %s", deleted, deviceID, strings.Join(push.Changes.Records.Deleted, ", "))
+				if err := core.AuditChange(tx, userID, "ClockinRecord", 0, 2, c.ClientIP(), "Kiosk clock-in records deleted", auditMsg, auditMsg); err != nil {
+					return err
+				}
+			}
+
+			// Resolved before commit so they see this push's writes; a
+			// failure only costs the dashboards a live update.
+			if hub.HasSubscribers(tenant) {
+				ids := append(recordIDs(push.Changes.Records.Created), recordIDs(push.Changes.Records.Updated)...)
+				ids = append(ids, push.Changes.Records.Deleted...)
+				if events, err = oktedi.AttendanceEvents(tx, ids); err != nil {
+					log.Printf("[WARN] tenant %s: failed to resolve attendance events for push from device %q: %v", tenant, deviceID, err)
+					events = nil
+				}
+			}
+
+			response, err := json.Marshal(common.NewSuccessResponse(gin.H{
+				"lastPushedAt": now.Unix(),
+			}))
+			if err != nil {
 				return err
 			}
-			// if err := BulkUpsertEmployees(db, push.Changes.Records.Deleted); err != nil {
-			// 	return err
-			// }
-			return nil
+			receipt.Outcome = model.PushOutcomeOK
+			receipt.Status = http.StatusOK
+			receipt.Response = string(response)
+			receipt.CreatedAt, receipt.UpdatedAt = now, now
+			return oktedi.RecordPush(tx, &receipt)
 		}); err != nil {
-			c.JSON(http.StatusInternalServerError, common.NewErrorResponse(err.Error()))
+			status, body := http.StatusInternalServerError, common.NewErrorResponse(err.Error())
+			receipt.Outcome = model.PushOutcomeError
+			var conflict *PushConflictError
+			if errors.As(err, &conflict) {
+				log.Printf("[WARN] tenant %s: rejected push from device %q (lastPulledAt %d): %v", tenant, deviceID, push.LastPulledAt, conflict)
+				status, body = http.StatusConflict, common.NewCodedErrorResponse("conflict", conflict.Error(), gin.H{"ids": conflict.IDs})
+				receipt.Outcome = model.PushOutcomeConflict
+			}
+
+			// The transaction rolled back; record the failure on its own.
+			receipt.Status, receipt.Error = status, err.Error()
+			receipt.CreatedAt, receipt.UpdatedAt = time.Now(), time.Now()
+			if logErr := dm.Exec(c.Request.Context(), hostname, func(db *gorm.DB) error {
+				if err := touchDevice(db, receipt.CreatedAt); err != nil {
+					return err
+				}
+				return oktedi.RecordPush(db, &receipt)
+			}); logErr != nil {
+				log.Printf("[WARN] tenant %s: failed to log push from device %q: %v", tenant, deviceID, logErr)
+			}
+			c.JSON(status, body)
+			return
+		}
+
+		if replay != nil {
+			if replay.PayloadHash != receipt.PayloadHash {
+				c.JSON(http.StatusConflict, common.NewCodedErrorResponse("batch_reused",
+					"batch "+push.BatchID+" was already applied with a different payload", nil))
+				return
+			}
+			c.Data(replay.Status, "application/json; charset=utf-8", []byte(replay.Response))
 			return
 		}
+		hub.Publish(tenant, events...)
+		c.Data(receipt.Status, "application/json; charset=utf-8", []byte(receipt.Response))
+	}
+}
+
+// FindPushConflicts returns the ids in the push whose kiosk fields changed, or
+// that were deleted, after `since` by anyone but deviceID, locking them until
+// the transaction ends. A device's own changes don't count, so a push retried
+// without a batch id passes.
+func FindPushConflicts(db *gorm.DB, records Records, deviceID string, since time.Time) ([]string, error) {
+	ids := append(recordIDs(records.Created), recordIDs(records.Updated)...)
+	ids = append(ids, records.Deleted...)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var conflicts []string
+	err := findPushConflicts(db, ids, deviceID, since).Pluck("id", &conflicts).Error
+	return conflicts, err
+}
+
+func findPushConflicts(db *gorm.DB, ids []string, deviceID string, since time.Time) *gorm.DB {
+	query := db.Unscoped().Model(&model.ClockinRecord{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ? AND (changed_at > ? OR deleted_at > ?)", ids, since, since)
+	if deviceID != "" {
+		query = query.Where("NOT (changed_by <=> ?)", deviceID)
+	}
+	return query
+}
 
-		// Respond with success
-		c.JSON(http.StatusOK, common.NewSuccessResponse(gin.H{
-			"lastPushedAt": time.Now().Unix(),
-		}))
+func recordIDs(records []EmployeeClockInRecord) []string {
+	return utils.Map(records, func(e EmployeeClockInRecord) string { return e.ID })
+}
+
+func toClockinRecord(e EmployeeClockInRecord, deviceID string, now time.Time) model.ClockinRecord {
+	date := e.Timestamp.In(utils.BrisbaneTZ)
+	return model.ClockinRecord{
+		ID:        e.ID,
+		Tag:       e.Tag,
+		Kind:      e.Kind,
+		Timestamp: e.Timestamp.Format(time.RFC3339),
+		Date:      date.Format("2006-01-02"),
+		CardID:    e.CardID,
+		DeviceID:  e.DeviceID,
+		Latitude:  e.Latitude,
+		Longitude: e.Longitude,
+		Accuracy:  e.Accuracy,
+
+		Status:  e.Status,
+		Changed: e.Changed,
+
+		ProcessStatus: "pending",
+		ChangedAt:     &now,
+		ChangedBy:     deviceID,
 	}
 }
 
-func BulkUpsertEmployeeClockInRecords(db *gorm.DB, employees []EmployeeClockInRecord) error {
+// pushColumns are the oktedi_records columns a kiosk owns, updated in full by
+// a push; a push never clears a tombstone. process_status is reset apart from
+// them, only when a tap's tag, kind or timestamp changes.
+var pushColumns = []string{"tag", "kind", "timestamp", "date", "card_id", "device_id", "latitude", "longitude", "accuracy", "status", "changed", "changed_at", "changed_by"}
+
+// requeueColumns are the columns whose change sends a tap back to Prepare.
+var requeueColumns = []string{"tag", "kind", "timestamp"}
 
+// changedColumns maps the kiosk's raw column names, as listed in `_changed`,
+// to the oktedi_records columns they set.
+var changedColumns = map[string][]string{
+	"tag":       {"tag"},
+	"kind":      {"kind"},
+	"timestamp": {"timestamp", "date"},
+	"cardId":    {"card_id"},
+	"card_id":   {"card_id"},
+	"deviceId":  {"device_id"},
+	"device_id": {"device_id"},
+	// A fix is one reading; any part changing rewrites all three.
+	"latitude":  {"latitude", "longitude", "accuracy"},
+	"longitude": {"latitude", "longitude", "accuracy"},
+	"accuracy":  {"latitude", "longitude", "accuracy"},
+}
+
+func BulkUpsertEmployeeClockInRecords(db *gorm.DB, employees []EmployeeClockInRecord, deviceID string, now time.Time) error {
 	// Bulk upsert
 	if len(employees) > 0 {
 		records := utils.Map(employees, func(e EmployeeClockInRecord) model.ClockinRecord {
-			date := e.Timestamp.In(utils.BrisbaneTZ)
-			return model.ClockinRecord{
-				ID:        e.ID,
-				Tag:       e.Tag,
-				Kind:      e.Kind,
-				Timestamp: e.Timestamp.Format(time.RFC3339),
-				Date:      date.Format("2006-01-02"),
-				CardID:    e.CardID,
-				DeviceID:  e.DeviceID,
-
-				Status:  e.Status,
-				Changed: e.Changed,
-
-				ProcessStatus: "pending",
-			}
+			return toClockinRecord(e, deviceID, now)
 		})
 		if err := db.Clauses(clause.OnConflict{
 			Columns:   []clause.Column{{Name: "id"}}, // conflict key
-			UpdateAll: true,                          // update all fields on conflict
+			DoUpdates: upsertAssignments(),
 		}).Create(&records).Error; err != nil {
 			return err
 		}
@@ -79,3 +274,119 @@ func BulkUpsertEmployeeClockInRecords(db *gorm.DB, employees []EmployeeClockInRe
 
 	return nil
 }
+
+// upsertAssignments updates an existing record with a re-sent create. MySQL
+// applies assignments in order, so process_status is compared first, against
+// the columns as they were.
+func upsertAssignments() clause.Set {
+	same := make([]string, len(requeueColumns))
+	for i, column := range requeueColumns {
+		same[i] = fmt.Sprintf("`%[1]s` <=> VALUES(`%[1]s`)", column)
+	}
+	requeue := clause.Assignment{
+		Column: clause.Column{Name: "process_status"},
+		Value:  gorm.Expr("IF(" + strings.Join(same, " AND ") + ", `process_status`, VALUES(`process_status`))"),
+	}
+	return append(clause.Set{requeue}, clause.AssignmentColumns(pushColumns)...)
+}
+
+// UpdateEmployeeClockInRecords applies kiosk updates. A record with `_changed`
+// set only has the listed columns written, so fields changed on the server
+// since are kept; records the server has never seen are created.
+func UpdateEmployeeClockInRecords(db *gorm.DB, employees []EmployeeClockInRecord, deviceID string, now time.Time) error {
+	var missing []EmployeeClockInRecord
+	for _, e := range employees {
+		if err := requeueClockInRecord(db, e, deviceID); err != nil {
+			return err
+		}
+		result := updateClockInRecord(db, e, deviceID, now)
+		if result.Error != nil {
+			return result.Error
+		}
+		// changed_at always moves, so no rows means no (live) record.
+		if result.RowsAffected == 0 {
+			missing = append(missing, e)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	records := utils.Map(missing, func(e EmployeeClockInRecord) model.ClockinRecord {
+		return toClockinRecord(e, deviceID, now)
+	})
+	// A tombstoned record stays deleted.
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&records).Error
+}
+
+// updateClockInRecord writes a kiosk update to its record: the `_changed`
+// columns if listed, otherwise all of pushColumns.
+func updateClockInRecord(db *gorm.DB, e EmployeeClockInRecord, deviceID string, now time.Time) *gorm.DB {
+	record := toClockinRecord(e, deviceID, now)
+	values := map[string]any{
+		"tag": record.Tag, "kind": record.Kind, "timestamp": record.Timestamp, "date": record.Date,
+		"card_id": record.CardID, "device_id": record.DeviceID,
+		"latitude": record.Latitude, "longitude": record.Longitude, "accuracy": record.Accuracy,
+		"status": record.Status, "changed": record.Changed, "changed_at": now, "changed_by": deviceID,
+	}
+	return db.Model(&model.ClockinRecord{}).Where("id = ?", e.ID).Select(updateColumns(e)).Updates(values)
+}
+
+// updateColumns are the columns a kiosk update writes.
+func updateColumns(e EmployeeClockInRecord) []string {
+	if e.Changed == "" {
+		return pushColumns
+	}
+	columns := []string{"status", "changed", "changed_at", "changed_by"}
+	for _, name := range strings.Split(e.Changed, ",") {
+		columns = append(columns, changedColumns[strings.TrimSpace(name)]...)
+	}
+	return columns
+}
+
+// requeueClockInRecord sets a record back to pending before an update that
+// changes its tag, kind or timestamp; after the update there is nothing to
+// compare with. Other changes, such as a late GPS fix, leave it processed.
+func requeueClockInRecord(db *gorm.DB, e EmployeeClockInRecord, deviceID string) error {
+	where, args := requeueCondition(e, deviceID)
+	if where == "" {
+		return nil
+	}
+	return db.Model(&model.ClockinRecord{}).Where("id = ?", e.ID).Where(where, args...).
+		Update("process_status", "pending").Error
+}
+
+// requeueCondition matches a record whose requeueColumns differ from the ones
+// the update writes; "" when it writes none of them.
+func requeueCondition(e EmployeeClockInRecord, deviceID string) (string, []any) {
+	record := toClockinRecord(e, deviceID, time.Time{})
+	values := map[string]any{"tag": record.Tag, "kind": record.Kind, "timestamp": record.Timestamp}
+	columns := updateColumns(e)
+	var differs []string
+	var args []any
+	for _, column := range requeueColumns {
+		if slices.Contains(columns, column) {
+			differs = append(differs, "NOT (`"+column+"` <=> ?)")
+			args = append(args, values[column])
+		}
+	}
+	return strings.Join(differs, " OR "), args
+}
+
+// TombstoneClockInRecords soft-deletes the records a kiosk deleted, recording
+// the device, and returns how many were tombstoned. A device can only delete
+// its own taps. Ids that are unknown, belong to another device or are already
+// tombstoned are ignored, so a retried push is harmless.
+func TombstoneClockInRecords(db *gorm.DB, ids []string, deviceID string, now time.Time) (int64, error) {
+	if len(ids) == 0 || deviceID == "" {
+		return 0, nil
+	}
+	result := tombstoneClockInRecords(db, ids, deviceID, now)
+	return result.RowsAffected, result.Error
+}
+
+func tombstoneClockInRecords(db *gorm.DB, ids []string, deviceID string, now time.Time) *gorm.DB {
+	return db.Model(&model.ClockinRecord{}).
+		Where("id IN ? AND device_id = ?", ids, deviceID).
+		Updates(map[string]any{"deleted_at": now, "deleted_by": deviceID, "changed_at": now, "changed_by": deviceID})
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"axiapac.com/axiapac/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// dryRunDB builds statements against MySQL without connecting to it.
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "test:test@tcp(127.0.0.1:1)/test",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	return db
+}
+
+// assignments returns the columns an UPDATE sets, with their values.
+func assignments(t *testing.T, tx *gorm.DB) map[string]any {
+	t.Helper()
+	require.NoError(t, tx.Error)
+	sql := tx.Statement.SQL.String()
+	set := sql[strings.Index(sql, " SET ")+len(" SET ") : strings.Index(sql, " WHERE ")]
+	values := make(map[string]any)
+	for i, part := range strings.Split(set, ",") {
+		column := strings.Trim(strings.TrimSpace(strings.SplitN(part, "=", 2)[0]), "`")
+		values[column] = tx.Statement.Vars[i]
+	}
+	return values
+}
+
+func TestUpdateClockInRecordLocation(t *testing.T) {
+	now := time.Date(2026, 1, 12, 0, 0, 0, 0, time.UTC)
+	e := EmployeeClockInRecord{
+		ID:        "rec-1",
+		Tag:       "TAG1",
+		Timestamp: time.Date(2026, 1, 11, 22, 0, 0, 0, time.UTC),
+		Latitude:  utils.Ptr(-5.21),
+		Longitude: utils.Ptr(141.13),
+		Accuracy:  utils.Ptr(12.0),
+	}
+
+	t.Run("full update", func(t *testing.T) {
+		set := assignments(t, updateClockInRecord(dryRunDB(t), e, "KIOSK-1", now))
+		for _, column := range pushColumns {
+			assert.Contains(t, set, column)
+		}
+		assert.Equal(t, utils.Ptr(-5.21), set["latitude"])
+		assert.Equal(t, utils.Ptr(141.13), set["longitude"])
+		assert.Equal(t, utils.Ptr(12.0), set["accuracy"])
+	})
+
+	t.Run("changed location", func(t *testing.T) {
+		e := e
+		e.Changed = "latitude,longitude"
+		set := assignments(t, updateClockInRecord(dryRunDB(t), e, "KIOSK-1", now))
+		assert.Equal(t, utils.Ptr(-5.21), set["latitude"])
+		assert.Equal(t, utils.Ptr(141.13), set["longitude"])
+		assert.Equal(t, utils.Ptr(12.0), set["accuracy"])
+		assert.NotContains(t, set, "tag")
+		assert.NotContains(t, set, "timestamp")
+		assert.Equal(t, "KIOSK-1", set["changed_by"])
+	})
+}
+
+func TestRequeueCondition(t *testing.T) {
+	e := EmployeeClockInRecord{
+		ID:        "rec-1",
+		Tag:       "TAG1",
+		Kind:      "in",
+		Timestamp: time.Date(2026, 1, 11, 22, 0, 0, 0, time.UTC),
+	}
+
+	where, args := requeueCondition(e, "KIOSK-1")
+	assert.Equal(t, "NOT (`tag` <=> ?) OR NOT (`kind` <=> ?) OR NOT (`timestamp` <=> ?)", where)
+	assert.Equal(t, []any{"TAG1", "in", "2026-01-11T22:00:00Z"}, args)
+
+	e.Changed = "timestamp,latitude"
+	where, args = requeueCondition(e, "KIOSK-1")
+	assert.Equal(t, "NOT (`timestamp` <=> ?)", where)
+	assert.Equal(t, []any{"2026-01-11T22:00:00Z"}, args)
+
+	// A late GPS fix doesn't send the tap back to Prepare.
+	e.Changed = "latitude,longitude"
+	where, _ = requeueCondition(e, "KIOSK-1")
+	assert.Empty(t, where)
+}
+
+func TestUpsertAssignmentsRequeueFirst(t *testing.T) {
+	set := upsertAssignments()
+	require.NotEmpty(t, set)
+	assert.Equal(t, "process_status", set[0].Column.Name, "compared before the tap's columns are overwritten")
+	for _, a := range set[1:] {
+		assert.NotEqual(t, "process_status", a.Column.Name)
+	}
+}
+
+func TestFindPushConflictsSkipsOwnChanges(t *testing.T) {
+	since := time.Date(2026, 1, 12, 0, 0, 0, 0, time.UTC)
+
+	tx := findPushConflicts(dryRunDB(t), []string{"rec-1"}, "KIOSK-1", since).Find(&[]string{})
+	require.NoError(t, tx.Error)
+	assert.Contains(t, tx.Statement.SQL.String(), "NOT (changed_by <=> ?)")
+	assert.Contains(t, tx.Statement.Vars, "KIOSK-1")
+
+	// Without a device every change counts.
+	tx = findPushConflicts(dryRunDB(t), []string{"rec-1"}, "", since).Find(&[]string{})
+	require.NoError(t, tx.Error)
+	assert.NotContains(t, tx.Statement.SQL.String(), "changed_by")
+}
+
+func TestTombstoneClockInRecordsOwnDevice(t *testing.T) {
+	now := time.Date(2026, 1, 12, 0, 0, 0, 0, time.UTC)
+	tx := tombstoneClockInRecords(dryRunDB(t), []string{"rec-1", "rec-2"}, "KIOSK-1", now)
+	require.NoError(t, tx.Error)
+
+	sql := tx.Statement.SQL.String()
+	where := sql[strings.Index(sql, " WHERE "):]
+	assert.Contains(t, where, "device_id = ?")
+	assert.Contains(t, tx.Statement.Vars, "KIOSK-1")
+	assert.Equal(t, "KIOSK-1", assignments(t, tx)["deleted_by"])
+}
@@ -0,0 +1,189 @@
+package photo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"axiapac.com/axiapac/core"
+	"axiapac.com/axiapac/infrastructure/filesystem"
+	oktedi "axiapac.com/axiapac/oktedi/core"
+	"axiapac.com/axiapac/oktedi/model"
+	common "axiapac.com/axiapac/oktedi/web/common"
+	web "axiapac.com/axiapac/web/common"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// linkTTL is how long a presigned photo link stays valid.
+const linkTTL = 15 * time.Minute
+
+// recordIDPattern matches the ids kiosks and the CSV import give taps. Ids
+// end up in storage keys, so nothing else is accepted.
+var recordIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,191}$`)
+
+type Endpoint struct {
+	base  common.Handler
+	store filesystem.Store
+}
+
+// Register adds the photo endpoints. With a nil store uploads are refused and
+// no photos are served.
+func Register(r *gin.RouterGroup, dm *core.DatabaseManager, store filesystem.Store) {
+	endpoint := &Endpoint{base: common.Handler{Dm: dm}, store: store}
+	r.PUT("/records/:id/photo", endpoint.Upload)
+	r.GET("/records/:id/photo", endpoint.base.RequirePermission(common.ModuleTimesheets, core.AccessRead), endpoint.Get)
+}
+
+// URL is where a client fetches photo: a presigned link when the store issues
+// them, otherwise the streaming route under basePath.
+func URL(ctx context.Context, store filesystem.Store, basePath string, photo model.RecordPhoto) string {
+	url, err := store.URL(ctx, photo.StorageKey, linkTTL)
+	if err != nil {
+		log.Printf("[WARN] photo of record %s: %v", photo.RecordID, err)
+	}
+	if url == "" {
+		url = basePath + "/records/" + photo.RecordID + "/photo"
+	}
+	return url
+}
+
+// Upload stores the photo a kiosk took with a tap. The body is the raw image
+// (JPEG, PNG or WebP, up to 5 MB). It may be sent before or after the push
+// carrying the tap; sending it again replaces it. Only a device token may
+// upload, and only for its own taps: a photo from another device is a 403.
+//
+//	PUT /records/:id/photo
+func (ep *Endpoint) Upload(c *gin.Context) {
+	recordID, ok := parseRecordID(c)
+	if !ok {
+		return
+	}
+	deviceID := common.GetDeviceID(c)
+	if deviceID == "" {
+		c.JSON(http.StatusForbidden, web.NewErrorResponse("photos can only be uploaded by a kiosk"))
+		return
+	}
+	if ep.store == nil {
+		c.JSON(http.StatusServiceUnavailable, web.NewErrorResponse("photo storage is not configured"))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, oktedi.MaxPhotoSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, web.NewErrorResponse("photo is larger than 5 MB"))
+			return
+		}
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse(err.Error()))
+		return
+	}
+	if len(body) == 0 {
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse("photo is empty"))
+		return
+	}
+	// Trust the bytes, not the Content-Type header.
+	contentType := http.DetectContentType(body)
+	if !oktedi.PhotoContentTypes[contentType] {
+		c.JSON(http.StatusUnsupportedMediaType, web.NewErrorResponse("photo must be a JPEG, PNG or WebP image"))
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	photo := model.RecordPhoto{
+		RecordID:    recordID,
+		StorageKey:  oktedi.PhotoKey(common.GetTenant(c), recordID),
+		ContentType: contentType,
+		Size:        int64(len(body)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		DeviceID:    deviceID,
+	}
+	// Checked before the store is written, as the upload replaces the file,
+	// and again when the photo is saved.
+	if err := ep.base.Read(c, func(db *gorm.DB) error {
+		return oktedi.CheckPhotoDevice(db, recordID, deviceID)
+	}); err != nil {
+		writeUploadError(c, err)
+		return
+	}
+	if err := ep.store.Put(c.Request.Context(), photo.StorageKey, contentType, bytes.NewReader(body)); err != nil {
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+	if err := ep.base.Write(c, func(db *gorm.DB) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			if err := oktedi.CheckPhotoDevice(tx, recordID, deviceID); err != nil {
+				return err
+			}
+			return oktedi.SaveRecordPhoto(tx, &photo)
+		})
+	}); err != nil {
+		writeUploadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, web.NewSuccessResponse(photo))
+}
+
+// Get streams a tap's photo, for stores that can't presign links.
+func (ep *Endpoint) Get(c *gin.Context) {
+	recordID, ok := parseRecordID(c)
+	if !ok {
+		return
+	}
+	if ep.store == nil {
+		c.JSON(http.StatusNotFound, web.NewErrorResponse("photo not found"))
+		return
+	}
+
+	var photo model.RecordPhoto
+	if err := ep.base.Read(c, func(db *gorm.DB) error {
+		return db.Where("record_id = ?", recordID).Take(&photo).Error
+	}); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, web.NewErrorResponse("photo not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+
+	r, err := ep.store.Open(c.Request.Context(), photo.StorageKey)
+	if err != nil {
+		if errors.Is(err, filesystem.ErrNotFound) {
+			c.JSON(http.StatusNotFound, web.NewErrorResponse("photo not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+	defer r.Close()
+
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.DataFromReader(http.StatusOK, photo.Size, photo.ContentType, r, nil)
+}
+
+func writeUploadError(c *gin.Context, err error) {
+	if errors.Is(err, oktedi.ErrPhotoDevice) {
+		c.JSON(http.StatusForbidden, web.NewErrorResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+}
+
+func parseRecordID(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	if !recordIDPattern.MatchString(id) {
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse("invalid record id"))
+		return "", false
+	}
+	return id, true
+}
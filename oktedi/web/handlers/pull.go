@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"axiapac.com/axiapac/core"
+	oktedi "axiapac.com/axiapac/oktedi/core"
+	oktedicommon "axiapac.com/axiapac/oktedi/web/common"
+	"axiapac.com/axiapac/web/common"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// WatermelonPullHandler returns the employees, jobs, job cost centres and
+// supervisor assignments changed since the kiosk's lastPulledAt, as a
+// WatermelonDB changeset with the server timestamp for the next pull.
+func WatermelonPullHandler(dm *core.DatabaseManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var pull WatermelonPull
+		if err := c.ShouldBindJSON(&pull); err != nil {
+			c.JSON(http.StatusBadRequest, common.NewErrorResponse(common.FormatBindingError(err)))
+			return
+		}
+
+		var since time.Time
+		if pull.LastPulledAt != nil && *pull.LastPulledAt > 0 {
+			since = time.UnixMilli(*pull.LastPulledAt)
+		}
+
+		// Pulls read the replica; the first pull after the sync rows go stale
+		// refreshes them on the primary.
+		now := time.Now()
+		var result *oktedi.PullResult
+		if err := oktedicommon.ReadSynced(c, dm, oktedi.PullSync, oktedi.PullSources, now, func(db *gorm.DB) error {
+			var err error
+			result, err = oktedi.Pull(db, since, now)
+			return err
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, common.NewErrorResponse(err.Error()))
+			return
+		}
+
+		c.JSON(http.StatusOK, common.NewSuccessResponse(result))
+	}
+}
@@ -76,8 +76,8 @@ func SaveSupervisorRecordsHandler(dm *core.DatabaseManager) gin.HandlerFunc {
 		}
 
 		hostname := oktedicommon.GetHostname(c.Request.Host)
-		if err := dm.Exec(c.Request.Context(), hostname, func(db *gorm.DB) error {
-			if err := BulkUpsert(db, supervisorId, data); err != nil {
+		if err := dm.Transaction(c.Request.Context(), hostname, func(tx *gorm.DB) error {
+			if err := BulkUpsert(tx, supervisorId, data); err != nil {
 				return err
 			}
 
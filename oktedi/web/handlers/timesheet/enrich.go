@@ -13,8 +13,9 @@ import (
 // enrichReviewColumns populates the daily-review-only derived fields on results:
 //   - RosteredHours: the employee's assigned work-hours duration for the day
 //     (same source as the snapping rules).
-//   - ClockOn/ClockOff/Worked: the raw min/max clock times for the employee+date
+//   - ClockOn/ClockOff: the raw min/max clock times for the employee's shift
 //     from oktedi_records (Brisbane time), matching how prepare derives them.
+//   - Worked: the hours inside the shift's in/out segments, less the break.
 //
 // These are not stored on the timesheet, so they're computed on read. The work
 // is batched (a few IN-queries scoped to the page) and reuses the core helpers
@@ -46,13 +47,9 @@ func enrichReviewColumns(db *gorm.DB, results []OktediTimesheetDTO) {
 	var emps []models.Employee
 	db.Where("EmployeeId IN ?", empIDs).Find(&emps)
 	empByID := make(map[int32]models.Employee, len(emps))
-	tags := make([]string, 0, len(emps))
 	regionIDs := make([]int32, 0)
 	for _, e := range emps {
 		empByID[e.EmployeeID] = e
-		if e.IdentificationTag != "" {
-			tags = append(tags, e.IdentificationTag)
-		}
 		if e.CalendarRegionID != 0 {
 			regionIDs = append(regionIDs, e.CalendarRegionID)
 		}
@@ -80,32 +77,36 @@ func enrichReviewColumns(db *gorm.DB, results []OktediTimesheetDTO) {
 		}
 	}
 
-	// Raw clock pairs keyed by "tag|date" (Brisbane-adjusted).
-	type clockPair struct{ in, out *time.Time }
-	clockByTagDate := make(map[string]clockPair)
+	// Every card the employees have held, so taps go to whoever held the card
+	// on the day.
+	cards, err := oktedi.LoadEmployeeCards(db, emps)
+	if err != nil {
+		cards = oktedi.CardHolders{}
+	}
+	tags := make([]string, 0, len(cards)+len(emps))
+	for tag := range cards {
+		tags = append(tags, tag)
+	}
+	for _, e := range emps {
+		if _, tracked := cards[e.IdentificationTag]; e.IdentificationTag != "" && !tracked {
+			tags = append(tags, e.IdentificationTag)
+		}
+	}
+
+	// Raw clock pairs per employee and shift date; the next days are read for
+	// night shifts.
+	var clocks map[oktedi.EmployeeDay]clockPair
 	if len(tags) > 0 {
-		var records []*model.ClockinRecord
-		db.Where("tag IN ? AND date IN ?", tags, dateStrs).Find(&records)
-		byDate := make(map[string][]*model.ClockinRecord)
-		for _, rec := range records {
-			byDate[rec.Date] = append(byDate[rec.Date], rec)
-		}
-		for ds, recs := range byDate {
-			for _, g := range oktedi.GroupRecords(recs) {
-				var pair clockPair
-				if s := g.GetClockIn(); s != "" {
-					if t, err := utils.ParseISOTime(s); err == nil {
-						pair.in = utils.AdjustUtcToBrisbaneHours(t)
-					}
-				}
-				if s := g.GetClockOut(); s != "" {
-					if t, err := utils.ParseISOTime(s); err == nil {
-						pair.out = utils.AdjustUtcToBrisbaneHours(t)
-					}
-				}
-				clockByTagDate[g.Tag+"|"+ds] = pair
+		queryDates := append([]string(nil), dateStrs...)
+		for _, r := range results {
+			if ds := r.Date.AddDate(0, 0, 1).Format("2006-01-02"); !seenDate[ds] {
+				seenDate[ds] = true
+				queryDates = append(queryDates, ds)
 			}
 		}
+		var records []*model.ClockinRecord
+		db.Where("tag IN ? AND date IN ?", tags, queryDates).Find(&records)
+		clocks = shiftClocks(records, emps, cards, empWH, regionWH)
 	}
 
 	for i := range results {
@@ -134,7 +135,7 @@ func enrichReviewColumns(db *gorm.DB, results []OktediTimesheetDTO) {
 		}
 
 		// Raw clock on/off/worked.
-		if pair, ok := clockByTagDate[emp.IdentificationTag+"|"+r.Date.Format("2006-01-02")]; ok {
+		if pair, ok := clocks[oktedi.EmployeeDay{EmployeeID: emp.EmployeeID, Date: r.Date.Format("2006-01-02")}]; ok {
 			if pair.in != nil {
 				s := pair.in.Format("2006-01-02T15:04:05")
 				r.ClockOn = &s
@@ -143,9 +144,10 @@ func enrichReviewColumns(db *gorm.DB, results []OktediTimesheetDTO) {
 				s := pair.out.Format("2006-01-02T15:04:05")
 				r.ClockOff = &s
 			}
-			if pair.in != nil && pair.out != nil {
-				// Worked = clock off - clock on - break, floored at 0.
-				w := pair.out.Sub(*pair.in).Hours()
+			if pair.worked != nil {
+				// Worked = time in segments - break, floored at 0. Gaps between
+				// segments and unmatched taps are left out, as in prepare.
+				w := *pair.worked
 				if r.Break != nil {
 					w -= float64(*r.Break) / 60.0
 				}
@@ -157,3 +159,74 @@ func enrichReviewColumns(db *gorm.DB, results []OktediTimesheetDTO) {
 		}
 	}
 }
+
+// clockPair is a shift's first and last tap (Brisbane-adjusted) and the hours
+// inside its in/out segments.
+type clockPair struct {
+	in, out *time.Time
+	worked  *float64
+}
+
+// shiftClocks keys the employees' taps by employee and date of the shift they
+// belong to. A tap goes to whoever held its card on the tap's date, and a
+// night shift's taps after midnight count towards the day it started, as in
+// prepare.
+func shiftClocks(
+	records []*model.ClockinRecord,
+	emps []models.Employee,
+	cards oktedi.CardHolders,
+	empWH map[int32]map[int32]models.EmployeeWorkHour,
+	regionWH map[int32]map[int32]models.RegionWorkHour,
+) map[oktedi.EmployeeDay]clockPair {
+	empByID := make(map[int32]models.Employee, len(emps))
+	empByTag := make(map[string]models.Employee, len(emps))
+	for _, e := range emps {
+		empByID[e.EmployeeID] = e
+		if e.IdentificationTag != "" {
+			empByTag[e.IdentificationTag] = e
+		}
+	}
+	holders := make(map[*model.ClockinRecord]int32, len(records))
+	shifted := make([]*model.ClockinRecord, 0, len(records))
+	for _, rec := range records {
+		emp, ok := cards.EmployeeOn(rec.Tag, rec.Date, empByID, empByTag)
+		if !ok {
+			continue
+		}
+		if t, err := utils.ParseISOTime(rec.Timestamp); err == nil {
+			if ds := oktedi.ShiftDate(*t, emp, empWH, regionWH); ds != rec.Date {
+				moved := *rec
+				moved.Date = ds
+				rec = &moved
+			}
+		}
+		holders[rec] = emp.EmployeeID
+		shifted = append(shifted, rec)
+	}
+
+	clocks := make(map[oktedi.EmployeeDay]clockPair)
+	groups := oktedi.GroupRecordsByEmployee(shifted, func(r *model.ClockinRecord) (int32, bool) {
+		id, ok := holders[r]
+		return id, ok
+	})
+	for day, g := range groups {
+		var pair clockPair
+		if s := g.GetClockIn(); s != "" {
+			if t, err := utils.ParseISOTime(s); err == nil {
+				pair.in = utils.AdjustUtcToBrisbaneHours(t)
+			}
+		}
+		if s := g.GetClockOut(); s != "" {
+			if t, err := utils.ParseISOTime(s); err == nil {
+				pair.out = utils.AdjustUtcToBrisbaneHours(t)
+			}
+		}
+		if segments, _ := g.Segments(); len(segments) > 0 {
+			if h, err := oktedi.WorkedHours(segments); err == nil {
+				pair.worked = &h
+			}
+		}
+		clocks[day] = pair
+	}
+	return clocks
+}
@@ -0,0 +1,80 @@
+package timesheet
+
+import (
+	"testing"
+	"time"
+
+	"axiapac.com/axiapac/core/models"
+	oktedi "axiapac.com/axiapac/oktedi/core"
+	"axiapac.com/axiapac/oktedi/model"
+	"axiapac.com/axiapac/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShiftClocks(t *testing.T) {
+	// Employee 1 works days; employee 2 works 18:00–06:00 nights. Jan 12 2026
+	// is a Monday.
+	emps := []models.Employee{
+		{EmployeeID: 1, IdentificationTag: "DAY"},
+		{EmployeeID: 2, IdentificationTag: "NIGHT"},
+	}
+	empWH := map[int32]map[int32]models.EmployeeWorkHour{
+		1: {1: {EmployeeID: 1, Start: "07:00", Finish: "15:00"}},
+		2: {1: {EmployeeID: 2, Start: "18:00", Finish: "06:00"}},
+	}
+	tap := func(tag, date, utc string) *model.ClockinRecord {
+		return &model.ClockinRecord{Tag: tag, Date: date, Timestamp: utc}
+	}
+	records := []*model.ClockinRecord{
+		// 07:00–10:00 and 11:00–15:00 Brisbane, an hour off site between.
+		tap("DAY", "2026-01-12", "2026-01-11T21:00:00Z"),
+		tap("DAY", "2026-01-12", "2026-01-12T00:00:00Z"),
+		tap("DAY", "2026-01-12", "2026-01-12T01:00:00Z"),
+		tap("DAY", "2026-01-12", "2026-01-12T05:00:00Z"),
+		// 18:00 Monday to 06:00 Tuesday.
+		tap("NIGHT", "2026-01-12", "2026-01-12T08:00:00Z"),
+		tap("NIGHT", "2026-01-13", "2026-01-12T20:00:00Z"),
+	}
+
+	clocks := shiftClocks(records, emps, nil, empWH, nil)
+
+	day, ok := clocks[oktedi.EmployeeDay{EmployeeID: 1, Date: "2026-01-12"}]
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2026, 1, 12, 7, 0, 0, 0, time.UTC), *day.in)
+	assert.Equal(t, time.Date(2026, 1, 12, 15, 0, 0, 0, time.UTC), *day.out)
+	require.NotNil(t, day.worked)
+	assert.InDelta(t, 7.0, *day.worked, 1e-9, "the gap is not worked")
+
+	night, ok := clocks[oktedi.EmployeeDay{EmployeeID: 2, Date: "2026-01-12"}]
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2026, 1, 13, 6, 0, 0, 0, time.UTC), *night.out)
+	require.NotNil(t, night.worked)
+	assert.InDelta(t, 12.0, *night.worked, 1e-9)
+	assert.NotContains(t, clocks, oktedi.EmployeeDay{EmployeeID: 2, Date: "2026-01-13"})
+}
+
+func TestShiftClocksCardHistory(t *testing.T) {
+	// Card C was employee 2's until Jan 11 and is employee 1's from Jan 12;
+	// employee 1's current tag is C.
+	emps := []models.Employee{
+		{EmployeeID: 1, IdentificationTag: "C"},
+		{EmployeeID: 2},
+	}
+	cards := oktedi.CardHolders{"C": {
+		{Tag: "C", EmployeeID: 2, EffectiveFrom: "2000-01-01", EffectiveTo: utils.Ptr("2026-01-11")},
+		{Tag: "C", EmployeeID: 1, EffectiveFrom: "2026-01-12"},
+	}}
+	records := []*model.ClockinRecord{
+		{Tag: "C", Date: "2026-01-11", Timestamp: "2026-01-10T21:00:00Z"},
+		{Tag: "C", Date: "2026-01-11", Timestamp: "2026-01-11T05:00:00Z"},
+		{Tag: "C", Date: "2026-01-12", Timestamp: "2026-01-11T21:00:00Z"},
+		{Tag: "C", Date: "2026-01-12", Timestamp: "2026-01-12T05:00:00Z"},
+	}
+
+	clocks := shiftClocks(records, emps, cards, nil, nil)
+
+	assert.Contains(t, clocks, oktedi.EmployeeDay{EmployeeID: 2, Date: "2026-01-11"})
+	assert.Contains(t, clocks, oktedi.EmployeeDay{EmployeeID: 1, Date: "2026-01-12"})
+	assert.NotContains(t, clocks, oktedi.EmployeeDay{EmployeeID: 1, Date: "2026-01-11"})
+}
@@ -7,6 +7,7 @@ import (
 	web "axiapac.com/axiapac/web/common"
 	"github.com/gin-gonic/gin"
 	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
 )
 
 func (ep *Endpoint) Export(c *gin.Context) {
@@ -18,16 +19,13 @@ func (ep *Endpoint) Export(c *gin.Context) {
 		return
 	}
 
-	db, conn, err := ep.base.GetDB(c)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
-		return
-	}
-	defer conn.Close()
-
-	// Use a sufficiently large limit to get all timesheets
-	timesheets, _, err := SearchTimesheets(db, searchParams, -1, 0)
-	if err != nil {
+	var timesheets []OktediTimesheetDTO
+	if err := ep.base.Read(c, func(db *gorm.DB) error {
+		var err error
+		// Use a sufficiently large limit to get all timesheets
+		timesheets, _, err = SearchTimesheets(db, searchParams, -1, 0)
+		return err
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
 		return
 	}
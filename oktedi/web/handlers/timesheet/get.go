@@ -5,7 +5,9 @@ import (
 	"strconv"
 
 	"axiapac.com/axiapac/core/models"
+	oktedi "axiapac.com/axiapac/oktedi/core"
 	"axiapac.com/axiapac/oktedi/model"
+	"axiapac.com/axiapac/oktedi/web/handlers/photo"
 	web "axiapac.com/axiapac/web/common"
 	"github.com/gin-gonic/gin"
 )
@@ -36,12 +38,29 @@ func (ep *Endpoint) Get(c *gin.Context) {
 
 	dateStr := ts.Date.Format("2006-01-02")
 
-	// Fetch Clockin Records
-	var clockinRecords []model.ClockinRecord
-	if ts.Employee.IdentificationTag != "" {
-		if err := db.Where("tag = ? AND date = ?", ts.Employee.IdentificationTag, dateStr).
-			Find(&clockinRecords).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, web.NewErrorResponse("Failed to fetch clockin records"))
+	// Fetch Clockin Records of the day's shift, by the cards the employee
+	// held that day or the next, as Prepare does; a night shift's include its
+	// taps after midnight
+	tags, err := oktedi.ShiftTagsOn(db, ts.Employee, dateStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse("Failed to fetch cards"))
+		return
+	}
+	clockinRecords, err := oktedi.ShiftClockinRecords(db, ts.Employee, tags, dateStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse("Failed to fetch clockin records"))
+		return
+	}
+
+	// Fetch the taps' photos
+	photos := map[string]model.RecordPhoto{}
+	if ep.photos != nil && len(clockinRecords) > 0 {
+		ids := make([]string, len(clockinRecords))
+		for i, r := range clockinRecords {
+			ids[i] = r.ID
+		}
+		if photos, err = oktedi.LoadRecordPhotos(db, ids); err != nil {
+			c.JSON(http.StatusInternalServerError, web.NewErrorResponse("Failed to fetch clockin photos"))
 			return
 		}
 	}
@@ -106,9 +125,38 @@ func (ep *Endpoint) Get(c *gin.Context) {
 			Kind:      r.Kind,
 			Timestamp: r.Timestamp,
 			DeviceID:  r.DeviceID,
+			Latitude:  r.Latitude,
+			Longitude: r.Longitude,
+			Accuracy:  r.Accuracy,
+		}
+		if p, ok := photos[r.ID]; ok {
+			url := photo.URL(c.Request.Context(), ep.photos, ep.basePath, p)
+			clockinDTOs[i].PhotoURL = &url
 		}
 	}
 
+	// Pair the taps the way Prepare does
+	recordPtrs := make([]*model.ClockinRecord, len(clockinRecords))
+	for i := range clockinRecords {
+		recordPtrs[i] = &clockinRecords[i]
+	}
+	segments, unmatched := oktedi.SegmentRecords(recordPtrs)
+	segmentDTOs := make([]SegmentDTO, len(segments))
+	for i, seg := range segments {
+		hours, _ := seg.Hours()
+		segmentDTOs[i] = SegmentDTO{
+			InID:     seg.In.ID,
+			OutID:    seg.Out.ID,
+			ClockIn:  seg.In.Timestamp,
+			ClockOut: seg.Out.Timestamp,
+			Hours:    hours,
+		}
+	}
+	unmatchedIDs := make([]string, len(unmatched))
+	for i, r := range unmatched {
+		unmatchedIDs[i] = r.ID
+	}
+
 	supervisorDTOs := make([]SupervisorRecordDTO, len(supervisorRecords))
 	for i, r := range supervisorRecords {
 		supervisorDTOs[i] = SupervisorRecordDTO{
@@ -148,10 +196,12 @@ func (ep *Endpoint) Get(c *gin.Context) {
 	}
 
 	res := OktediTimesheetDetailDTO{
-		OktediTimesheet:   dto,
-		ClockinRecords:    clockinDTOs,
-		SupervisorRecords: supervisorDTOs,
-		DefinedWorkHours:  defWorkHours,
+		OktediTimesheet:    dto,
+		ClockinRecords:     clockinDTOs,
+		SupervisorRecords:  supervisorDTOs,
+		DefinedWorkHours:   defWorkHours,
+		Segments:           segmentDTOs,
+		UnmatchedRecordIDs: unmatchedIDs,
 	}
 
 	c.JSON(http.StatusOK, web.NewSuccessResponse(res))
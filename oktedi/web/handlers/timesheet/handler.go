@@ -7,6 +7,7 @@ import (
 
 	"axiapac.com/axiapac/core"
 	"axiapac.com/axiapac/core/models"
+	"axiapac.com/axiapac/infrastructure/filesystem"
 	oktedi "axiapac.com/axiapac/oktedi/core"
 	"axiapac.com/axiapac/oktedi/model"
 	common "axiapac.com/axiapac/oktedi/web/common"
@@ -17,16 +18,19 @@ import (
 
 type Endpoint struct {
 	base common.Handler
+	// photos holds clock-in photos; nil when photo storage isn't configured.
+	photos   filesystem.Store
+	basePath string
 }
 
-func Register(r *gin.RouterGroup, dm *core.DatabaseManager) {
-	endpoint := &Endpoint{base: common.Handler{Dm: dm}}
+func Register(r *gin.RouterGroup, dm *core.DatabaseManager, photos filesystem.Store) {
+	endpoint := &Endpoint{base: common.Handler{Dm: dm}, photos: photos, basePath: r.BasePath()}
 	r.POST("/timesheets/search", endpoint.Search)
 	r.POST("/timesheets/export", endpoint.Export)
 	r.GET("/timesheets/:id", endpoint.Get)
-	r.PUT("/timesheets/:id", endpoint.Update)
-	r.POST("/timesheets/prepare", endpoint.Prepare)
-	r.POST("/timesheets/sign-off", endpoint.SignOff)
+	r.PUT("/timesheets/:id", endpoint.base.RequirePermission(common.ModuleTimesheets, core.AccessWrite), endpoint.Update)
+	r.POST("/timesheets/prepare", endpoint.base.RequirePermission(common.ModuleTimesheets, core.AccessWrite), endpoint.Prepare)
+	r.POST("/timesheets/sign-off", endpoint.base.RequirePermission(common.ModuleTimesheets, core.AccessFull), endpoint.SignOff)
 }
 
 type OktediTimesheetUpdateDTO struct {
@@ -103,6 +107,11 @@ func (ep *Endpoint) Update(c *gin.Context) {
 	if updateDTO.Notes != nil {
 		ts.Notes = *updateDTO.Notes
 	}
+	// Moving the start or finish moves the hours with it, still leaving out
+	// the gap between the day's segments, unless the hours were set too.
+	if updateDTO.Hours == nil && (updateDTO.StartTime != nil || updateDTO.FinishTime != nil) {
+		ts.Hours = oktedi.SpanHours(ts)
+	}
 
 	// Recalculate review status
 	if ts.ReviewStatus != "accurate" {
@@ -59,12 +59,18 @@ type OktediTimesheetDTO struct {
 }
 
 type ClockinRecordDTO struct {
-	ID        string `json:"id"`
-	Tag       string `json:"tag"`
-	Date      string `json:"date"`
-	Kind      string `json:"kind"`
-	Timestamp string `json:"timestamp"`
-	DeviceID  string `json:"deviceId"`
+	ID        string   `json:"id"`
+	Tag       string   `json:"tag"`
+	Date      string   `json:"date"`
+	Kind      string   `json:"kind"`
+	Timestamp string   `json:"timestamp"`
+	DeviceID  string   `json:"deviceId"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Accuracy  *float64 `json:"accuracy"`
+	// PhotoURL links to the photo taken with the tap: presigned for S3,
+	// otherwise the /records/:id/photo stream. Null when there is none.
+	PhotoURL *string `json:"photoUrl"`
 }
 
 type SupervisorRecordDTO struct {
@@ -84,11 +90,23 @@ type DefinedWorkHoursDTO struct {
 	Break  int32  `json:"break"`
 }
 
+// SegmentDTO is one in/out pair of the day's taps, as Prepare counts them.
+type SegmentDTO struct {
+	InID     string  `json:"inId"`
+	OutID    string  `json:"outId"`
+	ClockIn  string  `json:"clockIn"`
+	ClockOut string  `json:"clockOut"`
+	Hours    float64 `json:"hours"`
+}
+
 type OktediTimesheetDetailDTO struct {
 	OktediTimesheet   OktediTimesheetDTO    `json:"timesheet"`
 	ClockinRecords    []ClockinRecordDTO    `json:"clockinRecords"`
 	SupervisorRecords []SupervisorRecordDTO `json:"supervisorRecords"`
 	DefinedWorkHours  *DefinedWorkHoursDTO  `json:"definedWorkHours"`
+	Segments          []SegmentDTO          `json:"segments"`
+	// UnmatchedRecordIDs are the clock-in records no segment pairs.
+	UnmatchedRecordIDs []string `json:"unmatchedRecordIds"`
 }
 
 func (dto OktediTimesheetDTO) MarshalJSON() ([]byte, error) {
@@ -114,7 +132,7 @@ type TimesheetCounts struct {
 	NotApproved int64
 	Required    int64
 	// Per review_status row counts (e.g. "absent", "missing-roster",
-	// "not-rostered") for the status-specific tabs.
+	// "not-rostered", "off-site", "unmatched") for the status-specific tabs.
 	StatusCounts map[string]int64
 }
 
@@ -250,7 +268,7 @@ func SearchTimesheets(db *gorm.DB, params SearchParams, limit, offset int) ([]Ok
 	if err := query.Session(&gorm.Session{}).Where("t1.approved = ?", false).Count(&counts.NotApproved).Error; err != nil {
 		return nil, counts, err
 	}
-	if err := query.Session(&gorm.Session{}).Where("t1.review_status IN ?", []string{"required", "absent", "not-rostered"}).Count(&counts.Required).Error; err != nil {
+	if err := query.Session(&gorm.Session{}).Where("t1.review_status IN ?", []string{"required", "absent", "not-rostered", "off-site", "unmatched"}).Count(&counts.Required).Error; err != nil {
 		return nil, counts, err
 	}
 
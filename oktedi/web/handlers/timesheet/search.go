@@ -6,6 +6,7 @@ import (
 
 	web "axiapac.com/axiapac/web/common"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type Sort struct {
@@ -61,17 +62,14 @@ func (ep *Endpoint) Search(c *gin.Context) {
 		offset = val
 	}
 
-	db, conn, err := ep.base.GetDB(c)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
-		return
-	}
-	defer conn.Close()
-
-	// timesheets, err := GetTimesheets(db, searchParams.StartDate.Time, searchParams.EndDate.Time, searchParams.Supervisors, searchParams.Projects, searchParams.Employees)
-	timesheets, counts, err := SearchTimesheets(db, searchParams, limit, offset)
-
-	if err != nil {
+	var timesheets []OktediTimesheetDTO
+	var counts TimesheetCounts
+	if err := ep.base.Read(c, func(db *gorm.DB) error {
+		var err error
+		// timesheets, err := GetTimesheets(db, searchParams.StartDate.Time, searchParams.EndDate.Time, searchParams.Supervisors, searchParams.Projects, searchParams.Employees)
+		timesheets, counts, err = SearchTimesheets(db, searchParams, limit, offset)
+		return err
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
 		return
 	}
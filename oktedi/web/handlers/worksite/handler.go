@@ -0,0 +1,144 @@
+package worksite
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"axiapac.com/axiapac/core"
+	"axiapac.com/axiapac/core/models"
+	oktedi "axiapac.com/axiapac/oktedi/core"
+	"axiapac.com/axiapac/oktedi/model"
+	common "axiapac.com/axiapac/oktedi/web/common"
+	web "axiapac.com/axiapac/web/common"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type Endpoint struct {
+	base common.Handler
+}
+
+func Register(r *gin.RouterGroup, dm *core.DatabaseManager) {
+	endpoint := &Endpoint{base: common.Handler{Dm: dm}}
+	r.GET("/worksites", endpoint.base.RequirePermission(common.ModuleEmployees, core.AccessRead), endpoint.List)
+	r.PUT("/worksites/:id/geofence", endpoint.base.RequirePermission(common.ModuleEmployees, core.AccessWrite), endpoint.SaveGeofence)
+	r.DELETE("/worksites/:id/geofence", endpoint.base.RequirePermission(common.ModuleEmployees, core.AccessWrite), endpoint.DeleteGeofence)
+}
+
+type WorkSiteDTO struct {
+	ID          int32            `json:"id"`
+	Code        string           `json:"code"`
+	Description string           `json:"description"`
+	Obsolete    bool             `json:"obsolete"`
+	Geofence    model.GeoPolygon `json:"geofence"` // null when the site has none
+}
+
+type GeofenceDTO struct {
+	Polygon model.GeoPolygon `json:"polygon" binding:"required"`
+}
+
+// List returns the work sites with their geofences.
+func (ep *Endpoint) List(c *gin.Context) {
+	var sites []models.WorkSite
+	var geofences oktedi.Geofences
+	if err := ep.base.Read(c, func(db *gorm.DB) error {
+		if err := db.Order("Code").Find(&sites).Error; err != nil {
+			return err
+		}
+		var err error
+		geofences, err = oktedi.LoadGeofences(db)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+		return
+	}
+
+	dtos := make([]WorkSiteDTO, len(sites))
+	for i, s := range sites {
+		dtos[i] = WorkSiteDTO{
+			ID:          s.WorkSiteID,
+			Code:        s.Code,
+			Description: s.Description,
+			Obsolete:    s.Obsolete,
+			Geofence:    geofences[s.WorkSiteID],
+		}
+	}
+	c.JSON(http.StatusOK, web.NewSuccessResponse(dtos))
+}
+
+// SaveGeofence sets a work site's geofence polygon. Taps by the site's
+// employees outside it are flagged "off-site" from the next prepare.
+//
+//	PUT /worksites/:id/geofence  {"polygon": [{"lat": -5.27, "lng": 141.22}, ...]}
+func (ep *Endpoint) SaveGeofence(c *gin.Context) {
+	workSiteID, ok := parseID(c)
+	if !ok {
+		return
+	}
+	var body GeofenceDTO
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse(web.FormatBindingError(err)))
+		return
+	}
+
+	var geofence *model.WorkSiteGeofence
+	if err := ep.base.Write(c, func(db *gorm.DB) error {
+		var err error
+		if geofence, err = oktedi.SaveGeofence(db, workSiteID, body.Polygon); err != nil {
+			return err
+		}
+		return ep.audit(c, db, fmt.Sprintf("Geofence of work site %d set (%d vertices)", workSiteID, len(body.Polygon)))
+	}); err != nil {
+		ep.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, web.NewSuccessResponse(geofence))
+}
+
+// DeleteGeofence removes a work site's geofence.
+func (ep *Endpoint) DeleteGeofence(c *gin.Context) {
+	workSiteID, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	if err := ep.base.Write(c, func(db *gorm.DB) error {
+		if err := oktedi.DeleteGeofence(db, workSiteID); err != nil {
+			return err
+		}
+		return ep.audit(c, db, fmt.Sprintf("Geofence of work site %d removed", workSiteID))
+	}); err != nil {
+		ep.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, web.NewSuccessResponse(gin.H{}))
+}
+
+func (ep *Endpoint) audit(c *gin.Context, db *gorm.DB, msg string) error {
+	userID, _ := common.GetUserID(c)
+	return core.AuditChange(db, userID, "WorkSiteGeofence", 0, 2, c.ClientIP(), "Work site geofence", msg, msg)
+}
+
+func (ep *Endpoint) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, oktedi.ErrInvalidGeofence):
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse(err.Error()))
+	case errors.Is(err, oktedi.ErrWorkSiteNotFound):
+		c.JSON(http.StatusNotFound, web.NewErrorResponse(err.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, web.NewErrorResponse(err.Error()))
+	}
+}
+
+func parseID(c *gin.Context) (int32, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, web.NewErrorResponse("invalid work site id"))
+		return 0, false
+	}
+	return int32(id), true
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/base64"
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -9,35 +9,80 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"axiapac.com/axiapac/console"
 	"axiapac.com/axiapac/core"
+	"axiapac.com/axiapac/infrastructure/filesystem"
 	oktedicommon "axiapac.com/axiapac/oktedi/web/common"
 	clockin "axiapac.com/axiapac/oktedi/web/handlers"
 	"axiapac.com/axiapac/oktedi/web/handlers/dashboard"
+	"axiapac.com/axiapac/oktedi/web/handlers/device"
 	"axiapac.com/axiapac/oktedi/web/handlers/employee"
+	"axiapac.com/axiapac/oktedi/web/handlers/photo"
 	"axiapac.com/axiapac/oktedi/web/handlers/timesheet"
 	"axiapac.com/axiapac/oktedi/web/handlers/whoami"
+	"axiapac.com/axiapac/oktedi/web/handlers/worksite"
+	"axiapac.com/axiapac/security"
 	"axiapac.com/axiapac/web/common"
 	"axiapac.com/axiapac/web/handlers"
 	"axiapac.com/axiapac/web/middlewares"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
 )
 
+// newDatabaseManager uses per-tenant pools when pools is set as
+// "<conns per tenant>/<total conns>" (e.g. "5/50"), and the shared
+// USE-per-request pool otherwise.
+func newDatabaseManager(dsn string, pools string) (*core.DatabaseManager, error) {
+	if pools == "" {
+		return core.New(dsn, 10)
+	}
+	perTenant, total, ok := strings.Cut(pools, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid AXIAPAC_TENANT_POOLS %q: expected <per tenant>/<total>", pools)
+	}
+	opts := core.PoolOptions{}
+	var err error
+	if opts.MaxConnsPerTenant, err = strconv.Atoi(perTenant); err != nil {
+		return nil, fmt.Errorf("invalid AXIAPAC_TENANT_POOLS %q: %w", pools, err)
+	}
+	if opts.MaxConns, err = strconv.Atoi(total); err != nil {
+		return nil, fmt.Errorf("invalid AXIAPAC_TENANT_POOLS %q: %w", pools, err)
+	}
+	return core.NewWithTenantPools(dsn, opts)
+}
+
 func main() {
 	r := gin.Default()
 	dsn := os.Getenv("DSN")
 	fmt.Printf("using DSN: %s\n", dsn)
 	region := os.Getenv("AWS_REGION")
 	fmt.Printf("using REGION: %s\n", region)
-	dm, err := core.New(dsn, 10)
+	dm, err := newDatabaseManager(dsn, os.Getenv("AXIAPAC_TENANT_POOLS"))
 
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer dm.Close()
 
+	// Dashboard reads go to the replica when one is configured.
+	if replicaDSN := os.Getenv("REPLICA_DSN"); replicaDSN != "" {
+		if err := dm.AddReplica(replicaDSN, 10); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Tenants are validated against the console subscriptions. Local dev, with
+	// no console database, sets AXIAPAC_TENANTS=host to trust the Host header.
+	if os.Getenv("AXIAPAC_TENANTS") != "host" {
+		consoleDB, err := console.Connect(context.Background())
+		if err != nil {
+			log.Fatal("Failed to connect to console:", err)
+		}
+		dm.Tenants = console.NewTenantResolver(consoleDB, 5*time.Minute)
+	}
+
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"message": "pong",
@@ -45,10 +90,9 @@ func main() {
 	})
 
 	r.POST("/upload/multiple", handlers.UploadMultipleHandler)
-	base64Secret := os.Getenv("AXIAPAC_SIGNING_SECRET")
-	jwtSecret, err := base64.StdEncoding.DecodeString(base64Secret)
+	keyring, err := security.ParseKeyring(os.Getenv("AXIAPAC_SIGNING_KEYS"))
 	if err != nil {
-		log.Fatal("Failed to decode JWT secret:", err)
+		log.Fatal("Failed to load signing keys:", err)
 	}
 
 	r.GET("/api/oktedi/manifest/dev", func(c *gin.Context) {
@@ -58,8 +102,41 @@ func main() {
 		})
 	})
 
+	base := &oktedicommon.Handler{Dm: dm}
+
+	// Public keys for verifying the Host tenant's tokens; other services fetch
+	// these instead of sharing a secret.
+	r.GET("/.well-known/jwks.json", base.RequireTenant(), func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, keyring.JWKS(oktedicommon.GetTenant(c)))
+	})
+	hub := oktedicommon.NewAttendanceHub()
+
+	// Clock-in photos go to "s3://bucket/prefix" or a local directory. Without
+	// a store, kiosk photo uploads are refused.
+	var photos filesystem.Store
+	if location := os.Getenv("AXIAPAC_PHOTO_STORE"); location != "" {
+		if photos, err = filesystem.NewStore(context.Background(), location); err != nil {
+			log.Fatal("Failed to open photo store:", err)
+		}
+	}
+
+	// Kiosk enrollment / token refresh: called before the device holds a token.
+	public := r.Group("/api/oktedi/v1.0")
+	public.Use(base.RequireTenant())
+	device.RegisterPublic(public, dm, keyring)
+
 	protected := r.Group("/api/oktedi/v1.0")
-	protected.Use(middlewares.Authentication(jwtSecret))
+	protected.Use(base.RequireTenant())
+	protected.Use(middlewares.Authentication(keyring, oktedicommon.GetTenant, core.NewUserStateCache(dm, 30*time.Second)))
+	// Searches and exports post their filters but only read. Pulls read the
+	// replica unless they find the sync rows due a refresh.
+	protected.Use(base.ReadYourWrites(10*time.Second,
+		protected.BasePath()+"/timesheets/search",
+		protected.BasePath()+"/timesheets/export",
+		protected.BasePath()+"/employees/search",
+		protected.BasePath()+"/pull",
+	))
 	{
 		protected.GET("/hello", func(c *gin.Context) {
 			claims, _ := c.Get("claims")
@@ -68,71 +145,15 @@ func main() {
 				"claims":  claims,
 			})
 		})
-		timesheet.Register(protected, dm)
+		timesheet.Register(protected, dm, photos)
 		employee.Register(protected, dm)
-		dashboard.Register(protected, dm)
+		dashboard.Register(protected, dm, hub)
 		whoami.Register(protected, dm)
+		worksite.Register(protected, dm)
+		photo.Register(protected, dm, photos)
+		device.Register(protected, dm, keyring)
 
-		protected.GET("/data", func(c *gin.Context) {
-			// result := ""
-			// fmt.Println(input.Query)
-			ctx := c.Request.Context()
-			var employees []EmployeeInfo
-			var jobs []JobInfo
-			var costCentres []CostCentreInfo
-
-			hostname := oktedicommon.GetHostname(c.Request.Host)
-			if err := dm.Exec(ctx, hostname, func(db *gorm.DB) error {
-				// employees
-				err := db.Table("employees").
-					Select(`
-		employees.employeeid as id,
-        employees.identificationTag as tag,
-		employees.code as code,
-		employees.picture as avatar,
-        employees.firstname as first_name,
-        employees.surname as last_name,
-		employees.jobid as job_id,
-		employees.costcentreid AS cost_centre_id,
-        employees.reportstoid as supervisor_id,
-		CAST(JSON_EXTRACT(employees.attributes, '$.backToBack.id') AS UNSIGNED) as back_to_back_id
-    `).
-					Scan(&employees).Error
-				if err != nil {
-					return err
-				}
-				// jobs
-				err = db.Table("jobs").
-					Select(`
-		jobs.jobid as id,
-        jobs.jobno as job_no,
-        jobs.description as description
-    `).
-					Scan(&jobs).Error
-				if err != nil {
-					return err
-				}
-				// costcentres
-				err = db.Raw(`
-		SELECT 
-			jcc.jobid AS job_id,
-			cc.costcentreid AS id,
-			cc.code AS code,
-			cc.description AS description
-		FROM jobcostcentres jcc JOIN costcentres cc USING (costcentreid)
-    `).
-					Scan(&costCentres).Error
-				if err != nil {
-					return err
-				}
-				return nil
-			}); err != nil {
-				c.JSON(http.StatusInternalServerError, common.NewErrorResponse(err.Error()))
-				return
-			}
-
-			c.JSON(http.StatusOK, common.NewSuccessResponse(Data{Employees: employees, Jobs: jobs, CostCentres: costCentres}))
-		})
+		protected.GET("/data", referenceData(dm))
 
 		protected.GET("/supervisors/:supervisorId/assignments", clockin.SearchSupervisorRecordsHandler(dm))
 		protected.POST("/supervisors/:supervisorId/assignments", clockin.SaveSupervisorRecordsHandler(dm))
@@ -143,6 +164,7 @@ func main() {
 			ctx := c.Request.Context()
 			var emp *EmployeeInfo
 			var crew []EmployeeInfo
+			isAdmin := false
 			hostname := oktedicommon.GetHostname(c.Request.Host)
 			if err := dm.Exec(ctx, hostname, func(db *gorm.DB) error {
 
@@ -196,6 +218,19 @@ func main() {
 					if err != nil {
 						return err
 					}
+
+					// Admin = the card holder's user may maintain employee tags.
+					var userID int32
+					if err := db.Table("users").Select("Id").Where("EmployeeId = ?", emp.ID).Limit(1).Scan(&userID).Error; err != nil {
+						return err
+					}
+					if userID != 0 {
+						perms, err := core.LoadUserPermissions(db, userID)
+						if err != nil {
+							return err
+						}
+						isAdmin = perms.Allows(oktedicommon.ModuleEmployees, core.AccessWrite)
+					}
 				}
 
 				return nil
@@ -204,7 +239,6 @@ func main() {
 				return
 			}
 
-			isAdmin := tag == "04791BE2BC1C90" || tag == "046682620E1590" || tag == "04A245E2BC1C90" || tag == "041A55B88F6180" || tag == "30372"
 			// respond with employee info and isAdmin flag
 			c.JSON(http.StatusOK, common.NewSuccessResponse(gin.H{
 				"employee": emp,
@@ -213,74 +247,8 @@ func main() {
 			}))
 		})
 
-		protected.PUT("/employees/:id", func(c *gin.Context) {
-			// get body "tag"
-			idStr := c.Param("id")
-			id, _ := strconv.Atoi(idStr)
-			var body struct {
-				Tag string `json:"tag"`
-			}
-			if err := c.ShouldBindJSON(&body); err != nil {
-				c.JSON(http.StatusBadRequest, common.NewErrorResponse(common.FormatBindingError(err)))
-				return
-			}
-			ctx := c.Request.Context()
-
-			hostname := oktedicommon.GetHostname(c.Request.Host)
-			if err := dm.Exec(ctx, hostname, func(db *gorm.DB) error {
-				return db.Transaction(func(tx *gorm.DB) error {
-					result := tx.Exec("UPDATE employees SET identificationTag = ? WHERE employeeid = ?", body.Tag, id)
-					if result.Error != nil {
-						return result.Error
-					}
-
-					// if result.RowsAffected >= 0 {
-					// 	return errors.New("no employee found with the given ID")
-					// }
-
-					// Add history and audit record
-					var userID int32
-					// Try to get UserId from claims
-					if claims, ok := c.Get("claims"); ok {
-						if m, ok := claims.(jwt.MapClaims); ok {
-							if uid, ok := m["nameid"].(string); ok {
-								if id, err := strconv.Atoi(uid); err == nil {
-									userID = int32(id)
-								}
-							} else if uid, ok := m["nameid"].(float64); ok {
-								userID = int32(uid)
-							}
-						}
-					}
-
-					auditMsg := "Identification Tag changed to " + body.Tag
-					if err := core.AuditChange(tx, userID, "Employee", int32(id), 2, c.ClientIP(), "Employee identificationtag updated", auditMsg, auditMsg); err != nil {
-						return err
-					}
-
-					return nil
-				})
-			}); err != nil {
-				c.JSON(http.StatusInternalServerError, common.NewErrorResponse(err.Error()))
-				return
-			}
-
-			c.JSON(http.StatusOK, common.NewSuccessResponse(gin.H{}))
-		})
-
-		protected.POST("/pull", func(c *gin.Context) {
-			bodyBytes, err := c.GetRawData()
-			if err != nil {
-				c.String(http.StatusBadRequest, "Error reading body")
-				return
-			}
-
-			bodyString := string(bodyBytes)
-			fmt.Println(bodyString)
-			c.JSON(http.StatusOK, gin.H{"message": "pong"})
-		})
-
-		protected.POST("/push", clockin.WatermelonPushHandler(dm))
+		protected.POST("/pull", clockin.WatermelonPullHandler(dm))
+		protected.POST("/push", clockin.WatermelonPushHandler(dm, hub))
 
 	}
 
@@ -302,12 +270,6 @@ func main() {
 	r.Run("0.0.0.0:8090")
 }
 
-type Data struct {
-	Employees   []EmployeeInfo   `json:"employees"`
-	Jobs        []JobInfo        `json:"jobs"`
-	CostCentres []CostCentreInfo `json:"costCentres"`
-}
-
 type EmployeeInfo struct {
 	ID           uint    `json:"id"`
 	Code         string  `json:"code"`
@@ -320,16 +282,3 @@ type EmployeeInfo struct {
 	SupervisorID *uint   `json:"supervisorId"`
 	BackToBackID *uint   `json:"backToBackId"`
 }
-
-type JobInfo struct {
-	ID          uint   `json:"id"`
-	JobNo       string `json:"jobNo"`
-	Description string `json:"description"`
-}
-
-type CostCentreInfo struct {
-	ID          uint   `json:"id"`
-	JobId       int    `json:"jobId"`
-	Code        string `json:"code"`
-	Description string `json:"description"`
-}
@@ -2,6 +2,7 @@ package security
 
 import (
 	"encoding/base64"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -12,6 +13,15 @@ type AxiapacIdentity struct {
 	UserName string
 	Provider string
 	Email    string
+	// Tenant is the schema the token is issued for (e.g. "oktedi"). It is
+	// written to the `tenant` claim, and the `kid` header names one of the
+	// tenant's keys, so verifiers reject the token on any other tenant.
+	Tenant string
+	// DeviceID identifies an enrolled kiosk; written to the `sid` claim.
+	DeviceID string
+	// SecurityStamp is Users.SecurityStamp at issue time. Verifiers reject the
+	// token once the user's stamp has changed.
+	SecurityStamp string
 }
 
 // IdentityClaims includes Identity and standard JWT claims
@@ -22,24 +32,54 @@ type Identity struct {
 	Email      string `json:"email"`
 	SID        string `json:"sid"`
 	Provider   string `json:"provider"`
+	Tenant     string `json:"tenant,omitempty"`
+	Stamp      string `json:"security_stamp,omitempty"`
 }
 type IdentityClaims struct {
 	Identity
 	jwt.RegisteredClaims
 }
 
+// ClaimUserID reads the user id from a token's `nameid` claim, which may be
+// encoded as a string or a number.
+func ClaimUserID(claims jwt.MapClaims) (int32, bool) {
+	switch id := claims["nameid"].(type) {
+	case string:
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return 0, false
+		}
+		return int32(n), true
+	case float64:
+		return int32(id), true
+	}
+	return 0, false
+}
+
 func CreateIdentityToken(identity *AxiapacIdentity, base64Secret string, expiresInSeconds int64) (string, error) {
 	secretBytes, err := base64.StdEncoding.DecodeString(base64Secret)
 	if err != nil {
 		return "", err
 	}
+	// The Axiapac API verifies with the shared secret; kid names the tenant key
+	// in a verifier's Keyring.
+	return signIdentityToken(identity, jwt.SigningMethodHS256, identity.Tenant, secretBytes, expiresInSeconds)
+}
+
+func signIdentityToken(identity *AxiapacIdentity, method jwt.SigningMethod, kid string, key interface{}, expiresInSeconds int64) (string, error) {
+	sid := "axgo-deviceId"
+	if identity.DeviceID != "" {
+		sid = identity.DeviceID
+	}
 	claims := IdentityClaims{
 		Identity: Identity{
 			ID:         identity.Id,
 			UniqueName: identity.UserName,
 			Email:      identity.Email,
-			SID:        "axgo-deviceId",
+			SID:        sid,
 			Provider:   identity.Provider,
+			Tenant:     identity.Tenant,
+			Stamp:      identity.SecurityStamp,
 		},
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    "axiapac",
@@ -48,8 +88,10 @@ func CreateIdentityToken(identity *AxiapacIdentity, base64Secret string, expires
 		},
 	}
 
-	// Use HS256 signing method (symmetric key)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
 
-	return token.SignedString([]byte(secretBytes))
+	return token.SignedString(key)
 }
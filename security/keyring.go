@@ -0,0 +1,219 @@
+package security
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one key in a Keyring, addressed by the JWT `kid` header and
+// owned by a single tenant.
+type SigningKey struct {
+	ID     string
+	Tenant string
+	Method jwt.SigningMethod
+
+	// signKey is nil for verify-only keys (e.g. a public key whose private
+	// half lives on another service).
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// CanSign reports whether the keyring holds the private half of the key.
+func (k *SigningKey) CanSign() bool {
+	return k.signKey != nil
+}
+
+// Keyring holds the signing keys of every tenant. A tenant can have several
+// keys at once: the most recently added signing-capable key signs new tokens,
+// the older ones keep verifying tokens issued before the rotation until they
+// are removed from the keyring.
+type Keyring struct {
+	keys    map[string]*SigningKey // by kid
+	order   []string               // kids, in the order they were added
+	signing map[string]*SigningKey // by tenant
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{
+		keys:    make(map[string]*SigningKey),
+		signing: make(map[string]*SigningKey),
+	}
+}
+
+// ParseKeyring builds a Keyring from the AXIAPAC_SIGNING_KEYS env var: a
+// comma-separated list of entries, each one of
+//
+//	tenant:base64secret   HS256 shared secret; the kid is the tenant name
+//	tenant:kid:path.pem   RSA (RS256) or Ed25519 (EdDSA) key in PEM form
+//
+// A PEM file holding only a public key is verify-only. Entries are applied in
+// order, so to rotate a tenant's key append the new entry, and drop the old one
+// once every token it signed has expired.
+func ParseKeyring(spec string) (*Keyring, error) {
+	kr := NewKeyring()
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		tenant, rest, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid keyring entry %q: expected tenant:base64secret or tenant:kid:path.pem", entry)
+		}
+		if kid, path, ok := strings.Cut(rest, ":"); ok {
+			data, err := os.ReadFile(strings.TrimSpace(path))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read key %s: %w", kid, err)
+			}
+			if err := kr.AddPEM(tenant, kid, data); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := kr.Add(tenant, rest); err != nil {
+			return nil, err
+		}
+	}
+	if len(kr.keys) == 0 {
+		return nil, errors.New("keyring is empty")
+	}
+	return kr, nil
+}
+
+// Add registers the base64-encoded HS256 secret for a tenant, replacing any
+// existing secret. The key's kid is the tenant name.
+func (kr *Keyring) Add(tenant string, base64Secret string) error {
+	tenant = strings.TrimSpace(tenant)
+	if tenant == "" {
+		return errors.New("keyring tenant is required")
+	}
+	secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(base64Secret))
+	if err != nil {
+		return fmt.Errorf("invalid secret for %s: %w", tenant, err)
+	}
+	return kr.add(&SigningKey{
+		ID:        tenant,
+		Tenant:    tenant,
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	})
+}
+
+// AddPEM registers an asymmetric key for a tenant under kid. The PEM block may
+// be a PKCS#8 or PKCS#1 private key, or a PKIX public key (verify-only). RSA
+// keys sign RS256, Ed25519 keys sign EdDSA.
+func (kr *Keyring) AddPEM(tenant, kid string, data []byte) error {
+	tenant, kid = strings.TrimSpace(tenant), strings.TrimSpace(kid)
+	if tenant == "" || kid == "" {
+		return errors.New("keyring tenant and kid are required")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("key %s is not PEM encoded", kid)
+	}
+
+	key := &SigningKey{ID: kid, Tenant: tenant}
+	switch block.Type {
+	case "PRIVATE KEY":
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("invalid private key %s: %w", kid, err)
+		}
+		switch priv := priv.(type) {
+		case *rsa.PrivateKey:
+			key.Method, key.signKey, key.verifyKey = jwt.SigningMethodRS256, priv, &priv.PublicKey
+		case ed25519.PrivateKey:
+			key.Method, key.signKey, key.verifyKey = jwt.SigningMethodEdDSA, priv, priv.Public()
+		default:
+			return fmt.Errorf("key %s: unsupported private key type %T", kid, priv)
+		}
+	case "RSA PRIVATE KEY":
+		priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("invalid private key %s: %w", kid, err)
+		}
+		key.Method, key.signKey, key.verifyKey = jwt.SigningMethodRS256, priv, &priv.PublicKey
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("invalid public key %s: %w", kid, err)
+		}
+		switch pub := pub.(type) {
+		case *rsa.PublicKey:
+			key.Method, key.verifyKey = jwt.SigningMethodRS256, pub
+		case ed25519.PublicKey:
+			key.Method, key.verifyKey = jwt.SigningMethodEdDSA, pub
+		default:
+			return fmt.Errorf("key %s: unsupported public key type %T", kid, pub)
+		}
+	default:
+		return fmt.Errorf("key %s: unsupported PEM block %q", kid, block.Type)
+	}
+	return kr.add(key)
+}
+
+func (kr *Keyring) add(key *SigningKey) error {
+	if existing, ok := kr.keys[key.ID]; ok {
+		if existing.Tenant != key.Tenant {
+			return fmt.Errorf("kid %s is already used by tenant %s", key.ID, existing.Tenant)
+		}
+	} else {
+		kr.order = append(kr.order, key.ID)
+	}
+	kr.keys[key.ID] = key
+	if key.CanSign() {
+		kr.signing[key.Tenant] = key
+	}
+	return nil
+}
+
+// Lookup returns the key for kid, false when the keyring has no such key.
+func (kr *Keyring) Lookup(kid string) (*SigningKey, bool) {
+	key, ok := kr.keys[kid]
+	return key, ok
+}
+
+// SigningKey returns the key new tokens for tenant are signed with.
+func (kr *Keyring) SigningKey(tenant string) (*SigningKey, bool) {
+	key, ok := kr.signing[tenant]
+	return key, ok
+}
+
+// Keyfunc is a jwt.Keyfunc that picks the verification key by the token's
+// `kid` header. The token's algorithm must be the key's, so an RSA public key
+// can never be used as an HMAC secret, and its `tenant` claim must name the
+// key's tenant, so one tenant's key never vouches for another's token.
+func (kr *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := kr.Lookup(kid)
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	if claims, ok := token.Claims.(jwt.MapClaims); !ok || claims["tenant"] != key.Tenant {
+		return nil, errors.New("signing key belongs to another tenant")
+	}
+	return key.verifyKey, nil
+}
+
+// CreateIdentityToken signs an identity token with the current signing key of
+// identity.Tenant.
+func (kr *Keyring) CreateIdentityToken(identity *AxiapacIdentity, expiresInSeconds int64) (string, error) {
+	key, ok := kr.SigningKey(identity.Tenant)
+	if !ok {
+		return "", fmt.Errorf("no signing key for tenant %q", identity.Tenant)
+	}
+	return signIdentityToken(identity, key.Method, key.ID, key.signKey, expiresInSeconds)
+}
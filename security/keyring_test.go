@@ -0,0 +1,176 @@
+package security
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeyring(t *testing.T) {
+	kr, err := ParseKeyring("oktedi:c2VjcmV0LW9rdGVkaQ==, demo:c2VjcmV0LWRlbW8=")
+	require.NoError(t, err)
+
+	key, ok := kr.Lookup("oktedi")
+	require.True(t, ok)
+	assert.Equal(t, "oktedi", key.Tenant)
+	assert.Equal(t, []byte("secret-oktedi"), key.verifyKey)
+
+	key, ok = kr.Lookup("demo")
+	require.True(t, ok)
+	assert.Equal(t, []byte("secret-demo"), key.verifyKey)
+
+	_, ok = kr.Lookup("other")
+	assert.False(t, ok)
+
+	_, err = ParseKeyring("")
+	assert.Error(t, err, "empty keyring")
+	_, err = ParseKeyring("oktedi")
+	assert.Error(t, err, "missing secret")
+	_, err = ParseKeyring("oktedi:not base64")
+	assert.Error(t, err, "bad base64")
+}
+
+// Tokens carry the tenant in both the claim and the kid header, and are signed
+// with that tenant's key only.
+func TestKeyringCreateIdentityToken(t *testing.T) {
+	kr, err := ParseKeyring("oktedi:c2VjcmV0LW9rdGVkaQ==,demo:c2VjcmV0LWRlbW8=")
+	require.NoError(t, err)
+
+	tokenStr, err := kr.CreateIdentityToken(&AxiapacIdentity{Id: 7, Tenant: "oktedi"}, 60)
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte("secret-oktedi"), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "oktedi", token.Header["kid"])
+	assert.Equal(t, "oktedi", claims["tenant"])
+
+	_, err = jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		return []byte("secret-demo"), nil
+	})
+	assert.Error(t, err, "another tenant's key must not verify the token")
+
+	_, err = kr.CreateIdentityToken(&AxiapacIdentity{Id: 7, Tenant: "unknown"}, 60)
+	assert.Error(t, err)
+}
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+// The newest key signs; the previous one still verifies during the overlap
+// window, and both public keys are published in the JWKS.
+func TestKeyringRotation(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	oldKeys, err := ParseKeyring("oktedi:2026-01:" + writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)))
+	require.NoError(t, err)
+	oldToken, err := oldKeys.CreateIdentityToken(&AxiapacIdentity{Id: 7, Tenant: "oktedi"}, 60)
+	require.NoError(t, err)
+
+	kr, err := ParseKeyring("oktedi:c2VjcmV0LW9rdGVkaQ==," +
+		"oktedi:2026-01:" + writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)) + "," +
+		"oktedi:2026-07:" + writePEM(t, "PRIVATE KEY", edDER))
+	require.NoError(t, err)
+
+	newToken, err := kr.CreateIdentityToken(&AxiapacIdentity{Id: 7, Tenant: "oktedi"}, 60)
+	require.NoError(t, err)
+	token, err := jwt.Parse(newToken, kr.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, "EdDSA", token.Method.Alg())
+	assert.Equal(t, "2026-07", token.Header["kid"])
+
+	token, err = jwt.Parse(oldToken, kr.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, "RS256", token.Method.Alg())
+
+	jwks := kr.JWKS("oktedi")
+	require.Len(t, jwks.Keys, 2, "HMAC secrets are not published")
+	assert.Equal(t, "2026-01", jwks.Keys[0].Kid)
+	assert.Equal(t, "RSA", jwks.Keys[0].Kty)
+	assert.Equal(t, "AQAB", jwks.Keys[0].E)
+	assert.Equal(t, "2026-07", jwks.Keys[1].Kid)
+	assert.Equal(t, "OKP", jwks.Keys[1].Kty)
+	assert.Equal(t, "Ed25519", jwks.Keys[1].Crv)
+}
+
+// A public key alone verifies but cannot sign, and a token whose alg does not
+// match its kid's key is rejected.
+func TestKeyringVerifyOnly(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+
+	kr, err := ParseKeyring("oktedi:2026-01:" + writePEM(t, "PUBLIC KEY", pubDER))
+	require.NoError(t, err)
+
+	_, err = kr.CreateIdentityToken(&AxiapacIdentity{Id: 7, Tenant: "oktedi"}, 60)
+	assert.Error(t, err)
+
+	signed := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"tenant": "oktedi"})
+	signed.Header["kid"] = "2026-01"
+	signedStr, err := signed.SignedString(rsaKey)
+	require.NoError(t, err)
+	_, err = jwt.Parse(signedStr, kr.Keyfunc)
+	assert.NoError(t, err)
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"tenant": "oktedi"})
+	forged.Header["kid"] = "2026-01"
+	forgedStr, err := forged.SignedString(pubDER)
+	require.NoError(t, err)
+	_, err = jwt.Parse(forgedStr, kr.Keyfunc)
+	assert.Error(t, err, "the public key must not verify an HS256 token")
+
+	_, err = ParseKeyring("oktedi:2026-01:" + writePEM(t, "PUBLIC KEY", pubDER) + ",demo:2026-01:" + writePEM(t, "PUBLIC KEY", pubDER))
+	assert.Error(t, err, "a kid belongs to one tenant")
+}
+
+// Each tenant's JWKS lists only its own keys, and a key only verifies tokens
+// claiming its tenant.
+func TestKeyringTenantScope(t *testing.T) {
+	_, oktediKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	oktediDER, err := x509.MarshalPKCS8PrivateKey(oktediKey)
+	require.NoError(t, err)
+	_, demoKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	demoDER, err := x509.MarshalPKCS8PrivateKey(demoKey)
+	require.NoError(t, err)
+
+	kr, err := ParseKeyring("oktedi:oktedi-2026:" + writePEM(t, "PRIVATE KEY", oktediDER) + "," +
+		"demo:demo-2026:" + writePEM(t, "PRIVATE KEY", demoDER))
+	require.NoError(t, err)
+
+	jwks := kr.JWKS("oktedi")
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "oktedi-2026", jwks.Keys[0].Kid)
+	assert.Empty(t, kr.JWKS("other").Keys)
+
+	// demo signs a token claiming oktedi with its own key.
+	crossed := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"tenant": "oktedi"})
+	crossed.Header["kid"] = "demo-2026"
+	crossedStr, err := crossed.SignedString(demoKey)
+	require.NoError(t, err)
+	_, err = jwt.Parse(crossedStr, kr.Keyfunc)
+	assert.Error(t, err, "demo's key must not verify an oktedi token")
+}
@@ -1,8 +1,12 @@
 package common
 
 type Error struct {
-	// Code    int    `json:"code"`
+	// Code, when set, is a stable machine-readable reason clients can act on
+	// (e.g. "conflict").
+	Code    string `json:"code,omitempty"`
 	Message string `json:"message"`
+	// Details carries data for Code, such as the ids that conflicted.
+	Details any `json:"details,omitempty"`
 }
 
 type ErrorResponse struct {
@@ -15,3 +19,11 @@ func NewErrorResponse(message string) *ErrorResponse {
 		Error: &Error{Message: message},
 	}
 }
+
+// NewCodedErrorResponse is an error response with a machine-readable code and
+// optional details.
+func NewCodedErrorResponse(code, message string, details any) *ErrorResponse {
+	return &ErrorResponse{
+		Error: &Error{Code: code, Message: message, Details: details},
+	}
+}
@@ -1,33 +1,32 @@
 package middlewares
 
 import (
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
+	"axiapac.com/axiapac/core"
+	"axiapac.com/axiapac/security"
 	"axiapac.com/axiapac/web/common"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func parseJwt(tokenStr string, jwtSecret []byte) (*jwt.Token, error) {
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		// Ensure the signing method is HMAC (or switch to RSA/ECDSA)
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return jwtSecret, nil
-	},
-		// TEMP WORKAROUND: skip exp/nbf/iat validation so the kiosk's hardcoded
-		// (now-expired) token keeps working until it is rotated. Signature is
-		// still verified. REVERT this option (and restore the exp check below)
-		// once the kiosk ships a fresh token.
-		jwt.WithoutClaimsValidation(),
-	)
-	return token, err
+// parseJwt verifies the token against the keyring entry named by its `kid`
+// header. Tokens without a kid, for an unknown kid, or signed with a different
+// algorithm than the key's are rejected.
+func parseJwt(tokenStr string, keyring *security.Keyring) (*jwt.Token, error) {
+	return jwt.Parse(tokenStr, keyring.Keyfunc,
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}))
 }
 
-// AuthMiddleware checks for a valid Bearer token
-func Authentication(jwtSecret []byte) gin.HandlerFunc {
+// AuthMiddleware checks for a valid Bearer token. tenantOf resolves the
+// request's tenant (from the Host header); the token is only accepted when its
+// `tenant` claim and `kid` both name that tenant. When users is set, the
+// token's user must also be active, not locked out, and its `security_stamp`
+// claim must match Users.SecurityStamp.
+func Authentication(keyring *security.Keyring, tenantOf func(c *gin.Context) string, users *core.UserStateCache) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenStr := ""
 
@@ -53,27 +52,59 @@ func Authentication(jwtSecret []byte) gin.HandlerFunc {
 		}
 
 		// Parse and validate JWT
-		token, err := parseJwt(tokenStr, jwtSecret)
+		token, err := parseJwt(tokenStr, keyring)
 
 		if err != nil || !token.Valid {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, common.NewErrorResponse("invalid or expired token"))
 			return
 		}
 
-		// Optional: check claims
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			// TEMP WORKAROUND: exp check disabled to let the kiosk's expired
-			// hardcoded token through. Restore this block when reverting
-			// jwt.WithoutClaimsValidation() in parseJwt.
-			// if exp, ok := claims["exp"].(float64); ok && int64(exp) < time.Now().Unix() {
-			// 	c.AbortWithStatusJSON(http.StatusUnauthorized, common.NewErrorResponse("token expired"))
-			// 	return
-			// }
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, common.NewErrorResponse("invalid token claims"))
+			return
+		}
 
-			// Pass claims into context
-			c.Set("claims", claims)
+		if exp, ok := claims["exp"].(float64); ok && int64(exp) < time.Now().Unix() {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, common.NewErrorResponse("token expired"))
+			return
 		}
 
+		// Bind the token to the tenant it was issued for. The kid chose one of
+		// that tenant's keys; the claim must agree with it and with the Host.
+		tenant, _ := claims["tenant"].(string)
+		kid, _ := token.Header["kid"].(string)
+		key, _ := keyring.Lookup(kid)
+		if tenant == "" || key == nil || tenant != key.Tenant || tenant != tenantOf(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, common.NewErrorResponse("token is not valid for this tenant"))
+			return
+		}
+
+		if users != nil {
+			userID, ok := security.ClaimUserID(claims)
+			if !ok {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, common.NewErrorResponse("invalid token claims"))
+				return
+			}
+			state, err := users.Get(c.Request.Context(), tenant, userID)
+			if err != nil {
+				if errors.Is(err, core.ErrUserNotFound) {
+					c.AbortWithStatusJSON(http.StatusUnauthorized, common.NewErrorResponse(err.Error()))
+					return
+				}
+				c.AbortWithStatusJSON(http.StatusInternalServerError, common.NewErrorResponse(err.Error()))
+				return
+			}
+			stamp, _ := claims["security_stamp"].(string)
+			if err := state.Validate(stamp, time.Now()); err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, common.NewErrorResponse(err.Error()))
+				return
+			}
+		}
+
+		// Pass claims into context
+		c.Set("claims", claims)
+
 		c.Next()
 	}
 }